@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runConfig implements `busygraph config show`, printing the configuration
+// after the file, environment and flags have been applied.
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] != "show" {
+		return errors.New("usage: busygraph config show [-format toml|yaml] [flags]")
+	}
+
+	fs := flag.NewFlagSet("config show", flag.ExitOnError)
+	format := fs.String("format", "toml", "Output format: toml or yaml")
+	cfg, err := parseConfig(fs, args[1:])
+	if err != nil {
+		return err
+	}
+
+	if cfg.Source != "" {
+		fmt.Printf("# Loaded from %s\n", cfg.Source)
+	} else {
+		fmt.Println("# No configuration file found; defaults, environment and flags only")
+	}
+	return cfg.Write(os.Stdout, *format)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/victortrac/busygraph/internal/config"
+	"github.com/victortrac/busygraph/internal/helper"
+	"github.com/victortrac/busygraph/internal/hook"
+	"github.com/victortrac/busygraph/internal/input"
+	"github.com/victortrac/busygraph/internal/server"
+	"github.com/victortrac/busygraph/internal/tracker"
+	"github.com/victortrac/busygraph/internal/videocall"
+)
+
+// services are the long-running parts of BusyGraph shared by the tray and
+// headless modes.
+type services struct {
+	tracker  *tracker.Tracker
+	detector videocall.Detector
+
+	stopServer context.CancelFunc
+	serverDone chan struct{} // closed when the HTTP server has stopped
+	serverErr  error         // valid once serverDone is closed
+
+	trace *os.File // input trace being recorded, if any
+
+	stopInput chan struct{} // closed by stop
+	inputDone chan struct{} // closed when input capture has stopped
+
+	inputMu     sync.Mutex
+	inputSource input.Source // the running source
+	inputErr    error        // why the last source failed, until a new one runs
+}
+
+// inputRetry is the longest wait before restarting input capture that
+// failed, e.g. because no device was readable or the input helper exited.
+// The wait starts at a second and doubles after each failure, and starts
+// over once capture has run for inputRetry.
+const inputRetry = time.Minute
+
+// startServices starts the input hook, video call detector and HTTP server
+// feeding and reading t.
+func startServices(t *tracker.Tracker, cfg *config.Config) *services {
+	var vc videocall.Detector
+	if cfg.Features.VideoCalls {
+		vc = videocall.NewDetector()
+		vc.SetCallback(func(inCall, cameraActive, micActive bool, app string) {
+			t.TrackVideoCall(inCall, cameraActive, micActive, app)
+		})
+		vc.Start(cfg.DetectorPoll)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &services{
+		tracker:    t,
+		detector:   vc,
+		stopServer: cancel,
+		serverDone: make(chan struct{}),
+		stopInput:  make(chan struct{}),
+		inputDone:  make(chan struct{}),
+	}
+
+	o := cfg.HookOptions()
+	sink := hook.NewProcessor(t, o)
+	if tracePath != "" {
+		// Record the source's events before they are processed, so a
+		// replay can apply other settings.
+		f, err := os.Create(tracePath)
+		if err != nil {
+			log.Printf("Not recording input: %v", err)
+		} else {
+			log.Printf("Recording every input event, including which keys are pressed, to %s", tracePath)
+			s.trace = f
+			sink = input.NewRecorder(f, sink)
+		}
+	}
+	go s.captureInput(cfg, sink)
+	go func() {
+		s.serverErr = server.Run(ctx, t, vc, server.Options{
+			Addr:        cfg.Listen,
+			Metrics:     cfg.Features.Metrics,
+			MouseDPI:    cfg.MouseDPI,
+			InputStatus: s.inputStatus,
+		})
+		close(s.serverDone)
+	}()
+	return s
+}
+
+// stop shuts the services down and closes the tracker, flushing buffered
+// counts.
+func (s *services) stop() {
+	close(s.stopInput)
+	s.inputMu.Lock()
+	if s.inputSource != nil {
+		s.inputSource.Stop()
+	}
+	s.inputMu.Unlock()
+	<-s.inputDone
+	if s.trace != nil {
+		s.trace.Close()
+	}
+	if s.detector != nil {
+		s.detector.Stop()
+	}
+	s.stopServer()
+	<-s.serverDone
+	s.tracker.Close()
+}
+
+// captureInput runs an input source until stop is called. A source that
+// fails is restarted, backing off up to inputRetry, so the dashboard keeps
+// working without input, capture resumes once a device becomes readable,
+// and an input helper that exits is started again.
+func (s *services) captureInput(cfg *config.Config, sink input.Sink) {
+	defer close(s.inputDone)
+	delay := time.Second
+	for {
+		src := newInputSource(cfg, s.tracker)
+		if _, ok := src.(*helper.Source); ok && s.trace != nil {
+			log.Printf("Not recording input while the input helper captures it: it sends only counts")
+		}
+		s.inputMu.Lock()
+		select {
+		case <-s.stopInput:
+			s.inputMu.Unlock()
+			return
+		default:
+		}
+		s.inputSource = src
+		s.inputMu.Unlock()
+
+		started := time.Now()
+		err := src.Run(sink)
+		if err == nil {
+			err = errors.New("input capture stopped unexpectedly")
+		}
+		ranLong := time.Since(started) >= inputRetry
+		if ranLong {
+			delay = time.Second
+		}
+
+		s.inputMu.Lock()
+		s.inputSource = nil
+		changed := ranLong || s.inputErr == nil || s.inputErr.Error() != err.Error()
+		s.inputErr = err
+		s.inputMu.Unlock()
+
+		select {
+		case <-s.stopInput:
+			return
+		default:
+		}
+		if changed {
+			log.Printf("No input is being tracked: %v; retrying", err)
+		}
+		select {
+		case <-s.stopInput:
+			return
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, inputRetry)
+	}
+}
+
+// newInputSource returns the input source selected by input.backend. The
+// input helper is started if input.helper_binary is set, and connected to
+// otherwise; it sends its counts straight to t. With the auto backend and no
+// helper binary, the helper is used if it is listening, so the choice is
+// made again each time capture is restarted.
+func newInputSource(cfg *config.Config, t *tracker.Tracker) input.Source {
+	in := cfg.Input
+	switch {
+	case in.Backend == config.BackendEvdev:
+	case in.HelperBinary != "":
+		return helper.Spawn(in.HelperBinary, cfg.HelperEnv(), t)
+	case in.Backend == config.BackendHelper || helper.Reachable(in.HelperSocket):
+		return helper.NewSource(in.HelperSocket, t)
+	}
+	return hook.NewSource(cfg.HookOptions())
+}
+
+// inputStatus reports whether input is being captured, and why not.
+func (s *services) inputStatus() input.Status {
+	s.inputMu.Lock()
+	src, err := s.inputSource, s.inputErr
+	s.inputMu.Unlock()
+
+	if r, ok := src.(interface{ Status() input.Status }); ok {
+		return r.Status()
+	}
+	if err != nil {
+		return input.Status{Error: err.Error()}
+	}
+	return input.Status{Error: "input capture is not running"}
+}
+
+// runHeadless tracks input and serves the dashboard without a tray icon
+// until SIGINT or SIGTERM.
+func runHeadless(cfg *config.Config) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	t, err := tracker.Open(cfg.TrackerOptions()...)
+	if err != nil {
+		return err
+	}
+	log.Println("BusyGraph started (headless)")
+	svc := startServices(t, cfg)
+
+	select {
+	case <-ctx.Done():
+		log.Println("BusyGraph exiting...")
+	case <-svc.serverDone:
+	}
+	svc.stop()
+	return svc.serverErr
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/victortrac/busygraph/internal/hook"
+)
+
+// runDevices implements `busygraph devices`, listing the input devices the
+// hook can see and whether the configured rules let it capture them.
+func runDevices(args []string) error {
+	fs := flag.NewFlagSet("devices", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Print the device list as JSON")
+	cfg, err := parseConfig(fs, args, "input.include_devices", "input.exclude_devices")
+	if err != nil {
+		return err
+	}
+
+	devices, err := hook.ListDevices(cfg.HookOptions().Devices)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(devices)
+	}
+
+	if len(devices) == 0 {
+		fmt.Println("No input devices found.")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PATH\tID\tKIND\tSTATUS\tNAME\tPHYS")
+	for _, d := range devices {
+		id, kind, status := "-", d.Kind, "tracked"
+		if d.Name != "" || d.Vendor != 0 || d.Product != 0 {
+			id = d.ID()
+		}
+		if kind == "" {
+			kind = "-"
+		}
+		if !d.Tracked {
+			status = "ignored: " + d.Reason
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", d.Path, id, kind, status, d.Name, d.Phys)
+	}
+	return w.Flush()
+}
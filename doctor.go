@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/victortrac/busygraph/internal/config"
+	"github.com/victortrac/busygraph/internal/helper"
+	"github.com/victortrac/busygraph/internal/hook"
+)
+
+// runDoctor implements `busygraph doctor`, checking the things BusyGraph
+// needs to run and explaining what to fix.
+func runDoctor(args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	cfg, err := parseConfig(fs, args, "data_dir", "listen", "input.backend", "input.helper_socket", "input.helper_binary")
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	report := func(check, status string, err error) {
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL  %-10s %v\n", check, err)
+			return
+		}
+		fmt.Printf("ok    %-10s %s\n", check, status)
+	}
+
+	if cfg.Source != "" {
+		report("config", cfg.Source, nil)
+	} else {
+		report("config", "no config file, using defaults", nil)
+	}
+
+	if t, err := openTracker(cfg); err != nil {
+		report("database", "", err)
+	} else {
+		info := t.Info()
+		t.Close()
+		status := fmt.Sprintf("%s (schema version %d)", info.Database, info.SchemaVersion)
+		if len(info.Peers) > 0 {
+			status += fmt.Sprintf("; peers: %s", strings.Join(info.Peers, ", "))
+		}
+		report("database", status, nil)
+	}
+
+	status, err := diagnoseInput(cfg)
+	report("input", status, err)
+
+	status, err = checkDashboardPort(cfg)
+	report("dashboard", status, err)
+
+	if runtime.GOOS == "linux" {
+		if os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+			fmt.Printf("warn  %-10s no display; use 'busygraph run -headless'\n", "tray")
+		} else {
+			report("tray", "display available", nil)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	return nil
+}
+
+// diagnoseInput checks the input backend BusyGraph would use.
+func diagnoseInput(cfg *config.Config) (string, error) {
+	if cfg.Input.Backend != config.BackendEvdev && cfg.Input.HelperBinary != "" {
+		return diagnoseHelperBinary(cfg.Input.HelperBinary)
+	}
+	sock := cfg.Input.HelperSocket
+	if cfg.Input.Backend != config.BackendEvdev && helper.Reachable(sock) {
+		return "input helper listening at " + sock, nil
+	}
+	if cfg.Input.Backend == config.BackendHelper {
+		return "", fmt.Errorf("no input helper listening at %s; start 'busygraph input-helper'", sock)
+	}
+	return hook.Diagnose()
+}
+
+// diagnoseHelperBinary checks the binary BusyGraph would start as the input
+// helper.
+func diagnoseHelperBinary(path string) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("input helper: %w", err)
+	}
+	if fi.Mode()&0o111 == 0 {
+		return "", fmt.Errorf("input helper %s is not executable", path)
+	}
+	if fi.Mode()&os.ModeSetgid == 0 {
+		return "input helper " + path + " is not setgid, so it reads only the devices BusyGraph itself can", nil
+	}
+	return "input helper " + path + " (setgid)", nil
+}
+
+// checkDashboardPort reports whether the dashboard port is free or already
+// served by a running BusyGraph.
+func checkDashboardPort(cfg *config.Config) (string, error) {
+	ln, err := net.Listen("tcp", cfg.Listen)
+	if err == nil {
+		ln.Close()
+		return cfg.Listen + " is free", nil
+	}
+
+	client := http.Client{Timeout: 2 * time.Second}
+	resp, herr := client.Get(cfg.DashboardURL() + "/api/stats")
+	if herr == nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return "BusyGraph is running at " + cfg.DashboardURL() + "/dashboard", nil
+		}
+	}
+	return "", fmt.Errorf("%s is in use by another program: %v", cfg.Listen, err)
+}
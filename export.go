@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/victortrac/busygraph/internal/tracker"
+)
+
+// runExport implements `busygraph export`, writing raw minute data for the
+// local database and any federated peers to stdout or a file.
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	table := fs.String("table", "keystrokes", "Table to export: keystrokes, mouse, devices or calls")
+	format := fs.String("format", "csv", "Output format: csv or jsonl")
+	from := fs.String("from", "", "Start of the window (Unix seconds, RFC 3339 or YYYY-MM-DD)")
+	to := fs.String("to", "", "End of the window, exclusive; a date includes that whole day")
+	output := fs.String("o", "", "Write to this file instead of stdout")
+	cfg, err := parseConfig(fs, args, "data_dir")
+	if err != nil {
+		return err
+	}
+
+	opts := tracker.ExportOptions{Table: *table, Format: *format}
+	if *from != "" {
+		if opts.From, err = tracker.ParseTime(*from, false); err != nil {
+			return fmt.Errorf("-from: %w", err)
+		}
+	}
+	if *to != "" {
+		if opts.To, err = tracker.ParseTime(*to, true); err != nil {
+			return fmt.Errorf("-to: %w", err)
+		}
+	}
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	t, err := openTracker(cfg)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	out := os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	w := bufio.NewWriter(out)
+	if err := t.Export(w, opts); err != nil {
+		return err
+	}
+	return w.Flush()
+}
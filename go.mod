@@ -3,11 +3,13 @@ module github.com/victortrac/busygraph
 go 1.25.6
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/getlantern/systray v1.2.2
 	github.com/holoplot/go-evdev v0.0.0-20250804134636-ab1d56a1fe83
 	github.com/prometheus/client_golang v1.23.2
 	github.com/robotn/gohook v0.42.3
 	github.com/webview/webview_go v0.0.0-20240831120633-6173450d4dd6
+	gopkg.in/yaml.v3 v3.0.1
 	modernc.org/sqlite v1.44.3
 )
 
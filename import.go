@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/victortrac/busygraph/internal/tracker"
+)
+
+// runImport implements `busygraph import`, merging exports or other BusyGraph
+// databases into the local store.
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: busygraph import [flags] FILE.csv|FILE.jsonl|FILE.db ...")
+		fs.PrintDefaults()
+	}
+	merge := fs.String("merge", "sum", "How to combine rows for a minute that already has data: sum or max")
+	dryRun := fs.Bool("dry-run", false, "Report what would change without writing anything")
+	force := fs.Bool("force", false, "Import files even if they were imported before")
+	cfg, err := parseConfig(fs, args, "data_dir")
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no files to import")
+	}
+
+	t, err := openTracker(cfg)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	opts := tracker.ImportOptions{Merge: tracker.MergeMode(*merge), DryRun: *dryRun, Force: *force}
+	for _, path := range fs.Args() {
+		report, err := t.Import(path, opts)
+		if err != nil {
+			return err
+		}
+		printImportReport(report)
+	}
+	return nil
+}
+
+func printImportReport(r *tracker.ImportReport) {
+	switch {
+	case r.Skipped:
+		fmt.Printf("%s: already imported, skipping (use -force to import again)\n", r.Source)
+		return
+	case r.DryRun:
+		fmt.Printf("%s (dry run, nothing written):\n", r.Source)
+	default:
+		fmt.Printf("%s:\n", r.Source)
+	}
+	for _, tr := range r.Tables {
+		fmt.Printf("  %-10s %6d rows: %d new, %d updated, %d unchanged\n",
+			tr.Table, tr.Rows, tr.Inserted, tr.Updated, tr.Unchanged)
+	}
+	for _, w := range r.Warnings {
+		fmt.Printf("  warning: %s\n", w)
+	}
+}
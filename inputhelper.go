@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"os/user"
+	"runtime"
+	"slices"
+	"strconv"
+	"syscall"
+
+	"github.com/victortrac/busygraph/internal/config"
+	"github.com/victortrac/busygraph/internal/helper"
+	"github.com/victortrac/busygraph/internal/hook"
+)
+
+// runInputHelper implements `busygraph input-helper`, which reads the input
+// devices and sends per-minute counts of the input to one user's BusyGraph
+// over a Unix socket: either one it listens on, or one inherited from the
+// BusyGraph that started it. Only the helper needs to be in the input group.
+func runInputHelper(args []string) error {
+	fs := flag.NewFlagSet("input-helper", flag.ExitOnError)
+	allow := fs.String("allow-user", "", "User name or ID whose BusyGraph may connect (required unless -fd is given)")
+	fd := fs.Int("fd", -1, "Send counts on this inherited socket instead of listening, as BusyGraph does when it starts the helper")
+	cfg, err := parseConfig(fs, args, append(slices.Clone(config.HelperKeys), "input.helper_socket")...)
+	if err != nil {
+		return err
+	}
+	if runtime.GOOS != "linux" {
+		return errors.New("the input helper is only supported on Linux")
+	}
+	o := cfg.HookOptions()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *fd >= 0 {
+		log.SetPrefix("input-helper: ")
+		conn, err := net.FileConn(os.NewFile(uintptr(*fd), "socket"))
+		if err != nil {
+			return fmt.Errorf("-fd %d: %w", *fd, err)
+		}
+		// Run setgid, the real uid is that of whoever started the helper;
+		// only that user's BusyGraph may hold the other end.
+		srv := helper.NewServer(hook.NewSource(o), o, os.Getuid())
+		go func() {
+			<-ctx.Done()
+			srv.Close()
+		}()
+		return srv.ServeConn(conn)
+	}
+
+	if *allow == "" {
+		fs.Usage()
+		return errors.New("-allow-user is required")
+	}
+	uid, err := lookupUID(*allow)
+	if err != nil {
+		return err
+	}
+
+	ln, err := helper.Listen(cfg.Input.HelperSocket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(cfg.Input.HelperSocket)
+	log.Printf("Serving input counts to uid %d on %s", uid, cfg.Input.HelperSocket)
+
+	srv := helper.NewServer(hook.NewSource(o), o, uid)
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	return srv.Serve(ln)
+}
+
+// lookupUID resolves a user name or numeric ID.
+func lookupUID(name string) (int, error) {
+	if uid, err := strconv.Atoi(name); err == nil {
+		return uid, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return 0, fmt.Errorf("user %s has non-numeric uid %q", name, u.Uid)
+	}
+	return uid, nil
+}
@@ -0,0 +1,485 @@
+// Package config loads BusyGraph's settings from a TOML or YAML file under
+// $XDG_CONFIG_HOME/busygraph/, environment variables and command-line flags,
+// in increasing order of precedence.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/victortrac/busygraph/internal/helper"
+	"github.com/victortrac/busygraph/internal/hook"
+	"github.com/victortrac/busygraph/internal/tracker"
+)
+
+// Config is the effective configuration.
+type Config struct {
+	Listen        string        `toml:"listen" yaml:"listen"`
+	DataDir       string        `toml:"data_dir" yaml:"data_dir"`
+	FlushInterval time.Duration `toml:"flush_interval" yaml:"flush_interval"`
+	PeerRefresh   time.Duration `toml:"peer_refresh" yaml:"peer_refresh"`
+	DetectorPoll  time.Duration `toml:"detector_poll" yaml:"detector_poll"`
+	RollupAfter   time.Duration `toml:"rollup_after" yaml:"rollup_after"`
+	RawRetention  time.Duration `toml:"raw_retention" yaml:"raw_retention"`
+	MouseDPI      float64       `toml:"mouse_dpi" yaml:"mouse_dpi"`
+	Features      Features      `toml:"features" yaml:"features"`
+	Input         Input         `toml:"input" yaml:"input"`
+
+	// Source is the file the configuration was read from, if any.
+	Source string `toml:"-" yaml:"-"`
+}
+
+// Features toggles optional parts of BusyGraph.
+type Features struct {
+	VideoCalls bool `toml:"video_calls" yaml:"video_calls"` // poll for camera/microphone use
+	Federation bool `toml:"federation" yaml:"federation"`   // include peer databases in the data directory
+	Metrics    bool `toml:"metrics" yaml:"metrics"`         // serve Prometheus metrics at /metrics
+	Shortcuts  bool `toml:"shortcuts" yaml:"shortcuts"`     // record modifier chords such as [CTRL]+c
+	KeyTiming  bool `toml:"key_timing" yaml:"key_timing"`   // record key hold times and autorepeat per key category
+}
+
+// Input controls which input devices are captured. Rules are described by
+// hook.DeviceRule.
+type Input struct {
+	IncludeDevices []string `toml:"include_devices" yaml:"include_devices"` // capture only matching devices
+	ExcludeDevices []string `toml:"exclude_devices" yaml:"exclude_devices"` // never capture matching devices
+	Layout         string   `toml:"layout" yaml:"layout"`                   // built-in keyboard layout or path to a layout file
+	PhysicalKeys   bool     `toml:"physical_keys" yaml:"physical_keys"`     // also record keys by physical position
+	KeyCategories  bool     `toml:"key_categories" yaml:"key_categories"`   // record key categories instead of keys
+	Backend        string   `toml:"backend" yaml:"backend"`                 // auto, evdev or helper
+	HelperSocket   string   `toml:"helper_socket" yaml:"helper_socket"`     // socket of the input helper
+	HelperBinary   string   `toml:"helper_binary" yaml:"helper_binary"`     // busygraph binary to start as the input helper
+}
+
+// Input backends. With BackendAuto, the input helper is used if
+// input.helper_binary is set or a helper is listening, and the platform's
+// own capture otherwise.
+const (
+	BackendAuto   = "auto"
+	BackendEvdev  = "evdev"
+	BackendHelper = "helper"
+)
+
+// Default returns the built-in configuration.
+func Default() *Config {
+	dataDir, _ := tracker.DefaultDataDir()
+	return &Config{
+		Listen:        ":2112",
+		DataDir:       dataDir,
+		FlushInterval: 5 * time.Second,
+		PeerRefresh:   30 * time.Second,
+		DetectorPoll:  5 * time.Second,
+		RollupAfter:   48 * time.Hour,
+		MouseDPI:      96,
+		Features: Features{
+			VideoCalls: true,
+			Federation: true,
+			Metrics:    true,
+		},
+		Input: Input{
+			Layout:       "qwerty",
+			Backend:      BackendAuto,
+			HelperSocket: helper.DefaultSocket,
+		},
+	}
+}
+
+// setting is one configurable value, addressed by its file key. Nested keys
+// use dots; the environment variable and flag names are derived from it.
+type setting struct {
+	key   string
+	usage string
+	field func(c *Config) any
+}
+
+var settings = []setting{
+	{"listen", "Dashboard and metrics listen address", func(c *Config) any { return &c.Listen }},
+	{"data_dir", "Directory holding <hostname>.db and peer databases", func(c *Config) any { return &c.DataDir }},
+	{"flush_interval", "How often buffered input is written to the database", func(c *Config) any { return &c.FlushInterval }},
+	{"peer_refresh", "How often the data directory is scanned for peer databases", func(c *Config) any { return &c.PeerRefresh }},
+	{"detector_poll", "How often camera and microphone use is checked", func(c *Config) any { return &c.DetectorPoll }},
+	{"rollup_after", "Age after which minute data is folded into hourly and daily tables", func(c *Config) any { return &c.RollupAfter }},
+	{"raw_retention", "Age after which rolled-up minute data is deleted (0 keeps it forever)", func(c *Config) any { return &c.RawRetention }},
+	{"mouse_dpi", "Screen DPI used to convert mouse distance to meters", func(c *Config) any { return &c.MouseDPI }},
+	{"features.video_calls", "Detect video calls", func(c *Config) any { return &c.Features.VideoCalls }},
+	{"features.federation", "Include peer databases from the data directory", func(c *Config) any { return &c.Features.Federation }},
+	{"features.metrics", "Serve Prometheus metrics at /metrics", func(c *Config) any { return &c.Features.Metrics }},
+	{"features.shortcuts", "Record keys pressed with modifiers as shortcuts such as [CTRL]+c", func(c *Config) any { return &c.Features.Shortcuts }},
+	{"features.key_timing", "Record how long keys are held and how often they autorepeat, per key category", func(c *Config) any { return &c.Features.KeyTiming }},
+	{"input.include_devices", "Comma-separated device rules; only matching devices are captured", func(c *Config) any { return &c.Input.IncludeDevices }},
+	{"input.exclude_devices", "Comma-separated device rules; matching devices are never captured", func(c *Config) any { return &c.Input.ExcludeDevices }},
+	{"input.layout", "Keyboard layout (" + strings.Join(hook.LayoutNames(), ", ") + ") or path to a layout file", func(c *Config) any { return &c.Input.Layout }},
+	{"input.physical_keys", "Also record keys by their physical position, whatever the layout", func(c *Config) any { return &c.Input.PhysicalKeys }},
+	{"input.key_categories", "Record key presses by category (letter, digit, ...) instead of which key was pressed", func(c *Config) any { return &c.Input.KeyCategories }},
+	{"input.backend", "How input is captured: evdev (or the macOS event tap), helper (from 'busygraph input-helper'), or auto to use the helper if it is configured or running", func(c *Config) any { return &c.Input.Backend }},
+	{"input.helper_socket", "Unix socket of the input helper", func(c *Config) any { return &c.Input.HelperSocket }},
+	{"input.helper_binary", "busygraph binary to start and supervise as the input helper, instead of connecting to input.helper_socket", func(c *Config) any { return &c.Input.HelperBinary }},
+}
+
+// HelperKeys are the settings that shape what the input helper captures.
+// A helper started by BusyGraph is passed them in its environment.
+var HelperKeys = []string{
+	"mouse_dpi",
+	"features.shortcuts",
+	"features.key_timing",
+	"input.include_devices",
+	"input.exclude_devices",
+	"input.layout",
+	"input.physical_keys",
+	"input.key_categories",
+}
+
+// EnvName returns the environment variable overriding key, e.g.
+// BUSYGRAPH_FEATURES_VIDEO_CALLS for features.video_calls.
+func EnvName(key string) string {
+	return "BUSYGRAPH_" + strings.ToUpper(strings.NewReplacer(".", "_").Replace(key))
+}
+
+// flagName returns the flag overriding key, e.g. video-calls for
+// features.video_calls.
+func flagName(key string) string {
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		key = key[i+1:]
+	}
+	return strings.ReplaceAll(key, "_", "-")
+}
+
+// format is the inverse of set.
+func format(ptr any) string {
+	if list, ok := ptr.(*[]string); ok {
+		return strings.Join(*list, ",")
+	}
+	return fmt.Sprint(reflect.ValueOf(ptr).Elem().Interface())
+}
+
+// set parses s into the field behind ptr.
+func set(ptr any, s string) error {
+	switch p := ptr.(type) {
+	case *string:
+		*p = s
+	case *time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		*p = d
+	case *float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		*p = f
+	case *bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		*p = b
+	case *[]string:
+		*p = nil
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*p = append(*p, item)
+			}
+		}
+	default:
+		panic(fmt.Sprintf("config: unsupported field type %T", ptr))
+	}
+	return nil
+}
+
+// Flags holds the -config flag and any override flags registered on a
+// FlagSet, for Load to apply after parsing.
+type Flags struct {
+	path      string
+	overrides map[string]string
+}
+
+type overrideFlag struct {
+	key    string
+	def    string // shown by -h
+	f      *Flags
+	isBool bool
+}
+
+func (o overrideFlag) String() string { return o.def }
+
+func (o overrideFlag) Set(s string) error {
+	var probe Config
+	if err := set(settingFor(o.key).field(&probe), s); err != nil {
+		return err
+	}
+	o.f.overrides[o.key] = s
+	return nil
+}
+
+func (o overrideFlag) IsBoolFlag() bool { return o.isBool }
+
+func settingFor(key string) setting {
+	for _, s := range settings {
+		if s.key == key {
+			return s
+		}
+	}
+	panic("config: unknown setting " + key)
+}
+
+// BindFlags registers -config and override flags for the given setting keys
+// on fs, or for every setting if none are given.
+func BindFlags(fs *flag.FlagSet, keys ...string) *Flags {
+	f := &Flags{overrides: make(map[string]string)}
+	fs.StringVar(&f.path, "config", "", "Configuration file (default $XDG_CONFIG_HOME/busygraph/config.toml or config.yaml)")
+
+	if len(keys) == 0 {
+		for _, s := range settings {
+			keys = append(keys, s.key)
+		}
+	}
+	defaults := Default()
+	for _, key := range keys {
+		s := settingFor(key)
+		ptr := s.field(defaults)
+		_, isBool := ptr.(*bool)
+		def := format(ptr)
+		usage := fmt.Sprintf("%s (config %s, env %s)", s.usage, s.key, EnvName(s.key))
+		fs.Var(overrideFlag{key: key, def: def, f: f, isBool: isBool}, flagName(key), usage)
+	}
+	return f
+}
+
+// Load builds the configuration from the defaults, the configuration file,
+// the environment and the parsed flags, then validates it.
+func (f *Flags) Load() (*Config, error) {
+	c := Default()
+
+	path := f.path
+	explicit := path != ""
+	if !explicit {
+		path = os.Getenv("BUSYGRAPH_CONFIG")
+		explicit = path != ""
+	}
+	if !explicit {
+		path = findFile()
+	}
+	if path != "" {
+		if err := c.readFile(path); err != nil {
+			if explicit || !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+		} else {
+			c.Source = path
+		}
+	}
+
+	for _, s := range settings {
+		name := EnvName(s.key)
+		if v, ok := os.LookupEnv(name); ok {
+			if err := set(s.field(c), v); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	for key, v := range f.overrides {
+		set(settingFor(key).field(c), v) // already checked by overrideFlag.Set
+	}
+	if rest, ok := strings.CutPrefix(c.DataDir, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			c.DataDir = filepath.Join(home, rest)
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Dir returns the directory configuration files are looked up in.
+func Dir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "busygraph"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "busygraph"), nil
+}
+
+// findFile returns the first existing config file in Dir, or "".
+func findFile() string {
+	dir, err := Dir()
+	if err != nil {
+		return ""
+	}
+	for _, name := range []string{"config.toml", "config.yaml", "config.yml"} {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// readFile decodes a TOML or YAML file over c, rejecting unknown keys.
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".toml":
+		md, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("%s: unknown key %q", path, undecoded[0].String())
+		}
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(c); err != nil && err != io.EOF {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("%s: unsupported config format %q (want .toml or .yaml)", path, ext)
+	}
+	return nil
+}
+
+// Validate reports every invalid setting.
+func (c *Config) Validate() error {
+	var errs []error
+	if _, _, err := net.SplitHostPort(c.Listen); err != nil {
+		errs = append(errs, fmt.Errorf("listen: %q is not a host:port address", c.Listen))
+	}
+	if c.DataDir == "" {
+		errs = append(errs, errors.New("data_dir: must be set"))
+	}
+	for _, d := range []struct {
+		key string
+		v   time.Duration
+	}{
+		{"flush_interval", c.FlushInterval},
+		{"peer_refresh", c.PeerRefresh},
+		{"detector_poll", c.DetectorPoll},
+		{"rollup_after", c.RollupAfter},
+	} {
+		if d.v <= 0 {
+			errs = append(errs, fmt.Errorf("%s: must be positive, got %s", d.key, d.v))
+		}
+	}
+	if c.RawRetention < 0 {
+		errs = append(errs, fmt.Errorf("raw_retention: must not be negative, got %s", c.RawRetention))
+	}
+	if c.MouseDPI <= 0 {
+		errs = append(errs, fmt.Errorf("mouse_dpi: must be positive, got %g", c.MouseDPI))
+	}
+	if _, err := hook.ParseDeviceRules(c.Input.IncludeDevices, c.Input.ExcludeDevices); err != nil {
+		errs = append(errs, fmt.Errorf("input: %w", err))
+	}
+	if _, err := hook.LoadLayout(c.Input.Layout); err != nil {
+		errs = append(errs, fmt.Errorf("input.layout: %w", err))
+	}
+	switch c.Input.Backend {
+	case BackendAuto, BackendEvdev, BackendHelper:
+	default:
+		errs = append(errs, fmt.Errorf("input.backend: %q is not one of %s, %s or %s", c.Input.Backend, BackendAuto, BackendEvdev, BackendHelper))
+	}
+	if c.Input.Backend != BackendEvdev && c.Input.HelperSocket == "" {
+		errs = append(errs, errors.New("input.helper_socket: must be set"))
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	err := errors.Join(errs...)
+	if c.Source != "" {
+		return fmt.Errorf("invalid configuration (%s):\n%w", c.Source, err)
+	}
+	return fmt.Errorf("invalid configuration:\n%w", err)
+}
+
+// DashboardURL returns the base URL of the dashboard served on Listen.
+func (c *Config) DashboardURL() string {
+	host, port, err := net.SplitHostPort(c.Listen)
+	if err != nil {
+		return "http://localhost:2112"
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// TrackerOptions returns the tracker options implied by the configuration.
+func (c *Config) TrackerOptions() []tracker.Option {
+	opts := []tracker.Option{
+		tracker.WithDataDir(c.DataDir),
+		tracker.WithFlushInterval(c.FlushInterval),
+		tracker.WithPeerRefresh(c.PeerRefresh),
+		tracker.WithRollupAfter(c.RollupAfter),
+		tracker.WithRawRetention(c.RawRetention),
+	}
+	if !c.Features.Federation {
+		opts = append(opts, tracker.WithoutPeers())
+	}
+	return opts
+}
+
+// HookOptions returns the input hook options implied by the configuration,
+// which Validate has checked.
+func (c *Config) HookOptions() hook.Options {
+	rules, _ := hook.ParseDeviceRules(c.Input.IncludeDevices, c.Input.ExcludeDevices)
+	layout, _ := hook.LoadLayout(c.Input.Layout)
+	return hook.Options{
+		Devices:       rules,
+		MouseDPI:      c.MouseDPI,
+		Shortcuts:     c.Features.Shortcuts,
+		KeyTiming:     c.Features.KeyTiming,
+		Layout:        layout,
+		PhysicalKeys:  c.Input.PhysicalKeys,
+		KeyCategories: c.Input.KeyCategories,
+	}
+}
+
+// HelperEnv returns the environment variables passing the HelperKeys
+// settings to an input helper.
+func (c *Config) HelperEnv() []string {
+	var env []string
+	for _, key := range HelperKeys {
+		env = append(env, EnvName(key)+"="+format(settingFor(key).field(c)))
+	}
+	return env
+}
+
+// Write encodes c as TOML or YAML ("toml" or "yaml").
+func (c *Config) Write(w io.Writer, format string) error {
+	switch format {
+	case "toml":
+		return toml.NewEncoder(w).Encode(c)
+	case "yaml":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(c); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+	return fmt.Errorf("unknown format %q (want toml or yaml)", format)
+}
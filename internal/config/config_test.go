@@ -0,0 +1,198 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	path := filepath.Join(dir, "busygraph", name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func load(t *testing.T, args ...string) (*Config, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	f := BindFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("parse %v: %v", args, err)
+	}
+	return f.Load()
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfig(t, "config.toml", `
+listen = "127.0.0.1:9000"
+flush_interval = "10s"
+mouse_dpi = 110
+
+[features]
+video_calls = false
+`)
+	t.Setenv(EnvName("flush_interval"), "20s")
+	t.Setenv(EnvName("peer_refresh"), "1m")
+
+	cfg, err := load(t, "-peer-refresh", "2m", "-video-calls")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Source != path {
+		t.Fatalf("Source = %q, want %q", cfg.Source, path)
+	}
+	if cfg.Listen != "127.0.0.1:9000" || cfg.MouseDPI != 110 {
+		t.Fatalf("file values not applied: %+v", cfg)
+	}
+	if cfg.FlushInterval != 20*time.Second {
+		t.Fatalf("flush_interval = %s, want env value 20s", cfg.FlushInterval)
+	}
+	if cfg.PeerRefresh != 2*time.Minute || !cfg.Features.VideoCalls {
+		t.Fatalf("flags not applied: peer_refresh %s, video_calls %v", cfg.PeerRefresh, cfg.Features.VideoCalls)
+	}
+	if cfg.DetectorPoll != 5*time.Second || !cfg.Features.Metrics {
+		t.Fatalf("defaults lost: %+v", cfg)
+	}
+	if got := cfg.DashboardURL(); got != "http://127.0.0.1:9000" {
+		t.Fatalf("DashboardURL = %q", got)
+	}
+}
+
+func TestLoadYAML(t *testing.T) {
+	writeConfig(t, "config.yaml", "listen: \":8080\"\ndata_dir: ~/busygraph\nfeatures:\n  federation: false\n")
+	t.Setenv("HOME", "/home/me")
+
+	cfg, err := load(t)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Listen != ":8080" || cfg.DataDir != "/home/me/busygraph" || cfg.Features.Federation {
+		t.Fatalf("yaml values not applied: %+v", cfg)
+	}
+	if got := cfg.DashboardURL(); got != "http://localhost:8080" {
+		t.Fatalf("DashboardURL = %q", got)
+	}
+}
+
+func TestLoadRejectsInvalidConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name, file, content string
+		want                []string
+	}{
+		{"unknown key", "config.toml", `lisen = ":1"`, []string{`unknown key "lisen"`}},
+		{"unknown yaml key", "config.yaml", "features:\n  videocalls: true\n", []string{"videocalls"}},
+		{"bad duration", "config.toml", `flush_interval = "soon"`, []string{"flush_interval"}},
+		{"invalid values", "config.toml", "listen = \"2112\"\nflush_interval = \"-1s\"\nmouse_dpi = 0\n",
+			[]string{"listen:", "flush_interval: must be positive", "mouse_dpi: must be positive"}},
+		{"bad device rule", "config.toml", "[input]\nexclude_devices = [\"id:nope\"]\n", []string{"input:", `"id:nope"`}},
+		{"unknown layout", "config.toml", "[input]\nlayout = \"bepo\"\n", []string{"input.layout:", `"bepo"`}},
+		{"unknown backend", "config.toml", "[input]\nbackend = \"portal\"\n", []string{"input.backend:", `"portal"`}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			writeConfig(t, tc.file, tc.content)
+			_, err := load(t)
+			if err == nil {
+				t.Fatal("Load succeeded")
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Fatalf("error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDeviceRuleLists(t *testing.T) {
+	writeConfig(t, "config.toml", `
+[input]
+include_devices = ["name:*Keychron*", "id:046d"]
+exclude_devices = ["name:*YubiKey*"]
+`)
+	t.Setenv(EnvName("input.exclude_devices"), "id:1050, phys:usb-*/input1,")
+
+	cfg, err := load(t)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := strings.Join(cfg.Input.IncludeDevices, " "); got != "name:*Keychron* id:046d" {
+		t.Fatalf("include_devices = %q", got)
+	}
+	if got := strings.Join(cfg.Input.ExcludeDevices, " "); got != "id:1050 phys:usb-*/input1" {
+		t.Fatalf("exclude_devices = %q, want env value split on commas", got)
+	}
+	if rules := cfg.HookOptions().Devices; len(rules.Include) != 2 || len(rules.Exclude) != 2 {
+		t.Fatalf("hook rules = %+v", rules)
+	}
+}
+
+func TestBadEnvAndFlagValues(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	t.Setenv(EnvName("mouse_dpi"), "lots")
+	if _, err := load(t); err == nil || !strings.Contains(err.Error(), "BUSYGRAPH_MOUSE_DPI") {
+		t.Fatalf("Load error = %v, want env variable named", err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(new(strings.Builder))
+	BindFlags(fs, "flush_interval")
+	if err := fs.Parse([]string{"-flush-interval", "often"}); err == nil {
+		t.Fatal("flag parse accepted an invalid duration")
+	}
+}
+
+func TestMissingExplicitConfig(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if _, err := load(t, "-config", filepath.Join(t.TempDir(), "nope.toml")); err == nil {
+		t.Fatal("Load succeeded with a missing -config file")
+	}
+	if _, err := load(t); err != nil {
+		t.Fatalf("Load without any config file: %v", err)
+	}
+}
+
+func TestHelperEnv(t *testing.T) {
+	writeConfig(t, "config.toml", `
+mouse_dpi = 120
+[features]
+shortcuts = true
+[input]
+exclude_devices = ["name:*YubiKey*", "id:1050"]
+layout = "dvorak"
+key_categories = true
+`)
+	cfg, err := load(t)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	// A helper without the config file gets the same settings from the
+	// environment.
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	for _, kv := range cfg.HelperEnv() {
+		k, v, _ := strings.Cut(kv, "=")
+		t.Setenv(k, v)
+	}
+	got, err := load(t)
+	if err != nil {
+		t.Fatalf("Load with helper env: %v", err)
+	}
+	if got.MouseDPI != 120 || !got.Features.Shortcuts || got.Input.Layout != "dvorak" || !got.Input.KeyCategories {
+		t.Errorf("helper config = %+v", got)
+	}
+	if strings.Join(got.Input.ExcludeDevices, " ") != "name:*YubiKey* id:1050" {
+		t.Errorf("helper exclude_devices = %q", got.Input.ExcludeDevices)
+	}
+}
@@ -0,0 +1,401 @@
+// Package helper moves input capture into a separate process. The input
+// helper is the only part of BusyGraph that needs read access to input
+// devices. It runs the hook's processor and aggregates input into
+// per-minute counts itself, and sends BusyGraph only those counts, so a
+// compromise of BusyGraph, through its web server say, cannot log
+// keystrokes.
+//
+// The helper either listens on a Unix socket that only one user may connect
+// to (Listen and Serve), or is started by BusyGraph with one end of a socket
+// pair (Spawn and ServeConn), in which case BusyGraph restarts it when it
+// exits. Either way it sends one JSON message per line and reads nothing.
+package helper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/victortrac/busygraph/internal/hook"
+	"github.com/victortrac/busygraph/internal/input"
+	"github.com/victortrac/busygraph/internal/tracker"
+)
+
+// DefaultSocket is where the helper listens unless configured otherwise; a
+// systemd unit with RuntimeDirectory=busygraph creates its directory.
+const DefaultSocket = "/run/busygraph/input.sock"
+
+// SendInterval is how often the helper sends counts, on the minute. Counts
+// are never sent in between, not even when a client connects or goes away,
+// so when they arrive says nothing about individual keystrokes. Counts not
+// yet sent when the helper stops are dropped.
+const SendInterval = time.Minute
+
+// statusInterval is how often the helper sends its capture status between
+// counts.
+const statusInterval = 5 * time.Second
+
+// writeTimeout bounds how long a client that does not read can hold up the
+// helper.
+const writeTimeout = 10 * time.Second
+
+// message is what the helper sends: its capture status and, every
+// SendInterval, the counts since the counts were last sent.
+type message struct {
+	Status input.Status    `json:"status"`
+	Counts *tracker.Counts `json:"counts,omitempty"`
+}
+
+// Server captures input from a source and sends per-minute counts of it to
+// one client at a time; a new connection replaces the previous one. Counts
+// taken while no client is connected are kept for the next one.
+type Server struct {
+	src         input.Source
+	sink        input.Sink
+	buf         *tracker.Buffer
+	allowUID    int
+	countsEvery time.Duration
+	statusEvery time.Duration
+
+	mu     sync.Mutex
+	conn   net.Conn
+	closed bool
+}
+
+// NewServer returns a server for the input of src, processed according to
+// o, that accepts connections only from processes running as allowUID.
+func NewServer(src input.Source, o hook.Options, allowUID int) *Server {
+	buf := tracker.NewBuffer(nil)
+	return &Server{
+		src:         src,
+		sink:        hook.NewProcessor(buf, o),
+		buf:         buf,
+		allowUID:    allowUID,
+		countsEvery: SendInterval,
+		statusEvery: statusInterval,
+	}
+}
+
+// Listen creates the socket at path, replacing a stale one. Anyone may
+// connect to it, but the server drops connections from other users.
+func Listen(path string) (net.Listener, error) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o666); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// Serve runs the input source and accepts clients on ln until the source
+// stops or Close is called. It returns the source's error, if any, or nil
+// after Close.
+func (s *Server) Serve(ln net.Listener) error {
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			uid, err := peerUID(conn)
+			if err != nil || uid != s.allowUID {
+				if err == nil {
+					err = fmt.Errorf("uid %d is not allowed", uid)
+				}
+				log.Printf("Refusing input helper client: %v", err)
+				conn.Close()
+				continue
+			}
+			log.Printf("Input helper client connected (uid %d)", uid)
+			s.setConn(conn)
+			go s.watch(conn)
+		}
+	}()
+	return s.run()
+}
+
+// ServeConn runs the input source and sends counts on conn, the connection
+// to the BusyGraph that started the helper, until the source stops or
+// BusyGraph closes the connection. It returns the source's error, if any.
+// Like Serve, it refuses a connection from a user other than the allowed
+// one, without capturing any input.
+func (s *Server) ServeConn(conn net.Conn) error {
+	uid, err := peerUID(conn)
+	if err == nil && uid != s.allowUID {
+		err = fmt.Errorf("uid %d is not allowed", uid)
+	}
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("refusing input helper client: %w", err)
+	}
+	s.setConn(conn)
+	go func() {
+		s.watch(conn)
+		s.Close()
+	}()
+	return s.run()
+}
+
+// Close stops the input source, which makes Serve and ServeConn return.
+// Counts not yet sent are lost.
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.src.Stop()
+}
+
+// run runs the source, sending counts and status as due, until it stops.
+func (s *Server) run() error {
+	srcErr := make(chan error, 1)
+	go func() { srcErr <- s.src.Run(s.sink) }()
+
+	next := time.NewTimer(s.untilNext())
+	defer next.Stop()
+	status := time.NewTicker(s.statusEvery)
+	defer status.Stop()
+	for {
+		select {
+		case <-next.C:
+			s.send(true)
+			next.Reset(s.untilNext())
+		case <-status.C:
+			s.send(false)
+		case err := <-srcErr:
+			return s.hangUp(err)
+		}
+	}
+}
+
+// hangUp disconnects the client once the source has stopped with err,
+// telling it why unless Close was called, and returns the error.
+func (s *Server) hangUp(err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		err = nil
+	} else if err == nil {
+		err = errors.New("input capture stopped")
+	}
+	if s.conn == nil {
+		return err
+	}
+	if err != nil {
+		s.writeLocked(message{Status: input.Status{Error: err.Error()}})
+	}
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+// untilNext returns the time to the next multiple of countsEvery.
+func (s *Server) untilNext() time.Duration {
+	now := time.Now()
+	return now.Truncate(s.countsEvery).Add(s.countsEvery).Sub(now)
+}
+
+// status returns the source's status, if it reports one.
+func (s *Server) status() input.Status {
+	if r, ok := s.src.(interface{ Status() input.Status }); ok {
+		return r.Status()
+	}
+	return input.Status{Capturing: true}
+}
+
+// send sends the capture status to the client and, with counts, the counts
+// taken since they were last sent. Counts are kept for the next client if
+// there is none.
+func (s *Server) send(counts bool) {
+	m := message{Status: s.status()}
+	var c tracker.Counts
+	if counts {
+		c = s.buf.Take()
+		if !c.Empty() {
+			m.Counts = &c
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil || !s.writeLocked(m) {
+		s.buf.Add(c)
+	}
+}
+
+// setConn makes conn the client, disconnecting the previous one.
+func (s *Server) setConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.conn = conn
+}
+
+// writeLocked sends m to the client, dropping the client if that fails. The
+// caller holds mu.
+func (s *Server) writeLocked(m message) bool {
+	s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err := json.NewEncoder(s.conn).Encode(m); err != nil {
+		log.Printf("Input helper client disconnected: %v", err)
+		s.conn.Close()
+		s.conn = nil
+		return false
+	}
+	return true
+}
+
+// watch waits for the client to close conn. Clients send nothing.
+func (s *Server) watch(conn net.Conn) {
+	io.Copy(io.Discard, conn)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == conn {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// Counter takes the counts an input helper sends. *tracker.Tracker is one.
+type Counter interface {
+	AddCounts(tracker.Counts)
+}
+
+// Source receives counts from an input helper, either one listening on a
+// socket (NewSource) or one it starts itself (Spawn). It is an input.Source
+// so that BusyGraph can run it in place of the platform's hook, but no
+// events reach the sink passed to Run: the helper sends only counts, and
+// they go to the Counter.
+type Source struct {
+	desc    string // which helper, for messages
+	connect func() (net.Conn, *exec.Cmd, error)
+	dst     Counter
+
+	mu      sync.Mutex
+	conn    net.Conn
+	status  input.Status // as last reported by the helper
+	heard   bool         // whether the helper has reported its status
+	stopped bool
+}
+
+// NewSource returns a source reading counts from the helper listening at
+// path into dst.
+func NewSource(path string, dst Counter) *Source {
+	return &Source{
+		desc: "the input helper at " + path,
+		dst:  dst,
+		connect: func() (net.Conn, *exec.Cmd, error) {
+			conn, err := net.DialTimeout("unix", path, 5*time.Second)
+			return conn, nil, err
+		},
+	}
+}
+
+// Reachable reports whether a helper is listening at path.
+func Reachable(path string) bool {
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// Run connects to the helper, starting it first if the source was made by
+// Spawn, and adds the counts it sends to the Counter until Stop is called.
+// It returns an error if the helper cannot be reached, stops capturing or
+// goes away.
+func (s *Source) Run(input.Sink) error {
+	conn, cmd, err := s.connect()
+	if err != nil {
+		return fmt.Errorf("connecting to %s: %w", s.desc, err)
+	}
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		conn.Close()
+		wait(cmd)
+		return nil
+	}
+	s.conn = conn
+	s.status, s.heard = input.Status{Error: "waiting for " + s.desc}, false
+	s.mu.Unlock()
+	log.Printf("Reading input counts from %s", s.desc)
+
+	err = s.read(conn)
+	conn.Close()
+	if exitErr := wait(cmd); exitErr != nil && err == nil {
+		err = exitErr
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conn = nil
+	if s.stopped {
+		return nil
+	}
+	if s.heard && s.status.Error != "" {
+		return fmt.Errorf("%s: %s", s.desc, s.status.Error)
+	}
+	if err == nil {
+		err = errors.New("connection closed")
+	}
+	return fmt.Errorf("%s: %w", s.desc, err)
+}
+
+// read handles the helper's messages until the connection closes.
+func (s *Source) read(conn net.Conn) error {
+	dec := json.NewDecoder(conn)
+	for {
+		var m message
+		if err := dec.Decode(&m); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		s.mu.Lock()
+		s.status, s.heard = m.Status, true
+		s.mu.Unlock()
+		if m.Counts != nil {
+			s.dst.AddCounts(*m.Counts)
+		}
+	}
+}
+
+// Stop disconnects from the helper, which makes Run return. A helper the
+// source started exits when it is disconnected.
+func (s *Source) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+// Status reports the helper's capture status as it last sent it.
+func (s *Source) Status() input.Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return input.Status{Error: "not connected to " + s.desc}
+	}
+	return s.status
+}
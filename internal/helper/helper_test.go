@@ -0,0 +1,243 @@
+package helper
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/victortrac/busygraph/internal/hook"
+	"github.com/victortrac/busygraph/internal/input"
+	"github.com/victortrac/busygraph/internal/tracker"
+)
+
+// TestMain runs the test binary as an input helper when Spawn starts it.
+func TestMain(m *testing.M) {
+	if mode := os.Getenv("BUSYGRAPH_TEST_HELPER"); mode != "" {
+		os.Exit(runTestHelper(mode))
+	}
+	os.Exit(m.Run())
+}
+
+// runTestHelper serves two key presses on the inherited socket, or fails to
+// capture if mode is "fail". In mode "hold" counts are due only after an
+// hour.
+func runTestHelper(mode string) int {
+	conn, err := net.FileConn(os.NewFile(3, "socket"))
+	if err != nil {
+		return 2
+	}
+	src := newFeedSource()
+	if mode == "fail" {
+		src.err = errors.New("no usable input devices found")
+		src.Stop()
+	}
+	srv := NewServer(src, hook.Options{}, os.Getuid())
+	srv.countsEvery, srv.statusEvery = 20*time.Millisecond, 10*time.Millisecond
+	if mode == "hold" {
+		srv.countsEvery = time.Hour
+	}
+	for code, key := range map[uint16]string{30: "a", 48: "b"} {
+		srv.sink.HandleEvent(input.Event{Time: time.Now(), Device: "kbd", Kind: input.KeyDown, Code: code, Key: key})
+	}
+	if err := srv.ServeConn(conn); err != nil {
+		return 1
+	}
+	return 0
+}
+
+// feedSource is an input source emitting the events sent to feed.
+type feedSource struct {
+	feed chan input.Event
+	stop chan struct{}
+	once sync.Once
+	err  error // returned by Run
+}
+
+func newFeedSource() *feedSource {
+	return &feedSource{feed: make(chan input.Event), stop: make(chan struct{})}
+}
+
+func (f *feedSource) Run(sink input.Sink) error {
+	for {
+		select {
+		case ev := <-f.feed:
+			sink.HandleEvent(ev)
+		case <-f.stop:
+			return f.err
+		}
+	}
+}
+
+func (f *feedSource) Stop() { f.once.Do(func() { close(f.stop) }) }
+
+// counter collects the counts a helper sends.
+type counter struct {
+	mu   sync.Mutex
+	keys map[string]int
+}
+
+func (c *counter) AddCounts(counts tracker.Counts) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.keys == nil {
+		c.keys = make(map[string]int)
+	}
+	for _, k := range counts.Keys {
+		c.keys[k.Key] += k.Count
+	}
+}
+
+func (c *counter) count(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.keys[key]
+}
+
+// waitFor polls cond until it holds, failing the test after 5s.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// serve starts srv on a fresh socket and returns the socket path and the
+// channel Serve's result is sent to.
+func serve(t *testing.T, srv *Server) (string, chan error) {
+	t.Helper()
+	// Socket paths are limited to about 100 bytes; t.TempDir can be longer.
+	dir, err := os.MkdirTemp("", "busygraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "input.sock")
+
+	ln, err := Listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ln) }()
+	return path, done
+}
+
+func TestHelperSendsCounts(t *testing.T) {
+	src := newFeedSource()
+	srv := NewServer(src, hook.Options{KeyCategories: true}, os.Getuid())
+	srv.countsEvery, srv.statusEvery = 50*time.Millisecond, 10*time.Millisecond
+	path, served := serve(t, srv)
+
+	if !Reachable(path) {
+		t.Fatal("helper socket is not reachable")
+	}
+
+	// Input captured before the client connects is kept for it.
+	at := time.Now()
+	src.feed <- input.Event{Time: at, Device: "kbd", Kind: input.KeyDown, Code: 30, Key: "a"}
+
+	var c counter
+	client := NewSource(path, &c)
+	ran := make(chan error, 1)
+	go func() { ran <- client.Run(nil) }()
+	waitFor(t, "the helper's status", func() bool { return client.Status().Capturing })
+
+	src.feed <- input.Event{Time: at.Add(100 * time.Millisecond), Device: "kbd", Kind: input.KeyDown, Code: 2, Key: "1"}
+	waitFor(t, "counts", func() bool { return c.count("[LETTER]") == 1 && c.count("[DIGIT]") == 1 })
+	if c.count("a") != 0 || c.count("1") != 0 {
+		t.Errorf("keys were sent despite KeyCategories: %v", c.keys)
+	}
+
+	client.Stop()
+	if err := <-ran; err != nil {
+		t.Errorf("client Run after Stop = %v, want nil", err)
+	}
+	srv.Close()
+	if err := <-served; err != nil {
+		t.Errorf("Serve after Close = %v, want nil", err)
+	}
+}
+
+func TestHelperRefusesOtherUsers(t *testing.T) {
+	srv := NewServer(newFeedSource(), hook.Options{}, os.Getuid()+1)
+	path, served := serve(t, srv)
+
+	if err := NewSource(path, new(counter)).Run(nil); err == nil {
+		t.Error("a client of another user was served")
+	}
+	srv.Close()
+	<-served
+}
+
+func TestServeConnRefusesOtherUsers(t *testing.T) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conns [2]net.Conn
+	for i, fd := range fds {
+		f := os.NewFile(uintptr(fd), "socket")
+		conns[i], err = net.FileConn(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer conns[1].Close()
+
+	src := newFeedSource()
+	srv := NewServer(src, hook.Options{}, os.Getuid()+1)
+	if err := srv.ServeConn(conns[0]); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("ServeConn = %v, want the peer refused", err)
+	}
+}
+
+func TestSpawn(t *testing.T) {
+	var c counter
+	src := Spawn(os.Args[0], []string{"BUSYGRAPH_TEST_HELPER=serve"}, &c)
+	ran := make(chan error, 1)
+	go func() { ran <- src.Run(nil) }()
+	waitFor(t, "counts from the helper", func() bool { return c.count("a") == 1 && c.count("b") == 1 })
+
+	// The helper exits once it is disconnected.
+	src.Stop()
+	if err := <-ran; err != nil {
+		t.Fatalf("Run after Stop = %v, want nil", err)
+	}
+}
+
+func TestSpawnSendsNoCountsEarly(t *testing.T) {
+	var c counter
+	src := Spawn(os.Args[0], []string{"BUSYGRAPH_TEST_HELPER=hold"}, &c)
+	ran := make(chan error, 1)
+	go func() { ran <- src.Run(nil) }()
+	waitFor(t, "the helper's status", func() bool { return src.Status().Capturing })
+
+	// Disconnecting must not make the helper send counts before they are
+	// due, or restarting it would time each keystroke.
+	src.Stop()
+	if err := <-ran; err != nil {
+		t.Fatalf("Run after Stop = %v, want nil", err)
+	}
+	if c.count("a") != 0 || c.count("b") != 0 {
+		t.Errorf("counts sent before the interval: %v", c.keys)
+	}
+}
+
+func TestSpawnedHelperFailure(t *testing.T) {
+	src := Spawn(os.Args[0], []string{"BUSYGRAPH_TEST_HELPER=fail"}, new(counter))
+	err := src.Run(nil)
+	if err == nil || !strings.Contains(err.Error(), "no usable input devices found") {
+		t.Errorf("Run = %v, want the helper's capture error", err)
+	}
+}
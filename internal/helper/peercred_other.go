@@ -0,0 +1,13 @@
+//go:build !linux
+
+package helper
+
+import (
+	"errors"
+	"net"
+)
+
+// peerUID is only implemented on Linux, where the helper is supported.
+func peerUID(conn net.Conn) (int, error) {
+	return 0, errors.New("checking socket peers is only supported on Linux")
+}
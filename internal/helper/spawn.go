@@ -0,0 +1,74 @@
+package helper
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// Spawn returns a source that, each time it is run, starts binary as
+// `binary input-helper -fd 3` with env added to its environment and reads
+// counts from a socket pair shared with it into dst. Run returns when the
+// helper exits, so running the source again restarts it; the helper exits
+// when the source is stopped.
+func Spawn(binary string, env []string, dst Counter) *Source {
+	return &Source{
+		desc: "the input helper " + binary,
+		dst:  dst,
+		connect: func() (net.Conn, *exec.Cmd, error) {
+			return spawn(binary, env)
+		},
+	}
+}
+
+func spawn(binary string, env []string) (net.Conn, *exec.Cmd, error) {
+	// Like package net, hold ForkLock so no other child inherits the
+	// sockets before they are marked close-on-exec.
+	syscall.ForkLock.RLock()
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err == nil {
+		syscall.CloseOnExec(fds[0])
+		syscall.CloseOnExec(fds[1])
+	}
+	syscall.ForkLock.RUnlock()
+	if err != nil {
+		return nil, nil, os.NewSyscallError("socketpair", err)
+	}
+	ours := os.NewFile(uintptr(fds[0]), "input helper socket")
+	theirs := os.NewFile(uintptr(fds[1]), "input helper socket")
+	defer ours.Close()
+	defer theirs.Close()
+
+	conn, err := net.FileConn(ours)
+	if err != nil {
+		return nil, nil, err
+	}
+	cmd := exec.Command(binary, "input-helper", "-fd", "3")
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{theirs} // fd 3
+	if err := cmd.Start(); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, cmd, nil
+}
+
+// wait waits for a helper started by spawn, whose connection has been
+// closed, to exit, killing it if it has not within a few seconds.
+func wait(cmd *exec.Cmd) error {
+	if cmd == nil {
+		return nil
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		cmd.Process.Kill()
+		return <-done
+	}
+}
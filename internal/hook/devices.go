@@ -0,0 +1,182 @@
+package hook
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Options configures input capture.
+type Options struct {
+	// Devices limits which input devices are captured. Hooks that cannot
+	// tell devices apart (macOS) ignore it.
+	Devices DeviceRules
+	// MouseDPI converts touchpad and tablet movement, which the kernel
+	// reports in millimetres, to the pixels the tracker counts. Defaults to
+	// 96.
+	MouseDPI float64
+	// Shortcuts records keys pressed while Ctrl, Alt, Meta (Cmd/Super) or,
+	// for non-text keys, Shift are held as chords like "[CTRL]+c" instead of
+	// the bare key.
+	Shortcuts bool
+	// KeyTiming records how long keys are held and how often they
+	// autorepeat, per key category (letter, deletion, navigation, ...).
+	KeyTiming bool
+	// Layout translates keys to what they type. Nil records keys as on a
+	// US keyboard.
+	Layout *Layout
+	// PhysicalKeys also records each key press by its position on a US
+	// keyboard, whatever the layout.
+	PhysicalKeys bool
+	// KeyCategories records key presses by category, as "[LETTER]",
+	// "[DIGIT]" and so on, instead of which key was pressed. It overrides
+	// Shortcuts.
+	KeyCategories bool
+}
+
+// DeviceInfo identifies an input device for matching against DeviceRules.
+type DeviceInfo struct {
+	Path    string `json:"path"`
+	Name    string `json:"name"`
+	Phys    string `json:"phys"`    // physical path, e.g. usb-0000:00:14.0-2/input0
+	Vendor  uint16 `json:"vendor"`  // USB/Bluetooth vendor ID
+	Product uint16 `json:"product"` // USB/Bluetooth product ID
+}
+
+// ID returns the vendor and product ID as "vvvv:pppp".
+func (d DeviceInfo) ID() string {
+	return fmt.Sprintf("%04x:%04x", d.Vendor, d.Product)
+}
+
+// DeviceRule matches devices by name, vendor/product ID or physical path.
+// Rules are written as
+//
+//	name:<glob>           device name, e.g. name:*YubiKey*
+//	id:<vendor>[:<product>]  hex IDs, e.g. id:1050 or id:046d:c52b
+//	phys:<glob>           physical path, e.g. phys:usb-0000:00:14.0-3/*
+//
+// A rule without a prefix is a name glob. Globs are case-insensitive and
+// support * and ?.
+type DeviceRule struct {
+	text    string
+	field   string // name, id or phys
+	glob    *regexp.Regexp
+	vendor  uint16
+	product uint16
+	anyProd bool
+}
+
+// ParseDeviceRule parses one rule.
+func ParseDeviceRule(s string) (DeviceRule, error) {
+	r := DeviceRule{text: s, field: "name"}
+	pattern := s
+	if field, rest, ok := strings.Cut(s, ":"); ok {
+		switch field {
+		case "name", "id", "phys":
+			r.field, pattern = field, rest
+		}
+	}
+	if pattern == "" {
+		return r, fmt.Errorf("device rule %q: empty pattern", s)
+	}
+
+	if r.field == "id" {
+		vendor, product, hasProduct := strings.Cut(pattern, ":")
+		v, err := strconv.ParseUint(vendor, 16, 16)
+		if err != nil {
+			return r, fmt.Errorf("device rule %q: vendor ID %q is not a 4-digit hex number", s, vendor)
+		}
+		r.vendor = uint16(v)
+		if !hasProduct || product == "*" {
+			r.anyProd = true
+			return r, nil
+		}
+		p, err := strconv.ParseUint(product, 16, 16)
+		if err != nil {
+			return r, fmt.Errorf("device rule %q: product ID %q is not a 4-digit hex number", s, product)
+		}
+		r.product = uint16(p)
+		return r, nil
+	}
+
+	re := regexp.QuoteMeta(pattern)
+	re = strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(re)
+	r.glob = regexp.MustCompile("(?i)^" + re + "$")
+	return r, nil
+}
+
+// String returns the rule as written.
+func (r DeviceRule) String() string { return r.text }
+
+// Match reports whether d matches the rule.
+func (r DeviceRule) Match(d DeviceInfo) bool {
+	switch r.field {
+	case "id":
+		return d.Vendor == r.vendor && (r.anyProd || d.Product == r.product)
+	case "phys":
+		return r.glob.MatchString(d.Phys)
+	default:
+		return r.glob.MatchString(d.Name)
+	}
+}
+
+// DeviceRules decides which devices are captured. With no include rules
+// every keyboard and mouse is captured; otherwise only devices matching one
+// of them are. Exclude rules always win.
+type DeviceRules struct {
+	Include []DeviceRule
+	Exclude []DeviceRule
+}
+
+// ParseDeviceRules parses include and exclude rules, reporting every invalid
+// one.
+func ParseDeviceRules(include, exclude []string) (DeviceRules, error) {
+	var rules DeviceRules
+	var errs []error
+	for _, s := range include {
+		r, err := ParseDeviceRule(s)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		rules.Include = append(rules.Include, r)
+	}
+	for _, s := range exclude {
+		r, err := ParseDeviceRule(s)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		rules.Exclude = append(rules.Exclude, r)
+	}
+	return rules, errors.Join(errs...)
+}
+
+// Check reports whether d may be captured and, if not, why.
+func (rs DeviceRules) Check(d DeviceInfo) (ok bool, reason string) {
+	for _, r := range rs.Exclude {
+		if r.Match(d) {
+			return false, "excluded by " + r.String()
+		}
+	}
+	if len(rs.Include) == 0 {
+		return true, ""
+	}
+	for _, r := range rs.Include {
+		if r.Match(d) {
+			return true, ""
+		}
+	}
+	return false, "not included"
+}
+
+// DeviceReport describes a detected input device and what Start would do
+// with it.
+type DeviceReport struct {
+	DeviceInfo
+	Kind    string `json:"kind"`    // keyboard, mouse, touchpad, keyboard+mouse… or "" for none
+	Tracked bool   `json:"tracked"` // Start would capture it
+	Reason  string `json:"reason"`  // why it is not tracked
+}
@@ -0,0 +1,48 @@
+package hook
+
+import "testing"
+
+func TestDeviceRules(t *testing.T) {
+	rules, err := ParseDeviceRules(
+		[]string{"name:*keyboard*", "id:046d", "phys:usb-0000:00:14.0-3/*"},
+		[]string{"*YubiKey*", "id:046d:c548"},
+	)
+	if err != nil {
+		t.Fatalf("ParseDeviceRules: %v", err)
+	}
+
+	for _, tc := range []struct {
+		dev    DeviceInfo
+		ok     bool
+		reason string
+	}{
+		{DeviceInfo{Name: "AT Translated Set 2 keyboard"}, true, ""},
+		{DeviceInfo{Name: "Logitech MX Master 3", Vendor: 0x046d, Product: 0x4082}, true, ""},
+		{DeviceInfo{Name: "Logitech USB Receiver", Vendor: 0x046d, Product: 0xc548}, false, "excluded by id:046d:c548"},
+		{DeviceInfo{Name: "Macro Pad", Phys: "usb-0000:00:14.0-3/input0"}, true, ""},
+		{DeviceInfo{Name: "Yubico YubiKey OTP+FIDO+CCID Keyboard"}, false, "excluded by *YubiKey*"},
+		{DeviceInfo{Name: "xrdp virtual mouse"}, false, "not included"},
+	} {
+		ok, reason := rules.Check(tc.dev)
+		if ok != tc.ok || reason != tc.reason {
+			t.Errorf("Check(%q) = %v, %q; want %v, %q", tc.dev.Name, ok, reason, tc.ok, tc.reason)
+		}
+	}
+
+	if ok, _ := (DeviceRules{}).Check(DeviceInfo{Name: "anything"}); !ok {
+		t.Error("empty rules rejected a device")
+	}
+}
+
+func TestParseDeviceRuleErrors(t *testing.T) {
+	for _, s := range []string{"", "name:", "id:", "id:xyz", "id:046d:12345", "id:046d:"} {
+		if _, err := ParseDeviceRule(s); err == nil {
+			t.Errorf("ParseDeviceRule(%q) succeeded", s)
+		}
+	}
+	// Names may contain colons; only known prefixes select a field.
+	r, err := ParseDeviceRule("Keyboard: K380")
+	if err != nil || !r.Match(DeviceInfo{Name: "keyboard: k380"}) {
+		t.Errorf("ParseDeviceRule(%q) = %v, %v", "Keyboard: K380", r, err)
+	}
+}
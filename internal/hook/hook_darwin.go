@@ -3,59 +3,261 @@
 package hook
 
 import (
+	"errors"
 	"log"
+	"sync"
+	"time"
 
 	gohook "github.com/robotn/gohook"
-	"github.com/victortrac/busygraph/internal/tracker"
+	"github.com/victortrac/busygraph/internal/input"
 )
 
-// Start starts the global key hook
-func Start(t *tracker.Tracker) {
+// wheelHorizontal is libuiohook's Event.Direction for horizontal scrolling
+// (vertical is 3).
+const wheelHorizontal = 4
+
+// mouseButtons maps libuiohook button numbers to tracker button names;
+// buttons 4 and 5 are the thumb buttons.
+var mouseButtons = map[uint16]string{
+	1: "left",
+	2: "right",
+	3: "middle",
+	4: "back",
+	5: "forward",
+}
+
+// rawcodeMap maps macOS virtual key codes (kVK_*) to key labels (see package
+// input). Keys are labelled by their position on a US layout, like on
+// Linux.
+var rawcodeMap = map[uint16]string{
+	0x00: "a", 0x0B: "b", 0x08: "c", 0x02: "d", 0x0E: "e", 0x03: "f",
+	0x05: "g", 0x04: "h", 0x22: "i", 0x26: "j", 0x28: "k", 0x25: "l",
+	0x2E: "m", 0x2D: "n", 0x1F: "o", 0x23: "p", 0x0C: "q", 0x0F: "r",
+	0x01: "s", 0x11: "t", 0x20: "u", 0x09: "v", 0x0D: "w", 0x07: "x",
+	0x10: "y", 0x06: "z",
+
+	0x12: "1", 0x13: "2", 0x14: "3", 0x15: "4", 0x17: "5",
+	0x16: "6", 0x1A: "7", 0x1C: "8", 0x19: "9", 0x1D: "0",
+
+	0x1B: "-",
+	0x18: "=",
+	0x21: "[",
+	0x1E: "]",
+	0x29: ";",
+	0x27: "'",
+	0x32: "`",
+	0x2A: "\\",
+	0x2B: ",",
+	0x2F: ".",
+	0x2C: "/",
+	0x0A: "[102ND]", // kVK_ISO_Section
+
+	0x24: "[ENTER]",
+	0x30: "[TAB]",
+	0x33: "[BACKSPACE]",
+	0x31: "[SPACE]",
+	0x35: "[ESC]",
+
+	0x7A: "[F1]", 0x78: "[F2]", 0x63: "[F3]", 0x76: "[F4]", 0x60: "[F5]",
+	0x61: "[F6]", 0x62: "[F7]", 0x64: "[F8]", 0x65: "[F9]", 0x6D: "[F10]",
+	0x67: "[F11]", 0x6F: "[F12]", 0x69: "[F13]", 0x6B: "[F14]", 0x71: "[F15]",
+	0x6A: "[F16]", 0x40: "[F17]", 0x4F: "[F18]", 0x50: "[F19]", 0x5A: "[F20]",
+
+	0x72: "[INSERT]", // kVK_Help, where PC keyboards have Insert
+	0x75: "[DELETE]",
+	0x73: "[HOME]",
+	0x77: "[END]",
+	0x74: "[PAGEUP]",
+	0x79: "[PAGEDOWN]",
+	0x7E: "[UP]",
+	0x7D: "[DOWN]",
+	0x7B: "[LEFT]",
+	0x7C: "[RIGHT]",
+
+	0x3B: "[CTRL]",
+	0x3E: "[CTRL]",
+	0x38: "[SHIFT]",
+	0x3C: "[SHIFT]",
+	0x3A: "[ALT]",
+	0x3D: "[ALT]",
+	0x37: "[META]",
+	0x36: "[META]",
+	0x3F: "[FN]",
+	0x39: "[CAPSLOCK]",
+
+	0x52: "[KP0]", 0x53: "[KP1]", 0x54: "[KP2]", 0x55: "[KP3]", 0x56: "[KP4]",
+	0x57: "[KP5]", 0x58: "[KP6]", 0x59: "[KP7]", 0x5B: "[KP8]", 0x5C: "[KP9]",
+	0x41: "[KP.]",
+	0x45: "[KP+]",
+	0x4E: "[KP-]",
+	0x43: "[KP*]",
+	0x4B: "[KP/]",
+	0x51: "[KP=]",
+	0x5F: "[KP,]",
+	0x4C: "[KPENTER]",
+	0x47: "[CLEAR]",
+	0x6E: "[MENU]",
+
+	0x4A: "[MUTE]",
+	0x49: "[VOLUMEDOWN]",
+	0x48: "[VOLUMEUP]",
+
+	0x5E: "[RO]",
+	0x5D: "[YEN]",
+	0x66: "[EISU]",
+	0x68: "[KANA]",
+}
+
+// tapSource reads the global event tap.
+type tapSource struct {
+	mu      sync.Mutex
+	stopped bool
+}
+
+var (
+	mu      sync.Mutex
+	current *tapSource // the running source, if any
+)
+
+// NewSource returns an input source reading the global event tap. The tap
+// cannot tell devices apart, so o.Devices is ignored and events have no
+// device. A source that has been stopped cannot be run again; to restart
+// capture, run a new one.
+func NewSource(o Options) input.Source { return &tapSource{} }
+
+// Run starts the global key hook and passes its events to sink until Stop is
+// called.
+func (s *tapSource) Run(sink input.Sink) error {
+	mu.Lock()
+	if current != nil {
+		mu.Unlock()
+		return errors.New("the global key hook is already running")
+	}
+	s.mu.Lock()
+	stopped := s.stopped
+	s.mu.Unlock()
+	if stopped {
+		mu.Unlock()
+		return nil
+	}
+	current = s
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		if current == s {
+			current = nil
+		}
+		mu.Unlock()
+	}()
+
 	log.Println("Starting global key hook...")
 	evChan := gohook.Start()
 	defer gohook.End()
 
+	// The previous pointer position, for motion.
+	var lastX, lastY int16
+	var havePos bool
+
 	for ev := range evChan {
-		if ev.Kind == gohook.KeyDown { // key press
-			// log.Println("Key pressed") // Debugging, can be noisy
-			key := gohook.RawcodetoKeychar(ev.Rawcode)
-			switch key {
-			case "\r", "\n":
-				key = "[ENTER]"
-			case "\t":
-				key = "[TAB]"
-			case "\b":
-				key = "[BACKSPACE]"
-			case " ":
-				key = "[SPACE]"
-			case "\x1b":
-				key = "[ESC]"
-			case "":
-				continue
+		// gohook's KeyHold is libuiohook's key press and KeyDown its
+		// "typed" event, which only keys that type a character send.
+		// libuiohook reports an autorepeat as another press; the processor
+		// tells them apart.
+		switch ev.Kind {
+		case gohook.KeyHold, gohook.KeyUp:
+			key, ok := rawcodeMap[ev.Rawcode]
+			if !ok {
+				if ev.Kind == gohook.KeyHold {
+					logUnmapped(ev.Rawcode, "keyboard")
+				}
+				key = input.UnmappedKey
 			}
-
-			// Filter out other control characters
-			if len(key) == 1 && key[0] < 32 {
-				continue
+			kind := input.KeyDown
+			if ev.Kind == gohook.KeyUp {
+				kind = input.KeyUp
 			}
-
-			t.Increment(key)
-		} else if ev.Kind == gohook.MouseMove || ev.Kind == gohook.MouseDrag {
-			t.TrackMouseMove(ev.X, ev.Y)
-		} else if ev.Kind == gohook.MouseDown {
-			// Button 1 = Left, 2 = Right (usually)
-			if ev.Button == 1 {
-				t.TrackMouseClick("left")
-			} else if ev.Button == 2 {
-				t.TrackMouseClick("right")
+			sink.HandleEvent(input.Event{Time: ev.When, Kind: kind, Code: ev.Rawcode, Key: key})
+		case gohook.MouseMove, gohook.MouseDrag:
+			if havePos {
+				sink.HandleEvent(input.Event{
+					Time: ev.When,
+					Kind: input.Motion,
+					DX:   float64(ev.X - lastX),
+					DY:   float64(ev.Y - lastY),
+				})
+			}
+			lastX, lastY, havePos = ev.X, ev.Y, true
+		case gohook.MouseDown:
+			if button, ok := mouseButtons[ev.Button]; ok {
+				sink.HandleEvent(input.Event{Time: ev.When, Kind: input.ButtonDown, Button: button})
 			}
-		} else if ev.Kind == gohook.MouseWheel {
-			t.TrackMouseScroll(int16(ev.Rotation)) // Rotation is usually amount
+		case gohook.MouseWheel:
+			// Rotation is usually amount
+			sink.HandleEvent(input.Event{
+				Time:       ev.When,
+				Kind:       input.Scroll,
+				Notches:    int16(ev.Rotation),
+				Horizontal: ev.Direction == wheelHorizontal,
+			})
 		}
 	}
+	// Key releases after the hook ended were not seen.
+	sink.HandleEvent(input.Event{Time: time.Now(), Kind: input.DeviceGone})
+	return nil
 }
 
-// Stop stops the global key hook
+// Stop ends the global key hook, which makes Run return.
+func (s *tapSource) Stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+
+	mu.Lock()
+	running := current == s
+	mu.Unlock()
+	if running {
+		gohook.End()
+	}
+}
+
+// Status reports whether s is running.
+func (s *tapSource) Status() input.Status {
+	mu.Lock()
+	defer mu.Unlock()
+	if current != s {
+		return input.Status{Error: "input capture is not running"}
+	}
+	return input.Status{Capturing: true}
+}
+
+// CurrentStatus reports whether the global key hook is running.
+func CurrentStatus() input.Status {
+	mu.Lock()
+	defer mu.Unlock()
+	if current == nil {
+		return input.Status{Error: "input capture is not running"}
+	}
+	return input.Status{Capturing: true}
+}
+
+// Diagnose describes how input is captured. macOS gives no way to check the
+// Accessibility permission up front; it prompts on first use.
+func Diagnose() (string, error) {
+	return "global event tap; grant BusyGraph Accessibility access in System Settings if prompted", nil
+}
+
+// ListDevices is not supported on macOS, where the event tap does not say
+// which device input came from.
+func ListDevices(rules DeviceRules) ([]DeviceReport, error) {
+	return nil, errors.New("listing input devices is only supported on Linux")
+}
+
+// Stop stops the running source, if any.
 func Stop() {
-	gohook.End()
+	mu.Lock()
+	s := current
+	mu.Unlock()
+	if s != nil {
+		s.Stop()
+	}
 }
@@ -0,0 +1,13 @@
+//go:build darwin
+
+package hook
+
+import "testing"
+
+func TestRawcodeMap(t *testing.T) {
+	labels := make([]string, 0, len(rawcodeMap))
+	for _, l := range rawcodeMap {
+		labels = append(labels, l)
+	}
+	checkKeyMap(t, labels)
+}
@@ -3,28 +3,27 @@
 package hook
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	evdev "github.com/holoplot/go-evdev"
-	"github.com/victortrac/busygraph/internal/tracker"
+	"github.com/victortrac/busygraph/internal/input"
 )
 
 var (
 	mu      sync.Mutex
-	devices []*evdev.InputDevice
-	wg      sync.WaitGroup
-
-	// Virtual cursor position for relative mouse → absolute coordinate conversion.
-	cursorX, cursorY int16
+	current *evdevSource // the running source, if any
 )
 
-// keycodeMap maps evdev key codes to the string labels used by the tracker.
-// Modifiers are intentionally excluded (matching gohook behavior where they
-// return an empty string and get skipped).
+// keycodeMap maps evdev key codes to key labels (see package input). Keys
+// are labelled by their position on a US layout.
 var keycodeMap = map[evdev.EvCode]string{
 	evdev.KEY_A: "a", evdev.KEY_B: "b", evdev.KEY_C: "c", evdev.KEY_D: "d",
 	evdev.KEY_E: "e", evdev.KEY_F: "f", evdev.KEY_G: "g", evdev.KEY_H: "h",
@@ -49,6 +48,7 @@ var keycodeMap = map[evdev.EvCode]string{
 	evdev.KEY_COMMA:      ",",
 	evdev.KEY_DOT:        ".",
 	evdev.KEY_SLASH:      "/",
+	evdev.KEY_102ND:      "[102ND]",
 
 	evdev.KEY_ENTER:     "[ENTER]",
 	evdev.KEY_TAB:       "[TAB]",
@@ -60,6 +60,10 @@ var keycodeMap = map[evdev.EvCode]string{
 	evdev.KEY_F4: "[F4]", evdev.KEY_F5: "[F5]", evdev.KEY_F6: "[F6]",
 	evdev.KEY_F7: "[F7]", evdev.KEY_F8: "[F8]", evdev.KEY_F9: "[F9]",
 	evdev.KEY_F10: "[F10]", evdev.KEY_F11: "[F11]", evdev.KEY_F12: "[F12]",
+	evdev.KEY_F13: "[F13]", evdev.KEY_F14: "[F14]", evdev.KEY_F15: "[F15]",
+	evdev.KEY_F16: "[F16]", evdev.KEY_F17: "[F17]", evdev.KEY_F18: "[F18]",
+	evdev.KEY_F19: "[F19]", evdev.KEY_F20: "[F20]", evdev.KEY_F21: "[F21]",
+	evdev.KEY_F22: "[F22]", evdev.KEY_F23: "[F23]", evdev.KEY_F24: "[F24]",
 
 	evdev.KEY_INSERT:   "[INSERT]",
 	evdev.KEY_DELETE:   "[DELETE]",
@@ -71,6 +75,114 @@ var keycodeMap = map[evdev.EvCode]string{
 	evdev.KEY_DOWN:     "[DOWN]",
 	evdev.KEY_LEFT:     "[LEFT]",
 	evdev.KEY_RIGHT:    "[RIGHT]",
+
+	evdev.KEY_LEFTCTRL:   "[CTRL]",
+	evdev.KEY_RIGHTCTRL:  "[CTRL]",
+	evdev.KEY_LEFTSHIFT:  "[SHIFT]",
+	evdev.KEY_RIGHTSHIFT: "[SHIFT]",
+	evdev.KEY_LEFTALT:    "[ALT]",
+	evdev.KEY_RIGHTALT:   "[ALT]",
+	evdev.KEY_LEFTMETA:   "[META]",
+	evdev.KEY_RIGHTMETA:  "[META]",
+	evdev.KEY_FN:         "[FN]",
+	evdev.KEY_CAPSLOCK:   "[CAPSLOCK]",
+
+	evdev.KEY_KP0: "[KP0]", evdev.KEY_KP1: "[KP1]", evdev.KEY_KP2: "[KP2]",
+	evdev.KEY_KP3: "[KP3]", evdev.KEY_KP4: "[KP4]", evdev.KEY_KP5: "[KP5]",
+	evdev.KEY_KP6: "[KP6]", evdev.KEY_KP7: "[KP7]", evdev.KEY_KP8: "[KP8]",
+	evdev.KEY_KP9:             "[KP9]",
+	evdev.KEY_KPDOT:           "[KP.]",
+	evdev.KEY_KPPLUS:          "[KP+]",
+	evdev.KEY_KPMINUS:         "[KP-]",
+	evdev.KEY_KPASTERISK:      "[KP*]",
+	evdev.KEY_KPSLASH:         "[KP/]",
+	evdev.KEY_KPEQUAL:         "[KP=]",
+	evdev.KEY_KPCOMMA:         "[KP,]",
+	evdev.KEY_KPJPCOMMA:       "[KP,]",
+	evdev.KEY_KPLEFTPAREN:     "[KP(]",
+	evdev.KEY_KPRIGHTPAREN:    "[KP)]",
+	evdev.KEY_KPPLUSMINUS:     "[KP+-]",
+	evdev.KEY_KPENTER:         "[KPENTER]",
+	evdev.KEY_NUMLOCK:         "[NUMLOCK]",
+	evdev.KEY_CLEAR:           "[CLEAR]",
+	evdev.KEY_SCROLLLOCK:      "[SCROLLLOCK]",
+	evdev.KEY_SYSRQ:           "[PRINT]",
+	evdev.KEY_PRINT:           "[PRINT]",
+	evdev.KEY_PAUSE:           "[PAUSE]",
+	evdev.KEY_COMPOSE:         "[MENU]",
+	evdev.KEY_MENU:            "[MENU]",
+	evdev.KEY_HELP:            "[HELP]",
+	evdev.KEY_POWER:           "[POWER]",
+	evdev.KEY_SLEEP:           "[SLEEP]",
+	evdev.KEY_WAKEUP:          "[WAKEUP]",
+	evdev.KEY_SCREENLOCK:      "[SCREENLOCK]",
+	evdev.KEY_BRIGHTNESSDOWN:  "[BRIGHTNESSDOWN]",
+	evdev.KEY_BRIGHTNESSUP:    "[BRIGHTNESSUP]",
+	evdev.KEY_KBDILLUMTOGGLE:  "[KBDILLUMTOGGLE]",
+	evdev.KEY_KBDILLUMDOWN:    "[KBDILLUMDOWN]",
+	evdev.KEY_KBDILLUMUP:      "[KBDILLUMUP]",
+	evdev.KEY_SWITCHVIDEOMODE: "[SWITCHVIDEOMODE]",
+
+	evdev.KEY_MUTE:         "[MUTE]",
+	evdev.KEY_MICMUTE:      "[MICMUTE]",
+	evdev.KEY_VOLUMEDOWN:   "[VOLUMEDOWN]",
+	evdev.KEY_VOLUMEUP:     "[VOLUMEUP]",
+	evdev.KEY_PLAYPAUSE:    "[PLAYPAUSE]",
+	evdev.KEY_PLAYCD:       "[PLAYPAUSE]",
+	evdev.KEY_PAUSECD:      "[PLAYPAUSE]",
+	evdev.KEY_PLAY:         "[PLAYPAUSE]",
+	evdev.KEY_NEXTSONG:     "[NEXT]",
+	evdev.KEY_PREVIOUSSONG: "[PREVIOUS]",
+	evdev.KEY_STOPCD:       "[STOP]",
+	evdev.KEY_FASTFORWARD:  "[FASTFORWARD]",
+	evdev.KEY_REWIND:       "[REWIND]",
+	evdev.KEY_EJECTCD:      "[EJECT]",
+	evdev.KEY_EJECTCLOSECD: "[EJECT]",
+	evdev.KEY_CALC:         "[CALC]",
+	evdev.KEY_MAIL:         "[MAIL]",
+	evdev.KEY_WWW:          "[BROWSER]",
+	evdev.KEY_HOMEPAGE:     "[BROWSER]",
+	evdev.KEY_SEARCH:       "[SEARCH]",
+	evdev.KEY_BACK:         "[BACK]",
+	evdev.KEY_FORWARD:      "[FORWARD]",
+	evdev.KEY_REFRESH:      "[REFRESH]",
+	evdev.KEY_BOOKMARKS:    "[BOOKMARKS]",
+	evdev.KEY_COMPUTER:     "[COMPUTER]",
+	evdev.KEY_STOP:         "[STOP]",
+	evdev.KEY_AGAIN:        "[AGAIN]",
+	evdev.KEY_UNDO:         "[UNDO]",
+	evdev.KEY_REDO:         "[REDO]",
+	evdev.KEY_COPY:         "[COPY]",
+	evdev.KEY_PASTE:        "[PASTE]",
+	evdev.KEY_CUT:          "[CUT]",
+	evdev.KEY_FIND:         "[FIND]",
+	evdev.KEY_OPEN:         "[OPEN]",
+	evdev.KEY_PROPS:        "[PROPS]",
+	evdev.KEY_FRONT:        "[FRONT]",
+
+	evdev.KEY_RO:               "[RO]",
+	evdev.KEY_YEN:              "[YEN]",
+	evdev.KEY_KATAKANA:         "[KATAKANA]",
+	evdev.KEY_HIRAGANA:         "[HIRAGANA]",
+	evdev.KEY_KATAKANAHIRAGANA: "[KANA]",
+	evdev.KEY_HENKAN:           "[HENKAN]",
+	evdev.KEY_MUHENKAN:         "[MUHENKAN]",
+	evdev.KEY_ZENKAKUHANKAKU:   "[ZENKAKUHANKAKU]",
+	evdev.KEY_HANGEUL:          "[HANGUL]",
+	evdev.KEY_HANJA:            "[HANJA]",
+}
+
+// mouseButtonMap maps evdev button codes to tracker button names. Thumb
+// buttons report BTN_SIDE/BTN_EXTRA on most mice and BTN_BACK/BTN_FORWARD
+// on a few.
+var mouseButtonMap = map[evdev.EvCode]string{
+	evdev.BTN_LEFT:    "left",
+	evdev.BTN_RIGHT:   "right",
+	evdev.BTN_MIDDLE:  "middle",
+	evdev.BTN_SIDE:    "back",
+	evdev.BTN_BACK:    "back",
+	evdev.BTN_EXTRA:   "forward",
+	evdev.BTN_FORWARD: "forward",
 }
 
 type deviceKind int
@@ -78,68 +190,376 @@ type deviceKind int
 const (
 	kindKeyboard deviceKind = 1 << iota
 	kindMouse
+	kindAbsolute // touchpad, touchscreen or tablet
 )
 
-// Start opens all keyboard and mouse evdev devices and begins tracking input.
-func Start(t *tracker.Tracker) {
+// inputDir is where evdev exposes its event nodes.
+const inputDir = "/dev/input"
+
+// evdevSource reads keyboards and pointers from /dev/input. Only one can run
+// at a time.
+type evdevSource struct {
+	o Options
+
+	mu      sync.Mutex
+	stopped bool
+	sink    input.Sink
+	devices map[string]*evdev.InputDevice // open devices by path
+	watcher *os.File                      // inotify instance watching /dev/input
+	wg      sync.WaitGroup                // the watcher and device readers
+}
+
+// NewSource returns an input source reading the evdev devices allowed by
+// o.Devices. A source that has been stopped cannot be run again; to restart
+// capture, run a new one.
+func NewSource(o Options) input.Source {
+	if o.MouseDPI <= 0 {
+		o.MouseDPI = 96
+	}
+	return &evdevSource{o: o}
+}
+
+// Run opens all keyboard and pointer evdev devices allowed by the device
+// rules and passes their events to sink. Devices plugged in later are picked
+// up by watching /dev/input, so Run keeps running until Stop is called even
+// if nothing is readable yet. It returns an error if there is nothing to
+// read and nothing to wait for: evdev is missing, access to the devices is
+// denied, or they cannot be watched.
+func (s *evdevSource) Run(sink input.Sink) error {
+	mu.Lock()
+	if current != nil {
+		mu.Unlock()
+		return errors.New("evdev input capture is already running")
+	}
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		mu.Unlock()
+		return nil
+	}
+	s.sink = sink
+	s.devices = make(map[string]*evdev.InputDevice)
+	s.mu.Unlock()
+	current = s
+	mu.Unlock()
+
 	log.Println("Starting evdev input capture...")
+	if err := s.open(); err != nil {
+		s.Stop()
+		s.wg.Wait()
+		return err
+	}
 
-	matches, err := filepath.Glob("/dev/input/event*")
+	// Block until the watcher and all device goroutines exit (i.e. Stop()
+	// is called).
+	s.wg.Wait()
+	return nil
+}
+
+// open starts watching /dev/input and reading the devices already there.
+func (s *evdevSource) open() error {
+	// Containers and some VMs have no evdev at all.
+	if _, err := os.Stat(inputDir); os.IsNotExist(err) {
+		return errors.New("/dev/input not found; evdev is not available on this system")
+	}
+
+	// Watch before listing so a device plugged in between the two is not
+	// missed; addDevice ignores paths that are already open.
+	w, err := watchInputDir()
+	if err != nil {
+		log.Printf("Failed to watch /dev/input, devices plugged in later will not be tracked: %v", err)
+	} else {
+		s.mu.Lock()
+		if s.stopped {
+			w.Close()
+			w = nil
+		} else {
+			s.watcher = w
+			s.wg.Add(1)
+			go s.watchLoop(w)
+		}
+		s.mu.Unlock()
+	}
+
+	matches, err := filepath.Glob(filepath.Join(inputDir, "event*"))
 	if err != nil {
-		log.Fatalf("Failed to list /dev/input/event* devices: %v", err)
+		return fmt.Errorf("listing /dev/input/event* devices: %w", err)
 	}
 
-	var opened int
+	var opened, denied int
 	for _, path := range matches {
-		dev, err := evdev.Open(path)
-		if err != nil {
-			if os.IsPermission(err) {
-				log.Fatalf("Permission denied opening %s. Add your user to the 'input' group:\n  sudo usermod -aG input $USER\nthen log out and back in.", path)
-			}
-			continue // skip devices we can't open
+		ok, err := s.addDevice(path)
+		if err != nil && os.IsPermission(err) {
+			denied++
 		}
+		if ok {
+			opened++
+		}
+	}
 
-		kind := classifyDevice(dev)
-		if kind == 0 {
-			dev.Close()
-			continue
+	if opened == 0 {
+		if denied > 0 {
+			return fmt.Errorf("permission denied on %d input devices; add your user to the 'input' group (sudo usermod -aG input $USER), then log out and back in", denied)
+		}
+		if w == nil {
+			return errors.New("no usable input devices found")
 		}
+		log.Println("No usable input devices found yet; waiting for a keyboard or mouse to be connected")
+	}
+	return nil
+}
 
-		name, _ := dev.Name()
-		log.Printf("Opened %s: %s (keyboard=%v mouse=%v)",
-			path, name, kind&kindKeyboard != 0, kind&kindMouse != 0)
+// Stop closes the /dev/input watcher and all open devices, which causes
+// ReadOne() to return an error and the goroutines, and then Run, to exit.
+func (s *evdevSource) Stop() {
+	mu.Lock()
+	if current == s {
+		current = nil
+	}
+	mu.Unlock()
 
-		mu.Lock()
-		devices = append(devices, dev)
-		mu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-		wg.Add(1)
-		go readLoop(dev, kind, t)
-		opened++
+	s.stopped = true
+	if s.watcher != nil {
+		s.watcher.Close()
+		s.watcher = nil
+	}
+	for _, dev := range s.devices {
+		dev.Close()
 	}
+	s.devices = nil
+}
 
-	if opened == 0 {
-		log.Fatalf("No usable input devices found. Make sure you have permission to read /dev/input/event* devices.\n  sudo usermod -aG input $USER")
+// Stop stops the running source, if any.
+func Stop() {
+	mu.Lock()
+	s := current
+	mu.Unlock()
+	if s != nil {
+		s.Stop()
 	}
+}
 
-	// Block until all device goroutines exit (i.e. Stop() is called).
-	wg.Wait()
+// Status reports which devices s is reading.
+func (s *evdevSource) Status() input.Status {
+	mu.Lock()
+	running := current == s
+	mu.Unlock()
+	if !running {
+		return input.Status{Error: "input capture is not running"}
+	}
+	names := s.openDevices()
+	if len(names) == 0 {
+		return input.Status{Error: "no keyboard or mouse is connected"}
+	}
+	return input.Status{Capturing: true, Devices: names}
 }
 
-// Stop closes all open devices, which causes ReadOne() to return an error
-// and the goroutines to exit.
-func Stop() {
+// CurrentStatus reports which devices the running source is reading.
+func CurrentStatus() input.Status {
 	mu.Lock()
-	defer mu.Unlock()
+	s := current
+	mu.Unlock()
+	if s == nil {
+		return input.Status{Error: "input capture is not running"}
+	}
+	return s.Status()
+}
+
+// addDevice opens path and starts reading it if it is a keyboard or mouse
+// allowed by the device rules that is not already open. It reports whether a
+// reader was started.
+func (s *evdevSource) addDevice(path string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// devices is nil once Stop has been called.
+	if s.devices == nil || s.devices[path] != nil {
+		return false, nil
+	}
+
+	dev, err := evdev.Open(path)
+	if err != nil {
+		return false, err
+	}
+
+	kind := classifyDevice(dev)
+	if kind == 0 {
+		dev.Close()
+		return false, nil
+	}
+
+	info := deviceInfo(path, dev)
+	if ok, reason := s.o.Devices.Check(info); !ok {
+		log.Printf("Ignoring %s: %s (%s)", path, info.Name, reason)
+		dev.Close()
+		return false, nil
+	}
+
+	log.Printf("Opened %s: %s (%s)", path, info.Name, kind)
+
+	var abs *absPointer
+	if kind&kindAbsolute != 0 {
+		abs = newAbsPointer(dev, s.o.MouseDPI)
+	}
+
+	s.devices[path] = dev
+	s.wg.Add(1)
+	go s.readLoop(path, dev, kind, abs)
+	return true, nil
+}
+
+// removeDevice forgets the device at path and closes it. It reports whether
+// the device was still open.
+func (s *evdevSource) removeDevice(path string, dev *evdev.InputDevice) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if dev == nil {
+		dev = s.devices[path]
+	}
+	if dev == nil || s.devices[path] != dev {
+		return false
+	}
+	delete(s.devices, path)
+	dev.Close()
+	return true
+}
+
+// openDevices returns the names of the devices being read.
+func (s *evdevSource) openDevices() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.devices))
+	for path, dev := range s.devices {
+		name, _ := dev.Name()
+		if name == "" {
+			name = filepath.Base(path)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Diagnose reports which input devices Start would be able to read, or an
+// error explaining why none are usable.
+func Diagnose() (string, error) {
+	matches, err := filepath.Glob(filepath.Join(inputDir, "event*"))
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("no /dev/input/event* devices")
+	}
 
-	for _, dev := range devices {
+	var keyboards, mice, denied int
+	for _, path := range matches {
+		dev, err := evdev.Open(path)
+		if err != nil {
+			if os.IsPermission(err) {
+				denied++
+			}
+			continue
+		}
+		kind := classifyDevice(dev)
 		dev.Close()
+		if kind&kindKeyboard != 0 {
+			keyboards++
+		}
+		if kind&(kindMouse|kindAbsolute) != 0 {
+			mice++
+		}
 	}
-	devices = nil
+
+	if keyboards+mice == 0 {
+		if denied > 0 {
+			return "", fmt.Errorf("permission denied on %d of %d devices; add your user to the 'input' group: sudo usermod -aG input $USER", denied, len(matches))
+		}
+		return "", fmt.Errorf("no keyboards or mice among %d devices", len(matches))
+	}
+	summary := fmt.Sprintf("%d keyboard(s), %d pointer device(s) readable", keyboards, mice)
+	if denied > 0 {
+		summary += fmt.Sprintf("; permission denied on %d other device(s)", denied)
+	}
+	return summary, nil
+}
+
+// ListDevices reports every evdev device, how it is classified and whether
+// rules allow capturing it.
+func ListDevices(rules DeviceRules) ([]DeviceReport, error) {
+	matches, err := filepath.Glob(filepath.Join(inputDir, "event*"))
+	if err != nil {
+		return nil, err
+	}
+	// Glob sorts lexically; list event2 before event10.
+	sort.Slice(matches, func(i, j int) bool {
+		if len(matches[i]) != len(matches[j]) {
+			return len(matches[i]) < len(matches[j])
+		}
+		return matches[i] < matches[j]
+	})
+
+	reports := make([]DeviceReport, 0, len(matches))
+	for _, path := range matches {
+		r := DeviceReport{DeviceInfo: DeviceInfo{Path: path}}
+		dev, err := evdev.Open(path)
+		if err != nil {
+			if os.IsPermission(err) {
+				r.Reason = "permission denied"
+			} else {
+				r.Reason = err.Error()
+			}
+			reports = append(reports, r)
+			continue
+		}
+		kind := classifyDevice(dev)
+		r.DeviceInfo = deviceInfo(path, dev)
+		dev.Close()
+
+		r.Kind = kind.String()
+		if kind == 0 {
+			r.Reason = "not a keyboard or pointer"
+		} else {
+			r.Tracked, r.Reason = rules.Check(r.DeviceInfo)
+		}
+		reports = append(reports, r)
+	}
+	return reports, nil
+}
+
+// deviceInfo reads the identifying attributes of dev.
+func deviceInfo(path string, dev *evdev.InputDevice) DeviceInfo {
+	info := DeviceInfo{Path: path}
+	info.Name, _ = dev.Name()
+	info.Phys, _ = dev.PhysicalLocation()
+	if id, err := dev.InputID(); err == nil {
+		info.Vendor, info.Product = id.Vendor, id.Product
+	}
+	return info
+}
+
+// String returns the kinds joined by "+", e.g. "keyboard+mouse", or "".
+func (k deviceKind) String() string {
+	var kinds []string
+	if k&kindKeyboard != 0 {
+		kinds = append(kinds, "keyboard")
+	}
+	if k&kindMouse != 0 {
+		kinds = append(kinds, "mouse")
+	}
+	if k&kindAbsolute != 0 {
+		kinds = append(kinds, "touchpad")
+	}
+	return strings.Join(kinds, "+")
 }
 
 // classifyDevice checks capabilities to determine whether dev is a keyboard,
-// mouse, or both. Returns 0 if neither.
+// a relative mouse, an absolute pointer (touchpad, touchscreen, tablet) or a
+// combination. Returns 0 if none.
 func classifyDevice(dev *evdev.InputDevice) deviceKind {
 	var kind deviceKind
 
@@ -153,60 +573,129 @@ func classifyDevice(dev *evdev.InputDevice) deviceKind {
 		return false
 	}
 
-	if hasType(evdev.EV_KEY) {
-		codes := dev.CapableEvents(evdev.EV_KEY)
-		codeSet := make(map[evdev.EvCode]bool, len(codes))
-		for _, c := range codes {
-			codeSet[c] = true
-		}
+	if !hasType(evdev.EV_KEY) {
+		return 0
+	}
+	keys := codeSet(dev.CapableEvents(evdev.EV_KEY))
 
-		// Keyboard: has letter keys
-		if codeSet[evdev.KEY_A] {
-			kind |= kindKeyboard
-		}
-		// Mouse: has mouse buttons
-		if codeSet[evdev.BTN_LEFT] && hasType(evdev.EV_REL) {
-			kind |= kindMouse
+	// Keyboard: has letter keys, or media keys, which many keyboards
+	// report through a separate "Consumer Control" device.
+	if keys[evdev.KEY_A] || keys[evdev.KEY_VOLUMEUP] || keys[evdev.KEY_PLAYPAUSE] {
+		kind |= kindKeyboard
+	}
+	// Mouse: has mouse buttons
+	if keys[evdev.BTN_LEFT] && hasType(evdev.EV_REL) {
+		kind |= kindMouse
+	}
+
+	// Absolute pointer: X/Y axes plus something that clicks or touches.
+	// Accelerometers and joysticks also report ABS_X/ABS_Y but have none of
+	// these.
+	if kind&kindMouse == 0 && hasType(evdev.EV_ABS) {
+		axes := codeSet(dev.CapableEvents(evdev.EV_ABS))
+		clicks := keys[evdev.BTN_TOUCH] || keys[evdev.BTN_LEFT] || keys[evdev.BTN_TOOL_PEN]
+		if axes[evdev.ABS_X] && axes[evdev.ABS_Y] && clicks && !isAccelerometer(dev) {
+			kind |= kindAbsolute
 		}
 	}
 
 	return kind
 }
 
-// readLoop reads events from a single device until it is closed.
-func readLoop(dev *evdev.InputDevice, kind deviceKind, t *tracker.Tracker) {
-	defer wg.Done()
+// isButton reports whether an EV_KEY code is a mouse, joystick, gamepad or
+// other button rather than a keyboard key.
+func isButton(code evdev.EvCode) bool {
+	return code >= evdev.BTN_MISC && code < evdev.KEY_OK ||
+		code >= evdev.BTN_DPAD_UP && code <= evdev.BTN_DPAD_RIGHT ||
+		code >= evdev.BTN_TRIGGER_HAPPY
+}
+
+func codeSet(codes []evdev.EvCode) map[evdev.EvCode]bool {
+	set := make(map[evdev.EvCode]bool, len(codes))
+	for _, c := range codes {
+		set[c] = true
+	}
+	return set
+}
+
+func isAccelerometer(dev *evdev.InputDevice) bool {
+	for _, p := range dev.Properties() {
+		if p == evdev.EvProp(evdev.INPUT_PROP_ACCELEROMETER) {
+			return true
+		}
+	}
+	return false
+}
+
+// readLoop reads events from a single device until it is closed or
+// unplugged, passing them to the sink. abs decodes absolute pointer events
+// and is nil for other devices.
+func (s *evdevSource) readLoop(path string, dev *evdev.InputDevice, kind deviceKind, abs *absPointer) {
+	defer s.wg.Done()
+
+	// Attribute input to the device by name so the built-in keyboard and
+	// an external one can be told apart.
+	name, _ := dev.Name()
+	if name == "" {
+		name = filepath.Base(path)
+	}
+	out := &emitter{sink: s.sink, device: name}
+	defer func() {
+		out.at = time.Now()
+		out.emit(input.Event{Kind: input.DeviceGone})
+	}()
 
 	// Per-SYN-frame accumulators for relative mouse movement.
 	var dx, dy int32
 
+	rel := codeSet(dev.CapableEvents(evdev.EV_REL))
+	wheel := wheelAxis{hiRes: rel[evdev.REL_WHEEL_HI_RES]}
+	hwheel := wheelAxis{hiRes: rel[evdev.REL_HWHEEL_HI_RES]}
+
 	for {
 		ev, err := dev.ReadOne()
 		if err != nil {
-			return // device closed or error → exit goroutine
+			// Closed by Stop or removeDevice, or the device went away
+			// (ENODEV) before the watcher saw it being removed.
+			if s.removeDevice(path, dev) {
+				log.Printf("Removed %s: %v", path, err)
+			}
+			return
+		}
+		out.at = time.Unix(0, ev.Time.Nano())
+
+		if abs != nil {
+			abs.handle(ev, out)
 		}
 
 		switch ev.Type {
 		case evdev.EV_KEY:
-			if ev.Value != 1 { // only key press, not repeat (2) or release (0)
-				continue
-			}
-
 			if kind&kindMouse != 0 {
-				switch ev.Code {
-				case evdev.BTN_LEFT:
-					t.TrackMouseClick("left")
-					continue
-				case evdev.BTN_RIGHT:
-					t.TrackMouseClick("right")
+				if button, ok := mouseButtonMap[ev.Code]; ok {
+					if ev.Value == 1 {
+						out.click(button)
+					}
 					continue
 				}
 			}
 
-			if kind&kindKeyboard != 0 {
-				if label, ok := keycodeMap[ev.Code]; ok {
-					t.Increment(label)
+			if kind&kindKeyboard != 0 && !isButton(ev.Code) {
+				key := input.Event{Code: uint16(ev.Code), Key: keycodeMap[ev.Code]}
+				switch ev.Value {
+				case 0:
+					key.Kind = input.KeyUp
+				case 1:
+					key.Kind = input.KeyDown
+				case 2:
+					key.Kind = input.KeyRepeat
 				}
+				if key.Key == "" {
+					if key.Kind == input.KeyDown {
+						logUnmapped(key.Code, name)
+					}
+					key.Key = input.UnmappedKey
+				}
+				out.emit(key)
 			}
 
 		case evdev.EV_REL:
@@ -219,39 +708,81 @@ func readLoop(dev *evdev.InputDevice, kind deviceKind, t *tracker.Tracker) {
 			case evdev.REL_Y:
 				dy += ev.Value
 			case evdev.REL_WHEEL:
-				t.TrackMouseScroll(int16(ev.Value))
+				out.scroll(false, wheel.notches(ev.Value))
+			case evdev.REL_WHEEL_HI_RES:
+				out.scroll(false, wheel.hiResNotches(ev.Value))
+			case evdev.REL_HWHEEL:
+				out.scroll(true, hwheel.notches(ev.Value))
+			case evdev.REL_HWHEEL_HI_RES:
+				out.scroll(true, hwheel.hiResNotches(ev.Value))
 			}
 
 		case evdev.EV_SYN:
 			// SYN_REPORT marks the end of an input frame.
 			if ev.Code == 0 && (dx != 0 || dy != 0) {
-				newX := clampInt16(int32(cursorX) + dx)
-				newY := clampInt16(int32(cursorY) + dy)
-				cursorX = newX
-				cursorY = newY
-				t.TrackMouseMove(newX, newY)
+				out.move(float64(dx), float64(dy))
 				dx, dy = 0, 0
 			}
 		}
 	}
 }
 
-func clampInt16(v int32) int16 {
-	switch {
-	case v > 32767:
-		// Wrap around to avoid getting stuck at the boundary.
-		return int16(v - 65536)
-	case v < -32768:
-		return int16(v + 65536)
-	default:
-		return int16(v)
+// emitter passes what readLoop and absPointer decode to a sink as events of
+// one device.
+type emitter struct {
+	sink   input.Sink
+	device string
+	at     time.Time // time of the evdev event being decoded
+}
+
+func (e *emitter) emit(ev input.Event) {
+	ev.Time, ev.Device = e.at, e.device
+	e.sink.HandleEvent(ev)
+}
+
+func (e *emitter) click(button string) {
+	e.emit(input.Event{Kind: input.ButtonDown, Button: button})
+}
+
+func (e *emitter) scroll(horizontal bool, notches int16) {
+	if notches != 0 {
+		e.emit(input.Event{Kind: input.Scroll, Notches: notches, Horizontal: horizontal})
+	}
+}
+
+func (e *emitter) move(dx, dy float64) {
+	e.emit(input.Event{Kind: input.Motion, DX: dx, DY: dy})
+}
+
+// hiResPerNotch is the REL_*_HI_RES value of one full wheel notch.
+const hiResPerNotch = 120
+
+// wheelAxis counts one scroll wheel axis. Mice with high-resolution wheels
+// send REL_*_HI_RES events as well as the legacy notch events; only the
+// former are used for them so each turn is counted once, and partial notches
+// are carried over rather than rounded away.
+type wheelAxis struct {
+	hiRes bool
+	acc   int32 // hi-res units not yet counted
+}
+
+// notches returns the notches of a legacy wheel event, or 0 if the device
+// reports the axis in high resolution.
+func (w *wheelAxis) notches(v int32) int16 {
+	if w.hiRes {
+		return 0
 	}
+	return int16(v)
 }
 
-func init() {
-	// Sanity-check: if /dev/input doesn't exist, give a helpful message.
-	if _, err := os.Stat("/dev/input"); os.IsNotExist(err) {
-		fmt.Fprintln(os.Stderr, "busygraph: /dev/input not found — evdev is not available on this system")
-		os.Exit(1)
+// hiResNotches adds a REL_*_HI_RES event and returns the whole notches
+// completed, in either direction.
+func (w *wheelAxis) hiResNotches(v int32) int16 {
+	if v < 0 {
+		v = -v
 	}
+	w.acc += v
+	n := w.acc / hiResPerNotch
+	w.acc -= n * hiResPerNotch
+	return int16(n)
 }
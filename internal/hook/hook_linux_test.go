@@ -0,0 +1,73 @@
+//go:build linux
+
+package hook
+
+import (
+	"testing"
+	"time"
+
+	evdev "github.com/holoplot/go-evdev"
+	"github.com/victortrac/busygraph/internal/input"
+)
+
+func TestWheelAxis(t *testing.T) {
+	legacy := wheelAxis{}
+	if n := legacy.notches(-2); n != -2 {
+		t.Fatalf("legacy notches = %d, want -2", n)
+	}
+
+	// A high-resolution wheel: legacy events are ignored and partial
+	// notches in either direction add up.
+	w := wheelAxis{hiRes: true}
+	if n := w.notches(1); n != 0 {
+		t.Fatalf("notches on a hi-res wheel = %d, want 0", n)
+	}
+	var total int16
+	for _, v := range []int32{30, 30, -30, 60, 240, -15} {
+		total += w.hiResNotches(v)
+	}
+	if total != 3 || w.acc != 45 {
+		t.Fatalf("hi-res notches = %d with %d left over, want 3 with 45", total, w.acc)
+	}
+}
+
+func TestKeycodeMap(t *testing.T) {
+	labels := make([]string, 0, len(keycodeMap))
+	for _, l := range keycodeMap {
+		labels = append(labels, l)
+	}
+	checkKeyMap(t, labels)
+
+	// Every key of a 105-key PC keyboard: KEY_ESC to KEY_F12, with the
+	// unused code 84 between them.
+	for code := evdev.KEY_ESC; code <= evdev.KEY_F12; code++ {
+		if _, ok := keycodeMap[code]; !ok && code != 84 {
+			t.Errorf("key code %d has no label", code)
+		}
+	}
+	for code := range keycodeMap {
+		if isButton(code) {
+			t.Errorf("key code %d is a button", code)
+		}
+	}
+}
+
+func TestStoppedSource(t *testing.T) {
+	src := NewSource(Options{})
+	src.Stop()
+
+	done := make(chan error, 1)
+	go func() { done <- src.Run(input.SinkFunc(func(input.Event) {})) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run after Stop = %v, want nil", err)
+		}
+	case <-time.After(time.Second):
+		Stop()
+		t.Fatal("Run after Stop did not return")
+	}
+	if st := CurrentStatus(); st.Capturing || st.Error == "" {
+		t.Errorf("status = %+v, want not capturing with a reason", st)
+	}
+}
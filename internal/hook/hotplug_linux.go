@@ -0,0 +1,112 @@
+//go:build linux
+
+package hook
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Event nodes show up with IN_CREATE, but udev usually fixes up their owner
+// and mode a moment later, so a device that is not yet readable is retried on
+// IN_ATTRIB. Renames into and out of the directory count as add and remove.
+const watchMask = syscall.IN_CREATE | syscall.IN_ATTRIB | syscall.IN_MOVED_TO |
+	syscall.IN_DELETE | syscall.IN_MOVED_FROM
+
+// inotifyEvent is one decoded record from an inotify read.
+type inotifyEvent struct {
+	mask uint32
+	name string
+}
+
+// watchInputDir returns a non-blocking inotify instance watching inputDir.
+// Wrapping it in an *os.File puts it on the runtime poller, so closing it
+// unblocks a pending Read.
+func watchInputDir() (*os.File, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	if _, err := syscall.InotifyAddWatch(fd, inputDir, watchMask); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("inotify_add_watch", err)
+	}
+	return os.NewFile(uintptr(fd), "inotify:"+inputDir), nil
+}
+
+// watchLoop opens event nodes as they appear and closes them as they go away,
+// until w is closed.
+func (s *evdevSource) watchLoop(w *os.File) {
+	defer s.wg.Done()
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.Read(buf)
+		if err != nil {
+			return // closed by Stop
+		}
+
+		for _, ev := range parseInotifyEvents(buf[:n]) {
+			if ev.mask&syscall.IN_Q_OVERFLOW != 0 {
+				log.Println("Missed /dev/input changes, rescanning devices")
+				s.rescanDevices()
+				continue
+			}
+			if !strings.HasPrefix(ev.name, "event") {
+				continue
+			}
+
+			path := filepath.Join(inputDir, ev.name)
+			switch {
+			case ev.mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0:
+				if s.removeDevice(path, nil) {
+					log.Printf("Removed %s", path)
+				}
+			case ev.mask&(syscall.IN_CREATE|syscall.IN_ATTRIB|syscall.IN_MOVED_TO) != 0:
+				_, err := s.addDevice(path)
+				// Permission errors right after IN_CREATE are expected
+				// until udev applies its rules.
+				if err != nil && (ev.mask&syscall.IN_CREATE == 0 || !os.IsPermission(err)) {
+					log.Printf("Failed to open new device %s: %v", path, err)
+				}
+			}
+		}
+	}
+}
+
+// rescanDevices opens any event node that is not open yet.
+func (s *evdevSource) rescanDevices() {
+	matches, _ := filepath.Glob(filepath.Join(inputDir, "event*"))
+	for _, path := range matches {
+		if _, err := s.addDevice(path); err != nil {
+			log.Printf("Failed to open device %s: %v", path, err)
+		}
+	}
+}
+
+// parseInotifyEvents decodes the records in buf, which holds whole records as
+// returned by a read on an inotify descriptor.
+func parseInotifyEvents(buf []byte) []inotifyEvent {
+	var events []inotifyEvent
+	for len(buf) >= syscall.SizeofInotifyEvent {
+		// struct inotify_event { int wd; uint32 mask, cookie, len; char name[]; }
+		mask := binary.NativeEndian.Uint32(buf[4:8])
+		size := int(binary.NativeEndian.Uint32(buf[12:16]))
+		end := syscall.SizeofInotifyEvent + size
+		if end > len(buf) {
+			break
+		}
+		name := buf[syscall.SizeofInotifyEvent:end]
+		if i := bytes.IndexByte(name, 0); i >= 0 {
+			name = name[:i]
+		}
+		events = append(events, inotifyEvent{mask: mask, name: string(name)})
+		buf = buf[end:]
+	}
+	return events
+}
@@ -0,0 +1,44 @@
+//go:build linux
+
+package hook
+
+import (
+	"encoding/binary"
+	"syscall"
+	"testing"
+)
+
+// inotifyRecord encodes one record the way the kernel does, with the name
+// NUL-padded to pad bytes.
+func inotifyRecord(mask uint32, name string, pad int) []byte {
+	rec := make([]byte, syscall.SizeofInotifyEvent+pad)
+	binary.NativeEndian.PutUint32(rec[0:4], 1)
+	binary.NativeEndian.PutUint32(rec[4:8], mask)
+	binary.NativeEndian.PutUint32(rec[12:16], uint32(pad))
+	copy(rec[syscall.SizeofInotifyEvent:], name)
+	return rec
+}
+
+func TestParseInotifyEvents(t *testing.T) {
+	var buf []byte
+	buf = append(buf, inotifyRecord(syscall.IN_CREATE, "event7", 16)...)
+	buf = append(buf, inotifyRecord(syscall.IN_Q_OVERFLOW, "", 0)...)
+	buf = append(buf, inotifyRecord(syscall.IN_DELETE, "event12", 8)...)
+	// A truncated trailing record is ignored.
+	buf = append(buf, inotifyRecord(syscall.IN_ATTRIB, "mouse0", 16)[:20]...)
+
+	got := parseInotifyEvents(buf)
+	want := []inotifyEvent{
+		{mask: syscall.IN_CREATE, name: "event7"},
+		{mask: syscall.IN_Q_OVERFLOW, name: ""},
+		{mask: syscall.IN_DELETE, name: "event12"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d events %+v, want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("event %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,341 @@
+//go:build linux && integration
+
+package hook
+
+// End-to-end tests of the evdev hook against virtual devices created through
+// uinput. They need write access to /dev/uinput and read access to
+// /dev/input, and are skipped without them:
+//
+//	go test -tags integration ./internal/hook
+//
+// The virtual keyboards type into whatever window has focus, so run them on
+// a machine (or VM) where that does no harm.
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	evdev "github.com/holoplot/go-evdev"
+	"github.com/victortrac/busygraph/internal/input"
+	"github.com/victortrac/busygraph/internal/tracker"
+)
+
+// testDevicePrefix names every virtual device, so the hook can be limited to
+// them and the machine's real devices are left alone.
+const testDevicePrefix = "busygraph-test "
+
+// virtualDevice is a uinput device and the event node the kernel created
+// for it.
+type virtualDevice struct {
+	t    *testing.T
+	dev  *evdev.InputDevice
+	name string
+	path string
+}
+
+var (
+	keyboardCaps = map[evdev.EvType][]evdev.EvCode{
+		evdev.EV_KEY: {
+			evdev.KEY_A, evdev.KEY_B, evdev.KEY_C, evdev.KEY_1, evdev.KEY_SPACE,
+			evdev.KEY_LEFTCTRL, evdev.KEY_LEFTSHIFT, evdev.KEY_BACKSPACE,
+		},
+	}
+	mouseCaps = map[evdev.EvType][]evdev.EvCode{
+		evdev.EV_KEY: {evdev.BTN_LEFT, evdev.BTN_RIGHT, evdev.BTN_MIDDLE},
+		evdev.EV_REL: {evdev.REL_X, evdev.REL_Y, evdev.REL_WHEEL, evdev.REL_HWHEEL},
+	}
+	// A power button has keys, but is neither a keyboard nor a mouse.
+	powerButtonCaps = map[evdev.EvType][]evdev.EvCode{
+		evdev.EV_KEY: {evdev.KEY_POWER},
+	}
+)
+
+// requireUinput skips the test unless virtual devices can be created.
+func requireUinput(t *testing.T) {
+	t.Helper()
+	f, err := os.OpenFile("/dev/uinput", os.O_WRONLY, 0)
+	if err != nil {
+		t.Skipf("uinput is not available: %v", err)
+	}
+	f.Close()
+}
+
+// newVirtualDevice creates a uinput device and waits for its event node to
+// become readable. The device is removed when the test ends.
+func newVirtualDevice(t *testing.T, name string, caps map[evdev.EvType][]evdev.EvCode) *virtualDevice {
+	t.Helper()
+	name = testDevicePrefix + name
+	dev, err := evdev.CreateDevice(name, evdev.InputID{BusType: evdev.BUS_VIRTUAL, Vendor: 0x1d6b, Product: 0xbb01, Version: 1}, caps)
+	if err != nil {
+		t.Fatalf("creating %s: %v", name, err)
+	}
+	v := &virtualDevice{t: t, dev: dev, name: name}
+	t.Cleanup(v.remove)
+
+	waitFor(t, "event node of "+name, func() bool {
+		paths, _ := evdev.ListDevicePaths()
+		for _, p := range paths {
+			if p.Name != name {
+				continue
+			}
+			// udev may not have applied its permissions yet.
+			if f, err := os.Open(p.Path); err == nil {
+				f.Close()
+				v.path = p.Path
+				return true
+			}
+		}
+		return false
+	})
+	return v
+}
+
+// remove unplugs the device. It is safe to call more than once.
+func (v *virtualDevice) remove() {
+	if v.dev == nil {
+		return
+	}
+	evdev.DestroyDevice(v.dev)
+	v.dev.Close()
+	v.dev = nil
+}
+
+// send writes events followed by a SYN_REPORT, as a real device does for
+// each frame.
+func (v *virtualDevice) send(events ...evdev.InputEvent) {
+	v.t.Helper()
+	events = append(events, evdev.InputEvent{Type: evdev.EV_SYN, Code: evdev.SYN_REPORT})
+	for _, ev := range events {
+		var now syscall.Timeval
+		if err := syscall.Gettimeofday(&now); err != nil {
+			v.t.Fatal(err)
+		}
+		ev.Time = now
+		if err := v.dev.WriteOne(&ev); err != nil {
+			v.t.Fatalf("writing to %s: %v", v.name, err)
+		}
+	}
+}
+
+// tap presses and releases each key in turn.
+func (v *virtualDevice) tap(codes ...evdev.EvCode) {
+	v.t.Helper()
+	for _, c := range codes {
+		v.send(evdev.InputEvent{Type: evdev.EV_KEY, Code: c, Value: 1})
+		v.send(evdev.InputEvent{Type: evdev.EV_KEY, Code: c, Value: 0})
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after five seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// isOpen reports whether the running hook is reading path.
+func isOpen(path string) bool {
+	mu.Lock()
+	s := current
+	mu.Unlock()
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.devices[path] != nil
+}
+
+// startHook runs Start in the background. The returned function stops it
+// and returns what Start returned; it is also called when the test ends.
+func startHook(t *testing.T, sink input.Sink, o Options) (stop func() error) {
+	done := make(chan error, 1)
+	go func() { done <- Start(sink, o) }()
+
+	var once sync.Once
+	var err error
+	stop = func() error {
+		once.Do(func() {
+			Stop()
+			select {
+			case err = <-done:
+			case <-time.After(5 * time.Second):
+				err = errors.New("Start did not return after Stop")
+			}
+		})
+		return err
+	}
+	t.Cleanup(func() { stop() })
+	return stop
+}
+
+// deviceStats flushes tr and returns the stats attributed to the device
+// named name.
+func deviceStats(tr *tracker.Tracker, name string) tracker.DeviceStats {
+	tr.Flush()
+	for _, d := range tr.GetStats("1h").Devices {
+		if d.Name == name {
+			return d
+		}
+	}
+	return tracker.DeviceStats{Name: name}
+}
+
+func TestEvdevIntegration(t *testing.T) {
+	requireUinput(t)
+
+	kbd := newVirtualDevice(t, "keyboard", keyboardCaps)
+	mouse := newVirtualDevice(t, "mouse", mouseCaps)
+	power := newVirtualDevice(t, "power button", powerButtonCaps)
+
+	tr, err := tracker.Open(
+		tracker.WithDataDir(t.TempDir()),
+		tracker.WithFlushInterval(time.Hour),
+		tracker.WithoutPeers(),
+		tracker.WithoutBackgroundJobs(),
+	)
+	if err != nil {
+		t.Fatalf("tracker.Open: %v", err)
+	}
+	defer tr.Close()
+
+	rules, err := ParseDeviceRules([]string{"name:" + testDevicePrefix + "*"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := Options{Devices: rules, Shortcuts: true}
+	stop := startHook(t, tr, o)
+	waitFor(t, "the virtual keyboard and mouse to be opened", func() bool {
+		return isOpen(kbd.path) && isOpen(mouse.path)
+	})
+
+	t.Run("Classification", func(t *testing.T) {
+		for _, tc := range []struct {
+			dev  *virtualDevice
+			want deviceKind
+		}{
+			{kbd, kindKeyboard},
+			{mouse, kindMouse},
+			{power, 0},
+		} {
+			dev, err := evdev.Open(tc.dev.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := classifyDevice(dev)
+			dev.Close()
+			if got != tc.want {
+				t.Errorf("%s classified as %q, want %q", tc.dev.name, got, tc.want)
+			}
+		}
+		if isOpen(power.path) {
+			t.Errorf("%s was opened", power.name)
+		}
+	})
+
+	t.Run("Keys", func(t *testing.T) {
+		kbd.tap(evdev.KEY_A, evdev.KEY_B, evdev.KEY_1, evdev.KEY_SPACE, evdev.KEY_BACKSPACE)
+		// Ctrl+C is a shortcut, Shift+A is typing.
+		kbd.send(evdev.InputEvent{Type: evdev.EV_KEY, Code: evdev.KEY_LEFTCTRL, Value: 1})
+		kbd.tap(evdev.KEY_C)
+		kbd.send(evdev.InputEvent{Type: evdev.EV_KEY, Code: evdev.KEY_LEFTCTRL, Value: 0})
+		kbd.send(evdev.InputEvent{Type: evdev.EV_KEY, Code: evdev.KEY_LEFTSHIFT, Value: 1})
+		kbd.tap(evdev.KEY_A)
+		kbd.send(evdev.InputEvent{Type: evdev.EV_KEY, Code: evdev.KEY_LEFTSHIFT, Value: 0})
+
+		waitFor(t, "keystrokes to be recorded", func() bool {
+			return deviceStats(tr, kbd.name).Keystrokes == 9
+		})
+
+		stats := tr.GetStats("1h")
+		want := map[string]int{"a": 2, "b": 1, "1": 1, "[SPACE]": 1, "[BACKSPACE]": 1, "[CTRL]": 1, "[SHIFT]": 1}
+		got := make(map[string]int)
+		for _, k := range stats.TopKeys {
+			got[k.Key] = k.Count
+		}
+		for key, n := range want {
+			if got[key] != n {
+				t.Errorf("%s pressed %d times, want %d (top keys %+v)", key, got[key], n, stats.TopKeys)
+			}
+		}
+		if len(stats.TopShortcuts) != 1 || stats.TopShortcuts[0].Key != "[CTRL]+c" {
+			t.Errorf("shortcuts = %+v, want [CTRL]+c", stats.TopShortcuts)
+		}
+	})
+
+	t.Run("Mouse", func(t *testing.T) {
+		// One frame with both axes is a single 50px move.
+		mouse.send(
+			evdev.InputEvent{Type: evdev.EV_REL, Code: evdev.REL_X, Value: 30},
+			evdev.InputEvent{Type: evdev.EV_REL, Code: evdev.REL_Y, Value: -40},
+		)
+		mouse.send(evdev.InputEvent{Type: evdev.EV_REL, Code: evdev.REL_X, Value: -10})
+		mouse.send(evdev.InputEvent{Type: evdev.EV_REL, Code: evdev.REL_WHEEL, Value: -2})
+		mouse.send(evdev.InputEvent{Type: evdev.EV_REL, Code: evdev.REL_HWHEEL, Value: 1})
+		mouse.send(evdev.InputEvent{Type: evdev.EV_KEY, Code: evdev.BTN_LEFT, Value: 1})
+		mouse.send(evdev.InputEvent{Type: evdev.EV_KEY, Code: evdev.BTN_LEFT, Value: 0})
+		mouse.send(evdev.InputEvent{Type: evdev.EV_KEY, Code: evdev.BTN_RIGHT, Value: 1})
+		mouse.send(evdev.InputEvent{Type: evdev.EV_KEY, Code: evdev.BTN_RIGHT, Value: 0})
+
+		want := tracker.MouseStats{Distance: 60, ClicksLeft: 1, ClicksRight: 1, Scroll: 2, ScrollHorizontal: 1}
+		var got tracker.DeviceStats
+		waitFor(t, "mouse input to be recorded", func() bool {
+			got = deviceStats(tr, mouse.name)
+			return got.Mouse.ClicksRight == 1
+		})
+		if got.Mouse != want || got.Keystrokes != 0 {
+			t.Errorf("mouse stats = %+v, want %+v and no keystrokes", got, want)
+		}
+	})
+
+	t.Run("Hotplug", func(t *testing.T) {
+		plugged := newVirtualDevice(t, "hotplug keyboard", keyboardCaps)
+		waitFor(t, "the plugged keyboard to be opened", func() bool { return isOpen(plugged.path) })
+
+		plugged.tap(evdev.KEY_B, evdev.KEY_C)
+		waitFor(t, "keystrokes from the plugged keyboard", func() bool {
+			return deviceStats(tr, plugged.name).Keystrokes == 2
+		})
+
+		plugged.remove()
+		waitFor(t, "the unplugged keyboard to be closed", func() bool { return !isOpen(plugged.path) })
+	})
+
+	t.Run("Stop", func(t *testing.T) {
+		if err := stop(); err != nil {
+			t.Fatal(err)
+		}
+		if isOpen(kbd.path) || isOpen(mouse.path) {
+			t.Error("devices still open after Stop")
+		}
+
+		before := deviceStats(tr, kbd.name).Keystrokes
+		kbd.tap(evdev.KEY_A)
+		time.Sleep(200 * time.Millisecond)
+		if after := deviceStats(tr, kbd.name).Keystrokes; after != before {
+			t.Errorf("%d keystrokes recorded after Stop", after-before)
+		}
+	})
+	t.Run("Restart", func(t *testing.T) {
+		stop := startHook(t, tr, o)
+		waitFor(t, "the virtual keyboard to be opened again", func() bool { return isOpen(kbd.path) })
+
+		before := deviceStats(tr, kbd.name).Keystrokes
+		kbd.tap(evdev.KEY_B)
+		waitFor(t, "keystrokes after the restart", func() bool {
+			return deviceStats(tr, kbd.name).Keystrokes == before+1
+		})
+		if err := stop(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,19 @@
+package hook
+
+import (
+	"log"
+	"sync"
+
+	"github.com/victortrac/busygraph/internal/input"
+)
+
+// unmappedSeen holds the key codes already logged by logUnmapped.
+var unmappedSeen sync.Map
+
+// logUnmapped logs the first press of each key code without a label, so it
+// can be added to the map. Key labels are described in package input.
+func logUnmapped(code uint16, device string) {
+	if _, seen := unmappedSeen.LoadOrStore(code, true); !seen {
+		log.Printf("Key code %d on %s has no label, recording it as %s", code, device, input.UnmappedKey)
+	}
+}
@@ -0,0 +1,44 @@
+package hook
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/victortrac/busygraph/internal/input"
+)
+
+// usKeys are the keys every full-size keyboard has, labelled the same by
+// every hook.
+var usKeys = strings.Fields("a b c d e f g h i j k l m n o p q r s t u v w x y z " +
+	"1 2 3 4 5 6 7 8 9 0 - = [ ] ; ' ` \\ , . / " +
+	"[ENTER] [TAB] [BACKSPACE] [SPACE] [ESC] " +
+	"[F1] [F2] [F3] [F4] [F5] [F6] [F7] [F8] [F9] [F10] [F11] [F12] " +
+	"[INSERT] [DELETE] [HOME] [END] [PAGEUP] [PAGEDOWN] [UP] [DOWN] [LEFT] [RIGHT] " +
+	"[CTRL] [SHIFT] [ALT] [META] [CAPSLOCK] " +
+	"[KP0] [KP1] [KP2] [KP3] [KP4] [KP5] [KP6] [KP7] [KP8] [KP9] " +
+	"[KP.] [KP+] [KP-] [KP*] [KP/] [KPENTER] " +
+	"[MUTE] [VOLUMEDOWN] [VOLUMEUP] [102ND]")
+
+// checkKeyMap fails unless labels covers usKeys and every label is either
+// one of them or a bracketed name.
+func checkKeyMap(t *testing.T, labels []string) {
+	t.Helper()
+	have := make(map[string]bool, len(labels))
+	for _, l := range labels {
+		have[l] = true
+	}
+	for _, k := range usKeys {
+		if !have[k] {
+			t.Errorf("no key is labelled %q", k)
+		}
+		delete(have, k)
+	}
+	for l := range have {
+		if len(l) < 3 || l[0] != '[' || l[len(l)-1] != ']' || strings.ToUpper(l) != l {
+			t.Errorf("label %q is neither a US key nor an upper-case [NAME]", l)
+		}
+		if l == input.UnmappedKey {
+			t.Errorf("a key is labelled %s", input.UnmappedKey)
+		}
+	}
+}
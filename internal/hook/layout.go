@@ -0,0 +1,154 @@
+package hook
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Layout translates the physical key labels of keycodeMap and rawcodeMap,
+// which name keys by their position on a US keyboard, into the characters a
+// keyboard layout types on them. Only the unshifted character is recorded.
+type Layout struct {
+	Name string
+	keys map[string]string // physical label to typed label; absent keys are unchanged
+}
+
+// Translate returns the label of what the key at the physical position
+// label types.
+func (l *Layout) Translate(label string) string {
+	if l == nil {
+		return label
+	}
+	if typed, ok := l.keys[label]; ok {
+		return typed
+	}
+	return label
+}
+
+// builtinLayouts are the layouts that can be selected by name. Keys that
+// type the same as on a US keyboard are left out.
+var builtinLayouts = map[string]map[string]string{
+	"qwerty": {},
+	"dvorak": {
+		"-": "[", "=": "]",
+		"q": "'", "w": ",", "e": ".", "r": "p", "t": "y", "y": "f", "u": "g",
+		"i": "c", "o": "r", "p": "l", "[": "/", "]": "=",
+		"s": "o", "d": "e", "f": "u", "g": "i", "h": "d", "j": "h", "k": "t",
+		"l": "n", ";": "s", "'": "-",
+		"z": ";", "x": "q", "c": "j", "v": "k", "b": "x", "n": "b",
+		",": "w", ".": "v", "/": "z",
+	},
+	"colemak": {
+		"e": "f", "r": "p", "t": "g", "y": "j", "u": "l", "i": "u", "o": "y",
+		"p": ";", "s": "r", "d": "s", "f": "t", "g": "d", "j": "n", "k": "e",
+		"l": "i", ";": "o", "n": "k",
+		"[CAPSLOCK]": "[BACKSPACE]",
+	},
+	"azerty": { // French
+		"`": "²", "1": "&", "2": "é", "3": "\"", "4": "'", "5": "(", "6": "-",
+		"7": "è", "8": "_", "9": "ç", "0": "à", "-": ")",
+		"q": "a", "w": "z", "[": "^", "]": "$", "\\": "*",
+		"a": "q", ";": "m", "'": "ù",
+		"z": "w", "m": ",", ",": ";", ".": ":", "/": "!",
+		"[102ND]": "<",
+	},
+	"qwertz": { // German
+		"`": "^", "-": "ß", "=": "´",
+		"y": "z", "[": "ü", "]": "+", "\\": "#",
+		";": "ö", "'": "ä",
+		"z": "y", "/": "-",
+		"[102ND]": "<",
+	},
+}
+
+// layoutAliases are other names of built-in layouts.
+var layoutAliases = map[string]string{
+	"us": "qwerty",
+	"fr": "azerty",
+	"de": "qwertz",
+}
+
+// LayoutNames returns the names of the built-in layouts.
+func LayoutNames() []string {
+	return slices.Sorted(maps.Keys(builtinLayouts))
+}
+
+// layoutFile is the format of a custom layout file. Keys are physical
+// labels as recorded with the US layout, values what the key types.
+type layoutFile struct {
+	Base string            `toml:"base" yaml:"base"` // built-in layout the keys are changed from, qwerty if empty
+	Keys map[string]string `toml:"keys" yaml:"keys"`
+}
+
+// LoadLayout returns the built-in layout called name or, if name is a path
+// to a .toml or .yaml file, the custom layout it describes. An empty name is
+// the US layout.
+func LoadLayout(name string) (*Layout, error) {
+	if name == "" {
+		name = "qwerty"
+	}
+	if l, err := builtinLayout(name); err == nil {
+		return l, nil
+	} else if !strings.ContainsRune(name, os.PathSeparator) && filepath.Ext(name) == "" {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var f layoutFile
+	switch ext := filepath.Ext(name); ext {
+	case ".toml":
+		md, err := toml.Decode(string(data), &f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("%s: unknown key %q", name, undecoded[0].String())
+		}
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &f); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s: unsupported layout format %q (want .toml or .yaml)", name, ext)
+	}
+
+	base := f.Base
+	if base == "" {
+		base = "qwerty"
+	}
+	l, err := builtinLayout(base)
+	if err != nil {
+		return nil, fmt.Errorf("%s: base: %w", name, err)
+	}
+	l.Name = name
+	for physical, typed := range f.Keys {
+		if physical == "" || typed == "" {
+			return nil, fmt.Errorf("%s: keys: %q = %q: labels must not be empty", name, physical, typed)
+		}
+		l.keys[physical] = typed
+	}
+	return l, nil
+}
+
+// builtinLayout returns a copy of the built-in layout called name.
+func builtinLayout(name string) (*Layout, error) {
+	key := strings.ToLower(name)
+	if alias, ok := layoutAliases[key]; ok {
+		key = alias
+	}
+	keys, ok := builtinLayouts[key]
+	if !ok {
+		return nil, fmt.Errorf("unknown layout %q (built-in: %s)", name, strings.Join(LayoutNames(), ", "))
+	}
+	return &Layout{Name: key, keys: maps.Clone(keys)}, nil
+}
@@ -0,0 +1,84 @@
+package hook
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuiltinLayouts(t *testing.T) {
+	tests := []struct {
+		layout, physical, want string
+	}{
+		{"qwerty", "q", "q"},
+		{"dvorak", "q", "'"},
+		{"dvorak", "j", "h"},
+		{"Dvorak", "[ENTER]", "[ENTER]"},
+		{"colemak", "k", "e"},
+		{"colemak", "[CAPSLOCK]", "[BACKSPACE]"},
+		{"azerty", "q", "a"},
+		{"fr", "2", "é"},
+		{"qwertz", "y", "z"},
+		{"de", "[102ND]", "<"},
+	}
+	for _, tt := range tests {
+		l, err := LoadLayout(tt.layout)
+		if err != nil {
+			t.Fatalf("LoadLayout(%q): %v", tt.layout, err)
+		}
+		if got := l.Translate(tt.physical); got != tt.want {
+			t.Errorf("%s: %q types %q, want %q", tt.layout, tt.physical, got, tt.want)
+		}
+	}
+
+	// Every built-in layout is a permutation of the US keys it changes,
+	// apart from keys moved onto other functions.
+	for name, keys := range builtinLayouts {
+		for physical, typed := range keys {
+			if physical == typed {
+				t.Errorf("%s: %q is listed but unchanged", name, physical)
+			}
+		}
+	}
+
+	var none *Layout
+	if got := none.Translate("q"); got != "q" {
+		t.Errorf("nil layout translates q to %q", got)
+	}
+	if _, err := LoadLayout("bepo"); err == nil || !strings.Contains(err.Error(), "dvorak") {
+		t.Errorf("LoadLayout(bepo) = %v, want an error listing the built-in layouts", err)
+	}
+}
+
+func TestLayoutFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mine.toml")
+	content := "base = \"dvorak\"\n\n[keys]\n\"[CAPSLOCK]\" = \"[ESC]\"\nq = \"ä\"\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := LoadLayout(path)
+	if err != nil {
+		t.Fatalf("LoadLayout: %v", err)
+	}
+	for physical, want := range map[string]string{"q": "ä", "[CAPSLOCK]": "[ESC]", "j": "h", "[TAB]": "[TAB]"} {
+		if got := l.Translate(physical); got != want {
+			t.Errorf("%q types %q, want %q", physical, got, want)
+		}
+	}
+
+	// The built-in layout it is based on is not changed.
+	if got := builtinLayouts["dvorak"]["q"]; got != "'" {
+		t.Fatalf("dvorak q = %q after loading a custom layout", got)
+	}
+
+	bad := filepath.Join(dir, "bad.yaml")
+	if err := os.WriteFile(bad, []byte("base: bepo\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadLayout(bad); err == nil || !strings.Contains(err.Error(), "base:") {
+		t.Fatalf("LoadLayout(%s) = %v, want a base error", bad, err)
+	}
+}
@@ -0,0 +1,121 @@
+package hook
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/victortrac/busygraph/internal/input"
+)
+
+// Start captures input from the platform's source until Stop is called,
+// passing it to sink after applying o. It returns an error if input cannot
+// be captured.
+func Start(sink input.Sink, o Options) error {
+	return NewSource(o).Run(NewProcessor(sink, o))
+}
+
+// processor applies Options to the events of an input source: it translates
+// keys through the layout, forms shortcut chords or key categories, times key holds, and drops
+// key releases and autorepeats unless key timing is enabled. It forgets the
+// keys held on a device when the source reports it gone.
+type processor struct {
+	next input.Sink
+	o    Options
+
+	mu   sync.Mutex
+	held map[string]map[uint16]heldKey // keys down by device, then key code
+}
+
+// heldKey is a key that is down.
+type heldKey struct {
+	label string // physical label
+	since time.Time
+}
+
+// NewProcessor returns a Sink that applies o to events straight from an
+// input source before passing them to next.
+func NewProcessor(next input.Sink, o Options) input.Sink {
+	return &processor{next: next, o: o, held: make(map[string]map[uint16]heldKey)}
+}
+
+// HandleEvent processes ev and passes on what should be recorded.
+func (p *processor) HandleEvent(ev input.Event) {
+	switch ev.Kind {
+	case input.KeyDown, input.KeyUp, input.KeyRepeat:
+		if out, ok := p.key(ev); ok {
+			p.next.HandleEvent(out)
+		}
+	case input.DeviceGone:
+		// A key whose release was lost must not stay held, or a device
+		// of the same name would record false chords.
+		p.mu.Lock()
+		delete(p.held, ev.Device)
+		p.mu.Unlock()
+	default:
+		p.next.HandleEvent(ev)
+	}
+}
+
+// key processes a key event, reporting whether anything is to be recorded.
+// Sources that do not flag autorepeats (macOS) report them as another press
+// of a key that is already down.
+func (p *processor) key(ev input.Event) (input.Event, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	keys := p.held[ev.Device]
+	if keys == nil {
+		keys = make(map[uint16]heldKey)
+		p.held[ev.Device] = keys
+	}
+	k, down := keys[ev.Code]
+
+	switch {
+	case ev.Kind == input.KeyDown && !down:
+		keys[ev.Code] = heldKey{label: ev.Key, since: ev.Time}
+		out := ev
+		out.Key = p.o.Layout.Translate(ev.Key)
+		switch {
+		case p.o.KeyCategories:
+			out.Key = "[" + strings.ToUpper(input.KeyCategory(out.Key)) + "]"
+		case p.o.Shortcuts && !input.IsModifier(ev.Key):
+			out.Key = chord(heldModifiers(keys), out.Key)
+		}
+		if p.o.PhysicalKeys {
+			out.Physical = ev.Key
+		}
+		return out, true
+
+	case ev.Kind == input.KeyUp:
+		if !down {
+			return ev, false
+		}
+		delete(keys, ev.Code)
+		out := ev
+		out.Key = p.o.Layout.Translate(k.label)
+		out.Held = max(ev.Time.Sub(k.since), 0)
+		return out, p.o.KeyTiming
+
+	default: // an autorepeat
+		out := ev
+		out.Kind = input.KeyRepeat
+		out.Key = p.o.Layout.Translate(ev.Key)
+		return out, p.o.KeyTiming
+	}
+}
+
+// heldModifiers returns the chord modifiers among keys. Left and right keys
+// are tracked separately, so releasing one Ctrl while the other is down
+// keeps Ctrl held.
+func heldModifiers(keys map[uint16]heldKey) modifiers {
+	var mods modifiers
+	for _, k := range keys {
+		for _, m := range modifierLabels {
+			if k.label == m.label {
+				mods |= m.mod
+			}
+		}
+	}
+	return mods
+}
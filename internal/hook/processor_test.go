@@ -0,0 +1,146 @@
+package hook
+
+import (
+	"testing"
+	"time"
+
+	"github.com/victortrac/busygraph/internal/input"
+)
+
+// processorTest feeds key events to a processor and collects its output.
+type processorTest struct {
+	t    *testing.T
+	p    input.Sink
+	at   time.Time
+	seen []input.Event
+}
+
+func newProcessorTest(t *testing.T, o Options) *processorTest {
+	pt := &processorTest{t: t, at: time.Date(2026, 3, 10, 14, 30, 0, 0, time.UTC)}
+	pt.p = NewProcessor(input.SinkFunc(func(ev input.Event) { pt.seen = append(pt.seen, ev) }), o)
+	return pt
+}
+
+// key sends a key event 50ms after the previous one.
+func (pt *processorTest) key(kind input.Kind, code uint16, label string) {
+	pt.at = pt.at.Add(50 * time.Millisecond)
+	pt.p.HandleEvent(input.Event{Time: pt.at, Device: "kbd", Kind: kind, Code: code, Key: label})
+}
+
+// keys returns the labels of the events of kind seen so far.
+func (pt *processorTest) keys(kind input.Kind) []string {
+	var labels []string
+	for _, ev := range pt.seen {
+		if ev.Kind == kind {
+			labels = append(labels, ev.Key)
+		}
+	}
+	return labels
+}
+
+func equalLabels(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestProcessorChords(t *testing.T) {
+	dvorak, err := LoadLayout("dvorak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pt := newProcessorTest(t, Options{Shortcuts: true, Layout: dvorak})
+
+	const leftCtrl, rightCtrl, keyJ = 29, 97, 36
+	pt.key(input.KeyDown, leftCtrl, "[CTRL]")
+	pt.key(input.KeyDown, rightCtrl, "[CTRL]")
+	pt.key(input.KeyDown, keyJ, "j") // h on Dvorak
+	pt.key(input.KeyUp, keyJ, "j")
+	pt.key(input.KeyUp, leftCtrl, "[CTRL]")
+	pt.key(input.KeyDown, keyJ, "j") // right Ctrl is still down
+	pt.key(input.KeyUp, keyJ, "j")
+	pt.key(input.KeyUp, rightCtrl, "[CTRL]")
+	pt.key(input.KeyDown, keyJ, "j")
+
+	want := []string{"[CTRL]", "[CTRL]", "[CTRL]+h", "[CTRL]+h", "h"}
+	if got := pt.keys(input.KeyDown); !equalLabels(got, want) {
+		t.Errorf("presses = %q, want %q", got, want)
+	}
+	if got := pt.keys(input.KeyUp); got != nil {
+		t.Errorf("releases recorded without key timing: %q", got)
+	}
+}
+
+func TestProcessorForgetsKeysOfGoneDevice(t *testing.T) {
+	pt := newProcessorTest(t, Options{Shortcuts: true})
+
+	const leftCtrl, keyJ = 29, 36
+	pt.key(input.KeyDown, leftCtrl, "[CTRL]")
+	// The keyboard is unplugged before Ctrl is released.
+	pt.p.HandleEvent(input.Event{Time: pt.at, Device: "kbd", Kind: input.DeviceGone})
+	pt.key(input.KeyDown, keyJ, "j")
+
+	want := []string{"[CTRL]", "j"}
+	if got := pt.keys(input.KeyDown); !equalLabels(got, want) {
+		t.Errorf("presses = %q, want %q", got, want)
+	}
+	if len(pt.seen) != 2 {
+		t.Errorf("events = %+v, want only the presses", pt.seen)
+	}
+}
+
+func TestProcessorKeyTiming(t *testing.T) {
+	colemak, err := LoadLayout("colemak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pt := newProcessorTest(t, Options{KeyTiming: true, PhysicalKeys: true, Layout: colemak})
+
+	const keyE = 18
+	pt.key(input.KeyDown, keyE, "e") // f on Colemak
+	// macOS reports autorepeats as further presses of the held key.
+	pt.key(input.KeyDown, keyE, "e")
+	pt.key(input.KeyRepeat, keyE, "e")
+	pt.key(input.KeyUp, keyE, "e")
+	pt.key(input.KeyUp, keyE, "e") // a stray release is dropped
+
+	if len(pt.seen) != 4 {
+		t.Fatalf("events = %+v, want 4", pt.seen)
+	}
+	press, release := pt.seen[0], pt.seen[3]
+	if press.Kind != input.KeyDown || press.Key != "f" || press.Physical != "e" {
+		t.Errorf("press = %+v, want f at physical e", press)
+	}
+	if got := pt.keys(input.KeyRepeat); !equalLabels(got, []string{"f", "f"}) {
+		t.Errorf("repeats = %q, want two of f", got)
+	}
+	if release.Kind != input.KeyUp || release.Key != "f" || release.Held != 150*time.Millisecond {
+		t.Errorf("release = %+v, want f held for 150ms", release)
+	}
+}
+
+func TestProcessorKeyCategories(t *testing.T) {
+	pt := newProcessorTest(t, Options{KeyCategories: true, Shortcuts: true, KeyTiming: true})
+
+	const leftCtrl, keyA, key1 = 29, 30, 2
+	pt.key(input.KeyDown, leftCtrl, "[CTRL]")
+	pt.key(input.KeyDown, keyA, "a")
+	pt.key(input.KeyUp, keyA, "a")
+	pt.key(input.KeyUp, leftCtrl, "[CTRL]")
+	pt.key(input.KeyDown, key1, "1")
+
+	want := []string{"[MODIFIER]", "[LETTER]", "[DIGIT]"}
+	if got := pt.keys(input.KeyDown); !equalLabels(got, want) {
+		t.Errorf("presses = %q, want %q", got, want)
+	}
+	// Releases keep the key, which the tracker only keeps the category of.
+	if got := pt.keys(input.KeyUp); !equalLabels(got, []string{"a", "[CTRL]"}) {
+		t.Errorf("releases = %q", got)
+	}
+}
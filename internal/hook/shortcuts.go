@@ -0,0 +1,46 @@
+package hook
+
+import "strings"
+
+// modifiers is a set of held modifier keys.
+type modifiers uint8
+
+const (
+	modCtrl modifiers = 1 << iota
+	modAlt
+	modShift
+	modMeta // Cmd on macOS, Super/Windows on Linux
+)
+
+// modifierLabels lists the modifiers in the order they appear in chords.
+var modifierLabels = []struct {
+	mod   modifiers
+	label string
+}{
+	{modCtrl, "[CTRL]"},
+	{modAlt, "[ALT]"},
+	{modShift, "[SHIFT]"},
+	{modMeta, "[META]"},
+}
+
+// chord returns the label to record for key pressed while mods are held:
+// the modifiers and key joined by "+", e.g. "[CTRL]+[SHIFT]+p", or key
+// itself if the press is not a shortcut. Shift alone only makes a shortcut
+// with keys that do not type text, like [TAB] or [UP]; Shift+a is typing.
+func chord(mods modifiers, key string) string {
+	if mods == 0 {
+		return key
+	}
+	if mods == modShift && (!strings.HasPrefix(key, "[") || len(key) == 1 || key == "[SPACE]") {
+		return key
+	}
+	var b strings.Builder
+	for _, m := range modifierLabels {
+		if mods&m.mod != 0 {
+			b.WriteString(m.label)
+			b.WriteByte('+')
+		}
+	}
+	b.WriteString(key)
+	return b.String()
+}
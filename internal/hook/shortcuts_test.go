@@ -0,0 +1,29 @@
+package hook
+
+import "testing"
+
+func TestChord(t *testing.T) {
+	tests := []struct {
+		mods modifiers
+		key  string
+		want string
+	}{
+		{0, "c", "c"},
+		{modCtrl, "c", "[CTRL]+c"},
+		{modMeta, "[TAB]", "[META]+[TAB]"},
+		{modShift | modCtrl, "p", "[CTRL]+[SHIFT]+p"},
+		{modMeta | modAlt | modCtrl | modShift, "[ESC]", "[CTRL]+[ALT]+[SHIFT]+[META]+[ESC]"},
+		{modCtrl, "[", "[CTRL]+["},
+		// Shift alone is typing, except with keys that type nothing.
+		{modShift, "a", "a"},
+		{modShift, "[", "["},
+		{modShift, "[SPACE]", "[SPACE]"},
+		{modShift, "[TAB]", "[SHIFT]+[TAB]"},
+		{modShift, "[UP]", "[SHIFT]+[UP]"},
+	}
+	for _, tt := range tests {
+		if got := chord(tt.mods, tt.key); got != tt.want {
+			t.Errorf("chord(%04b, %q) = %q, want %q", tt.mods, tt.key, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+//go:build linux
+
+package hook
+
+import (
+	"math"
+	"time"
+
+	evdev "github.com/holoplot/go-evdev"
+)
+
+// Gesture thresholds, close to libinput's defaults.
+const (
+	// A touch shorter than tapTimeout that moves less than tapMaxTravel
+	// is a tap: one finger clicks left, two right and three middle.
+	tapTimeout   = 180 * time.Millisecond
+	tapMaxTravel = 2.0 // mm
+	// Two-finger movement is counted as one wheel notch per scrollNotch.
+	scrollNotch = 5.0 // mm
+)
+
+// pointerSink receives what absPointer decodes; readLoop's emitter turns it
+// into input events.
+type pointerSink interface {
+	click(button string)
+	scroll(horizontal bool, notches int16)
+	move(dx, dy float64) // in pixels
+}
+
+// absPointer decodes touchpads, touchscreens, tablets and other devices that
+// report absolute positions (EV_ABS) rather than relative motion. It follows
+// the single-touch ABS_X/ABS_Y axes, which the kernel emulates for
+// multi-touch devices, and the BTN_TOOL_* finger count.
+type absPointer struct {
+	resX, resY  float64 // units per mm, 0 if the device does not say
+	pixelsPerMM float64
+	hasTouch    bool // reports BTN_TOUCH; otherwise every movement counts
+
+	x, y         int32 // current position
+	lastX, lastY int32 // position at the previous frame of this touch
+	havePrev     bool
+
+	touching   bool
+	touchStart time.Duration // event time of BTN_TOUCH down
+	fingers    int           // fingers currently down
+	maxFingers int           // most fingers seen during this touch
+	travel     float64       // mm moved during this touch
+	pressed    bool          // a physical button was pressed during this touch
+	scrollX    float64       // mm of two-finger movement not yet counted
+	scrollY    float64
+}
+
+// newAbsPointer returns a decoder for dev, converting movement to pixels at
+// dpi.
+func newAbsPointer(dev *evdev.InputDevice, dpi float64) *absPointer {
+	p := &absPointer{pixelsPerMM: dpi / 25.4}
+	if infos, err := dev.AbsInfos(); err == nil {
+		p.resX = float64(infos[evdev.ABS_X].Resolution)
+		p.resY = float64(infos[evdev.ABS_Y].Resolution)
+	}
+	for _, c := range dev.CapableEvents(evdev.EV_KEY) {
+		if c == evdev.BTN_TOUCH {
+			p.hasTouch = true
+		}
+	}
+	return p
+}
+
+// fingerTools maps BTN_TOOL_* codes to the number of fingers they report.
+var fingerTools = map[evdev.EvCode]int{
+	evdev.BTN_TOOL_FINGER:    1,
+	evdev.BTN_TOOL_DOUBLETAP: 2,
+	evdev.BTN_TOOL_TRIPLETAP: 3,
+	evdev.BTN_TOOL_QUADTAP:   4,
+	evdev.BTN_TOOL_QUINTTAP:  5,
+}
+
+// handle processes one event.
+func (p *absPointer) handle(ev *evdev.InputEvent, out pointerSink) {
+	switch ev.Type {
+	case evdev.EV_ABS:
+		switch ev.Code {
+		case evdev.ABS_X:
+			p.x = ev.Value
+		case evdev.ABS_Y:
+			p.y = ev.Value
+		}
+
+	case evdev.EV_KEY:
+		if n, ok := fingerTools[ev.Code]; ok {
+			switch {
+			case ev.Value == 1:
+				p.fingers = n
+			case p.fingers == n:
+				p.fingers = 0
+			}
+			p.maxFingers = max(p.maxFingers, p.fingers)
+			// The emulated pointer may now follow another finger.
+			p.havePrev = false
+			return
+		}
+
+		switch ev.Code {
+		case evdev.BTN_TOUCH:
+			if ev.Value == 1 {
+				p.touching = true
+				p.touchStart = eventTime(ev)
+				p.maxFingers = p.fingers
+				p.travel = 0
+				p.pressed = false
+				p.havePrev = false
+			} else if p.touching {
+				p.touching = false
+				p.release(eventTime(ev)-p.touchStart, out)
+			}
+		case evdev.BTN_LEFT, evdev.BTN_RIGHT, evdev.BTN_MIDDLE:
+			if ev.Value == 1 {
+				p.pressed = true
+				out.click(mouseButtonMap[ev.Code])
+			}
+		}
+
+	case evdev.EV_SYN:
+		switch ev.Code {
+		case evdev.SYN_REPORT:
+			p.frame(out)
+		case evdev.SYN_DROPPED:
+			p.havePrev = false
+		}
+	}
+}
+
+// frame accounts for the movement since the previous frame.
+func (p *absPointer) frame(out pointerSink) {
+	if p.hasTouch && !p.touching {
+		return
+	}
+	if !p.havePrev {
+		p.lastX, p.lastY, p.havePrev = p.x, p.y, true
+		return
+	}
+	dx, dy := p.x-p.lastX, p.y-p.lastY
+	p.lastX, p.lastY = p.x, p.y
+	if (dx == 0 && dy == 0) || p.resX <= 0 || p.resY <= 0 {
+		return
+	}
+
+	mmX, mmY := float64(dx)/p.resX, float64(dy)/p.resY
+	p.travel += math.Hypot(mmX, mmY)
+
+	if p.fingers >= 2 {
+		if n := takeNotches(&p.scrollY, mmY); n > 0 {
+			out.scroll(false, n)
+		}
+		if n := takeNotches(&p.scrollX, mmX); n > 0 {
+			out.scroll(true, n)
+		}
+		return
+	}
+	out.move(mmX*p.pixelsPerMM, mmY*p.pixelsPerMM)
+}
+
+// takeNotches adds |mm| to acc and removes and returns the whole scroll
+// notches it holds.
+func takeNotches(acc *float64, mm float64) int16 {
+	*acc += math.Abs(mm)
+	n := math.Floor(*acc / scrollNotch)
+	*acc -= n * scrollNotch
+	return int16(n)
+}
+
+// release ends a touch that lasted d, counting it as a click if it was a tap.
+func (p *absPointer) release(d time.Duration, out pointerSink) {
+	p.scrollX, p.scrollY = 0, 0
+	if p.pressed || d > tapTimeout || p.travel > tapMaxTravel {
+		return
+	}
+	switch p.maxFingers {
+	case 0, 1: // pens and touchscreens do not report fingers
+		out.click("left")
+	case 2:
+		out.click("right")
+	case 3:
+		out.click("middle")
+	}
+}
+
+// eventTime returns the kernel timestamp of ev.
+func eventTime(ev *evdev.InputEvent) time.Duration {
+	return time.Duration(ev.Time.Nano())
+}
@@ -0,0 +1,127 @@
+//go:build linux
+
+package hook
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	evdev "github.com/holoplot/go-evdev"
+)
+
+// fakePointer records what absPointer reports.
+type fakePointer struct {
+	clicks  map[string]int
+	vscroll int
+	hscroll int
+	dist    float64
+}
+
+func (f *fakePointer) click(button string) { f.clicks[button]++ }
+func (f *fakePointer) move(dx, dy float64) { f.dist += math.Hypot(dx, dy) }
+
+func (f *fakePointer) scroll(horizontal bool, notches int16) {
+	if horizontal {
+		f.hscroll += int(notches)
+	} else {
+		f.vscroll += int(notches)
+	}
+}
+
+// replayEvemu feeds an evemu-record file through a decoder configured from
+// its axis resolutions.
+func replayEvemu(t *testing.T, name string, dpi float64) *fakePointer {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	p := &absPointer{pixelsPerMM: dpi / 25.4}
+	var events []*evdev.InputEvent
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "A:": // A: <axis> <min> <max> <fuzz> <flat> <resolution>
+			axis, _ := strconv.ParseUint(fields[1], 16, 16)
+			res, _ := strconv.ParseFloat(fields[6], 64)
+			switch evdev.EvCode(axis) {
+			case evdev.ABS_X:
+				p.resX = res
+			case evdev.ABS_Y:
+				p.resY = res
+			}
+		case "E:": // E: <sec>.<usec> <type> <code> <value>
+			secs, _ := strconv.ParseFloat(fields[1], 64)
+			ev := &evdev.InputEvent{Time: syscall.NsecToTimeval(int64(math.Round(secs*1e6)) * 1e3)}
+			typ, _ := strconv.ParseUint(fields[2], 16, 16)
+			code, _ := strconv.ParseUint(fields[3], 16, 16)
+			value, err := strconv.ParseInt(fields[4], 10, 32)
+			if err != nil {
+				t.Fatalf("%s: bad event %q: %v", name, sc.Text(), err)
+			}
+			ev.Type, ev.Code, ev.Value = evdev.EvType(typ), evdev.EvCode(code), int32(value)
+			if ev.Type == evdev.EV_KEY && ev.Code == evdev.BTN_TOUCH {
+				p.hasTouch = true
+			}
+			events = append(events, ev)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &fakePointer{clicks: map[string]int{}}
+	for _, ev := range events {
+		p.handle(ev, out)
+	}
+	return out
+}
+
+func TestAbsPointerRecordings(t *testing.T) {
+	tests := []struct {
+		file    string
+		left    int
+		right   int
+		middle  int
+		scroll  int
+		hscroll int
+		mm      float64 // pointer distance
+	}{
+		{file: "touchpad-move.evemu", mm: 10},
+		{file: "touchpad-tap.evemu", left: 1, mm: math.Hypot(0.1, 0.05)},
+		{file: "touchpad-two-finger-tap.evemu", right: 1},
+		{file: "touchpad-three-finger-tap.evemu", middle: 1},
+		{file: "touchpad-rest.evemu"},
+		{file: "touchpad-scroll.evemu", scroll: 4},
+		{file: "touchpad-hscroll.evemu", hscroll: 2},
+		{file: "clickpad-press.evemu", left: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			got := replayEvemu(t, tt.file, 254)
+			if got.clicks["left"] != tt.left || got.clicks["right"] != tt.right || got.clicks["middle"] != tt.middle {
+				t.Errorf("clicks = %v, want left %d right %d middle %d", got.clicks, tt.left, tt.right, tt.middle)
+			}
+			if got.vscroll != tt.scroll || got.hscroll != tt.hscroll {
+				t.Errorf("scroll = %d/%d, want %d/%d", got.vscroll, got.hscroll, tt.scroll, tt.hscroll)
+			}
+			// 254 DPI is 10 pixels per mm.
+			if want := tt.mm * 10; math.Abs(got.dist-want) > 1e-6 {
+				t.Errorf("distance = %.3f px, want %.3f", got.dist, want)
+			}
+		})
+	}
+}
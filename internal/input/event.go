@@ -0,0 +1,110 @@
+// Package input defines the normalized input events that flow from an input
+// source (evdev, the macOS event tap, a recorded trace) to the tracker.
+package input
+
+import (
+	"fmt"
+	"time"
+)
+
+// Kind is the type of an input event.
+type Kind uint8
+
+const (
+	KeyDown    Kind = iota + 1 // a key was pressed
+	KeyUp                      // a key was released
+	KeyRepeat                  // a held key autorepeated
+	ButtonDown                 // a mouse button was pressed, or a touchpad tapped
+	Motion                     // the pointer moved
+	Scroll                     // a wheel turned or two fingers swiped
+	DeviceGone                 // the device was removed or capture stopped; none of its keys are down
+)
+
+var kindNames = []string{
+	KeyDown:    "key_down",
+	KeyUp:      "key_up",
+	KeyRepeat:  "key_repeat",
+	ButtonDown: "button_down",
+	Motion:     "motion",
+	Scroll:     "scroll",
+	DeviceGone: "device_gone",
+}
+
+func (k Kind) String() string {
+	if int(k) < len(kindNames) && kindNames[k] != "" {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("Kind(%d)", k)
+}
+
+// MarshalText encodes k by name, so recorded traces stay readable.
+func (k Kind) MarshalText() ([]byte, error) {
+	if int(k) >= len(kindNames) || kindNames[k] == "" {
+		return nil, fmt.Errorf("invalid event kind %d", k)
+	}
+	return []byte(kindNames[k]), nil
+}
+
+// UnmarshalText decodes a kind encoded by MarshalText.
+func (k *Kind) UnmarshalText(b []byte) error {
+	for i, name := range kindNames {
+		if name != "" && name == string(b) {
+			*k = Kind(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown event kind %q", b)
+}
+
+// Event is one normalized input event. Which fields are set depends on Kind.
+type Event struct {
+	Time   time.Time `json:"time"`
+	Device string    `json:"device,omitempty"` // empty if the source cannot tell devices apart
+	Kind   Kind      `json:"kind"`
+
+	// Key events. Sources label keys by their position on a US keyboard
+	// (see keys.go); the hook's processor translates them to what was
+	// typed.
+	Code     uint16        `json:"code,omitempty"`     // platform key code
+	Key      string        `json:"key,omitempty"`      // key label
+	Physical string        `json:"physical,omitempty"` // KeyDown: physical key label, if it is to be recorded
+	Held     time.Duration `json:"held,omitempty"`     // KeyUp: how long the key was down, if measured
+
+	Button string `json:"button,omitempty"` // ButtonDown: left, right, middle, back or forward
+
+	DX float64 `json:"dx,omitempty"` // Motion, in pixels
+	DY float64 `json:"dy,omitempty"`
+
+	Notches    int16 `json:"notches,omitempty"`    // Scroll, signed
+	Horizontal bool  `json:"horizontal,omitempty"` // Scroll
+}
+
+// Sink consumes input events. Sources may call HandleEvent from several
+// goroutines at once.
+type Sink interface {
+	HandleEvent(Event)
+}
+
+// SinkFunc adapts a function to a Sink.
+type SinkFunc func(Event)
+
+// HandleEvent calls f(ev).
+func (f SinkFunc) HandleEvent(ev Event) { f(ev) }
+
+// Source produces input events.
+type Source interface {
+	// Run delivers events to sink until Stop is called or the source is
+	// exhausted.
+	Run(sink Sink) error
+	// Stop makes Run return. It may be called more than once, and before
+	// Run, which then returns at once.
+	Stop()
+}
+
+// Status describes whether a source is capturing input, for the dashboard
+// and tray.
+type Status struct {
+	Capturing bool     `json:"capturing"`
+	Devices   []string `json:"devices,omitempty"` // devices being read (Linux)
+	Error     string   `json:"error,omitempty"`   // why no input is captured
+}
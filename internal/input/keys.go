@@ -0,0 +1,99 @@
+package input
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Keys that type a character are labelled with that character, e.g. "a" or
+// ";". Other keys are labelled by name in brackets, with the same names on
+// every platform:
+//
+//	[ENTER] [TAB] [BACKSPACE] [SPACE] [ESC] [DELETE] [INSERT]
+//	[UP] [DOWN] [LEFT] [RIGHT] [HOME] [END] [PAGEUP] [PAGEDOWN]
+//	[F1] ... [F24]
+//	[CTRL] [SHIFT] [ALT] [META] [FN] [CAPSLOCK]
+//	[KP0] ... [KP9] [KP.] [KP+] [KP-] [KP*] [KP/] [KP=] [KP,] [KPENTER]
+//	[NUMLOCK] [CLEAR] [SCROLLLOCK] [PRINT] [PAUSE] [MENU] [102ND]
+//	[MUTE] [VOLUMEDOWN] [VOLUMEUP] [PLAYPAUSE] [NEXT] [PREVIOUS] ...
+//	[RO] [YEN] [KANA] [EISU] [HENKAN] [MUHENKAN] [HANGUL] [HANJA] ...
+//
+// Left and right modifiers share a name. [102ND] is the extra key of ISO
+// keyboards, whose character depends on the layout.
+
+// UnmappedKey labels a key press the input source has no label for, so the
+// keystroke still counts and the gap shows up among the top keys.
+const UnmappedKey = "[UNMAPPED]"
+
+// modifierKeys are the labels of keys that only change what other keys do.
+var modifierKeys = map[string]bool{
+	"[CTRL]":     true,
+	"[SHIFT]":    true,
+	"[ALT]":      true,
+	"[META]":     true,
+	"[FN]":       true,
+	"[CAPSLOCK]": true,
+}
+
+// IsModifier reports whether the key labelled label only changes what other
+// keys do, like Shift or Caps Lock.
+func IsModifier(label string) bool { return modifierKeys[label] }
+
+// Key hold and autorepeat timing is recorded per key category rather than
+// per key, so it says nothing about what was typed.
+const (
+	CategoryLetter     = "letter"
+	CategoryDigit      = "digit"
+	CategorySymbol     = "symbol"
+	CategoryWhitespace = "whitespace" // space, enter, tab
+	CategoryDeletion   = "deletion"   // backspace, delete
+	CategoryNavigation = "navigation" // arrows, home/end, page up/down
+	CategoryFunction   = "function"   // F1-F24, escape
+	CategoryModifier   = "modifier"
+	CategoryOther      = "other"
+)
+
+// KeyCategory returns the timing category of a key label.
+func KeyCategory(label string) string {
+	switch label {
+	case "[SPACE]", "[ENTER]", "[TAB]", "[KPENTER]":
+		return CategoryWhitespace
+	case "[BACKSPACE]", "[DELETE]":
+		return CategoryDeletion
+	case "[UP]", "[DOWN]", "[LEFT]", "[RIGHT]", "[HOME]", "[END]", "[PAGEUP]", "[PAGEDOWN]":
+		return CategoryNavigation
+	case "[ESC]":
+		return CategoryFunction
+	case "[102ND]":
+		return CategorySymbol
+	}
+	if IsModifier(label) {
+		return CategoryModifier
+	}
+	if k, ok := strings.CutPrefix(label, "[KP"); ok {
+		// Keypad keys are categorized like the key they type.
+		if k, ok := strings.CutSuffix(k, "]"); ok && utf8.RuneCountInString(k) == 1 {
+			label = k
+		}
+	}
+	if n, ok := strings.CutPrefix(label, "[F"); ok {
+		if n, ok := strings.CutSuffix(n, "]"); ok && n != "" && strings.Trim(n, "0123456789") == "" {
+			return CategoryFunction
+		}
+	}
+
+	r, size := utf8.DecodeRuneInString(label)
+	if size == 0 || size != len(label) {
+		return CategoryOther
+	}
+	switch {
+	case unicode.IsLetter(r):
+		return CategoryLetter
+	case unicode.IsDigit(r):
+		return CategoryDigit
+	case unicode.IsPrint(r):
+		return CategorySymbol
+	}
+	return CategoryOther
+}
@@ -0,0 +1,40 @@
+package input
+
+import "testing"
+
+func TestKeyCategory(t *testing.T) {
+	tests := map[string]string{
+		"a":           CategoryLetter,
+		"Z":           CategoryLetter,
+		"é":           CategoryLetter,
+		"7":           CategoryDigit,
+		";":           CategorySymbol,
+		"[":           CategorySymbol,
+		"[SPACE]":     CategoryWhitespace,
+		"[ENTER]":     CategoryWhitespace,
+		"[BACKSPACE]": CategoryDeletion,
+		"[DELETE]":    CategoryDeletion,
+		"[LEFT]":      CategoryNavigation,
+		"[PAGEDOWN]":  CategoryNavigation,
+		"[F1]":        CategoryFunction,
+		"[F12]":       CategoryFunction,
+		"[ESC]":       CategoryFunction,
+		"[KP7]":       CategoryDigit,
+		"[KP+]":       CategorySymbol,
+		"[KPENTER]":   CategoryWhitespace,
+		"[102ND]":     CategorySymbol,
+		"[F24]":       CategoryFunction,
+		"[SHIFT]":     CategoryModifier,
+		"[CAPSLOCK]":  CategoryModifier,
+		"[MUTE]":      CategoryOther,
+		"[FOO]":       CategoryOther,
+		"[F]":         CategoryOther,
+		"[INSERT]":    CategoryOther,
+		"":            CategoryOther,
+	}
+	for label, want := range tests {
+		if got := KeyCategory(label); got != want {
+			t.Errorf("KeyCategory(%q) = %q, want %q", label, got, want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package input
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// A trace is a stream of events stored as JSON Lines, one Event per line.
+// Traces include which keys were pressed, in order.
+
+// Recorder is a Sink that appends every event to a trace before passing it
+// on.
+type Recorder struct {
+	next Sink
+
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error // first write error; nothing is written after it
+}
+
+// NewRecorder returns a Recorder writing to w and forwarding events to next,
+// which may be nil.
+func NewRecorder(w io.Writer, next Sink) *Recorder {
+	return &Recorder{next: next, enc: json.NewEncoder(w)}
+}
+
+// HandleEvent records ev and passes it on.
+func (r *Recorder) HandleEvent(ev Event) {
+	r.mu.Lock()
+	if r.err == nil {
+		r.err = r.enc.Encode(ev)
+	}
+	r.mu.Unlock()
+
+	if r.next != nil {
+		r.next.HandleEvent(ev)
+	}
+}
+
+// Err returns the first error writing the trace, if any.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Replayer is a Source that plays back a trace as fast as its sink takes the
+// events, keeping their recorded timestamps.
+type Replayer struct {
+	r       io.Reader
+	stopped atomic.Bool
+}
+
+// NewReplayer returns a Replayer reading the trace from r.
+func NewReplayer(r io.Reader) *Replayer {
+	return &Replayer{r: r}
+}
+
+// Run feeds the events of the trace to sink until the trace ends or Stop is
+// called.
+func (p *Replayer) Run(sink Sink) error {
+	sc := bufio.NewScanner(p.r)
+	sc.Buffer(make([]byte, 0, 4096), 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		if p.stopped.Load() {
+			return nil
+		}
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var ev Event
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			return fmt.Errorf("trace line %d: %w", line, err)
+		}
+		if ev.Kind == 0 {
+			return fmt.Errorf("trace line %d: missing event kind", line)
+		}
+		sink.HandleEvent(ev)
+	}
+	return sc.Err()
+}
+
+// Stop makes Run return before the next event.
+func (p *Replayer) Stop() { p.stopped.Store(true) }
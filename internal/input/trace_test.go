@@ -0,0 +1,67 @@
+package input
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTraceRoundTrip(t *testing.T) {
+	at := time.Date(2026, 3, 10, 14, 30, 0, 0, time.UTC)
+	events := []Event{
+		{Time: at, Device: "kbd", Kind: KeyDown, Code: 30, Key: "a"},
+		{Time: at.Add(90 * time.Millisecond), Device: "kbd", Kind: KeyUp, Code: 30, Key: "a", Held: 90 * time.Millisecond},
+		{Time: at.Add(time.Second), Device: "mouse", Kind: ButtonDown, Button: "left"},
+		{Time: at.Add(2 * time.Second), Device: "mouse", Kind: Motion, DX: 3.5, DY: -2},
+		{Time: at.Add(3 * time.Second), Device: "mouse", Kind: Scroll, Notches: -2, Horizontal: true},
+	}
+
+	var buf bytes.Buffer
+	var forwarded int
+	rec := NewRecorder(&buf, SinkFunc(func(Event) { forwarded++ }))
+	for _, ev := range events {
+		rec.HandleEvent(ev)
+	}
+	if err := rec.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if forwarded != len(events) {
+		t.Errorf("forwarded %d events, want %d", forwarded, len(events))
+	}
+	if !strings.Contains(buf.String(), `"kind":"button_down"`) {
+		t.Errorf("trace does not name kinds:\n%s", buf.String())
+	}
+
+	var got []Event
+	if err := NewReplayer(&buf).Run(SinkFunc(func(ev Event) { got = append(got, ev) })); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(got) != len(events) {
+		t.Fatalf("replayed %d events, want %d", len(got), len(events))
+	}
+	for i := range events {
+		if !got[i].Time.Equal(events[i].Time) {
+			t.Errorf("event %d time = %v, want %v", i, got[i].Time, events[i].Time)
+		}
+		got[i].Time = events[i].Time
+		if got[i] != events[i] {
+			t.Errorf("event %d = %+v, want %+v", i, got[i], events[i])
+		}
+	}
+}
+
+func TestReplayerErrors(t *testing.T) {
+	for _, tc := range []struct {
+		trace, err string
+	}{
+		{`{"time":"2026-03-10T14:30:00Z","kind":"key_down","key":"a"}` + "\nnot json\n", "trace line 2"},
+		{`{"time":"2026-03-10T14:30:00Z","kind":"teleport"}`, "unknown event kind"},
+		{`{"time":"2026-03-10T14:30:00Z","key":"a"}`, "missing event kind"},
+	} {
+		err := NewReplayer(strings.NewReader(tc.trace)).Run(SinkFunc(func(Event) {}))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("Run(%q) = %v, want error containing %q", tc.trace, err, tc.err)
+		}
+	}
+}
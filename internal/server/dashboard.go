@@ -3,7 +3,10 @@ package server
 import (
 	"embed"
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/victortrac/busygraph/internal/tracker"
 	"github.com/victortrac/busygraph/internal/videocall"
@@ -32,11 +35,12 @@ func RegisterDashboard(mux *http.ServeMux, t *tracker.Tracker, vc videocall.Dete
 	})
 
 	mux.HandleFunc("/api/stats", func(w http.ResponseWriter, r *http.Request) {
-		timeRange := r.URL.Query().Get("range")
-		if timeRange == "" {
-			timeRange = "1h"
+		rng, err := parseRange(r, "1h", time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
-		stats := t.GetStats(timeRange)
+		stats := t.GetStatsForRange(rng)
 
 		// Add video call state to stats
 		if vc != nil {
@@ -54,6 +58,52 @@ func RegisterDashboard(mux *http.ServeMux, t *tracker.Tracker, vc videocall.Dete
 		json.NewEncoder(w).Encode(stats)
 	})
 
+	mux.HandleFunc("/api/compare", func(w http.ResponseWriter, r *http.Request) {
+		rng, err := parseRange(r, "24h", time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t.Compare(rng))
+	})
+
+	mux.HandleFunc("/api/export", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		opts := tracker.ExportOptions{Table: q.Get("table"), Format: q.Get("format")}
+		if opts.Format == "" {
+			opts.Format = "csv"
+		}
+		var err error
+		if v := q.Get("from"); v != "" {
+			if opts.From, err = tracker.ParseTime(v, false); err != nil {
+				http.Error(w, "from: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if v := q.Get("to"); v != "" {
+			if opts.To, err = tracker.ParseTime(v, true); err != nil {
+				http.Error(w, "to: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if err := opts.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if opts.Format == "csv" {
+			w.Header().Set("Content-Type", "text/csv")
+		} else {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="busygraph-%s.%s"`, opts.Table, opts.Format))
+		if err := t.Export(deadlineWriter{w, http.NewResponseController(w)}, opts); err != nil {
+			// Headers are already sent; all we can do is log.
+			log.Printf("Export of %s failed: %v", opts.Table, err)
+		}
+	})
+
 	mux.HandleFunc("/api/videocall", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		if vc != nil {
@@ -64,11 +114,12 @@ func RegisterDashboard(mux *http.ServeMux, t *tracker.Tracker, vc videocall.Dete
 	})
 
 	mux.HandleFunc("/api/videocall/stats", func(w http.ResponseWriter, r *http.Request) {
-		timeRange := r.URL.Query().Get("range")
-		if timeRange == "" {
-			timeRange = "24h"
+		rng, err := parseRange(r, "24h", time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
-		stats := t.GetVideoCallStats(timeRange)
+		stats := t.GetVideoCallStatsForRange(rng)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(stats)
 	})
@@ -79,3 +130,33 @@ func RegisterDashboard(mux *http.ServeMux, t *tracker.Tracker, vc videocall.Dete
 		json.NewEncoder(w).Encode(data)
 	})
 }
+
+// parseRange reads the stats window from the request. Either a preset
+// "range" or explicit "from"/"to" (Unix seconds, RFC 3339 or YYYY-MM-DD) may
+// be given, plus an optional "bucket" ("1m", "1h", "1d"). A missing "to"
+// means now.
+func parseRange(r *http.Request, defaultRange string, now time.Time) (tracker.Range, error) {
+	q := r.URL.Query()
+	name, from, to := q.Get("range"), q.Get("from"), q.Get("to")
+	if name == "" && from == "" && to == "" {
+		name = defaultRange
+	}
+	return tracker.ParseRange(name, from, to, q.Get("bucket"), now)
+}
+
+// exportWriteTimeout is how long a client may take to accept each part of
+// an export before it is disconnected.
+const exportWriteTimeout = 30 * time.Second
+
+// deadlineWriter extends the response's write deadline before each write,
+// so a client that stops reading does not keep an export running forever.
+type deadlineWriter struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func (d deadlineWriter) Write(p []byte) (int, error) {
+	// Not every ResponseWriter supports deadlines; the export still works.
+	d.rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+	return d.w.Write(p)
+}
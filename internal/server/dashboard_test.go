@@ -5,6 +5,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestDashboardServesNormalizedShell(t *testing.T) {
@@ -15,6 +16,8 @@ func TestDashboardServesNormalizedShell(t *testing.T) {
 		`class="dashboard-header"`,
 		`class="range-control"`,
 		`data-theme="system"`,
+		`data-delta="keystrokes"`,
+		`id="inputAlert"`,
 	} {
 		if !strings.Contains(body, marker) {
 			t.Fatalf("dashboard page missing marker %q", marker)
@@ -73,3 +76,71 @@ func fetchDashboardPage(t *testing.T, path string) string {
 
 	return rec.Body.String()
 }
+
+func TestParseRange(t *testing.T) {
+	now := time.Date(2026, 3, 10, 14, 30, 15, 0, time.Local)
+	end := time.Date(2026, 3, 10, 14, 31, 0, 0, time.Local) // end of the current minute
+
+	for _, tc := range []struct {
+		query  string
+		from   time.Time
+		to     time.Time
+		bucket time.Duration
+	}{
+		{"", end.Add(-time.Hour), end, time.Minute},
+		{"range=7d&bucket=1d", end.Add(-7 * 24 * time.Hour), end, 24 * time.Hour},
+		{"from=2026-03-03&to=2026-03-09",
+			time.Date(2026, 3, 3, 0, 0, 0, 0, time.Local), time.Date(2026, 3, 10, 0, 0, 0, 0, time.Local), time.Hour},
+		{"from=1772000000&to=1772003600&bucket=5m", time.Unix(1772000000, 0), time.Unix(1772003600, 0), 5 * time.Minute},
+		{"from=2026-03-10T09:00:00Z", time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC), now, time.Minute},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/stats?"+tc.query, nil)
+		rng, err := parseRange(req, "1h", now)
+		if err != nil {
+			t.Fatalf("parseRange(%q): %v", tc.query, err)
+		}
+		if !rng.From.Equal(tc.from) || !rng.To.Equal(tc.to) || rng.Bucket != tc.bucket {
+			t.Fatalf("parseRange(%q) = %v..%v/%v, want %v..%v/%v",
+				tc.query, rng.From, rng.To, rng.Bucket, tc.from, tc.to, tc.bucket)
+		}
+	}
+}
+
+func TestParseRangeUsesLocalMidnight(t *testing.T) {
+	defer func(loc *time.Location) { time.Local = loc }(time.Local)
+	time.Local = time.FixedZone("EST", -5*3600)
+	now := time.Date(2026, 3, 10, 14, 30, 15, 0, time.Local)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/stats?from=2026-03-03&to=2026-03-03&bucket=1d", nil)
+	rng, err := parseRange(req, "1h", now)
+	if err != nil {
+		t.Fatalf("parseRange: %v", err)
+	}
+	if from := time.Date(2026, 3, 3, 5, 0, 0, 0, time.UTC); !rng.From.Equal(from) || !rng.To.Equal(from.AddDate(0, 0, 1)) {
+		t.Fatalf("parseRange = %v..%v, want local March 3", rng.From, rng.To)
+	}
+}
+
+func TestStatsRejectsInvalidRange(t *testing.T) {
+	mux := http.NewServeMux()
+	RegisterDashboard(mux, nil, nil)
+
+	for _, query := range []string{
+		"range=2w",
+		"from=yesterday",
+		"to=2026-03-10",
+		"from=2026-03-10&to=2026-03-01",
+		"from=2026-03-01&range=7d",
+		"from=2020-01-01&to=2026-01-01&bucket=1m",
+		"range=1h&bucket=90s",
+	} {
+		for _, path := range []string{"/api/stats", "/api/videocall/stats"} {
+			req := httptest.NewRequest(http.MethodGet, path+"?"+query, nil)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("%s?%s: status %d, want 400", path, query, rec.Code)
+			}
+		}
+	}
+}
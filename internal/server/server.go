@@ -1,22 +1,74 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/victortrac/busygraph/internal/input"
 	"github.com/victortrac/busygraph/internal/tracker"
 	"github.com/victortrac/busygraph/internal/videocall"
 )
 
-// Start starts the metrics server on the given port
-func Start(addr string, t *tracker.Tracker, vc videocall.Detector) {
+// Options configures the HTTP server.
+type Options struct {
+	Addr     string
+	Metrics  bool    // serve Prometheus metrics at /metrics
+	MouseDPI float64 // used by the dashboard to show mouse distance in meters
+
+	// InputStatus reports whether input is being captured, served at
+	// /api/input. Nil omits the endpoint.
+	InputStatus func() input.Status
+}
+
+// Handler returns the handler serving metrics, the dashboard and its API.
+func Handler(t *tracker.Tracker, vc videocall.Detector, o Options) http.Handler {
 	mux := http.NewServeMux()
-	mux.Handle("/metrics", promhttp.Handler())
+	if o.Metrics {
+		mux.Handle("/metrics", promhttp.Handler())
+	}
 	RegisterDashboard(mux, t, vc)
+	mux.HandleFunc("/api/settings", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"mouse_dpi": o.MouseDPI})
+	})
+	if o.InputStatus != nil {
+		mux.HandleFunc("/api/input", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(o.InputStatus())
+		})
+	}
+	return mux
+}
 
-	log.Printf("Starting metrics server on %s", addr)
-	if err := http.ListenAndServe(addr, mux); err != nil {
-		log.Fatalf("Error starting server: %v", err)
+// Run serves until ctx is cancelled, then shuts down gracefully, giving
+// in-flight requests a few seconds to finish.
+func Run(ctx context.Context, t *tracker.Tracker, vc videocall.Detector, o Options) error {
+	srv := &http.Server{Addr: o.Addr, Handler: Handler(t, vc, o)}
+
+	errCh := make(chan error, 1)
+	go func() {
+		log.Printf("Starting metrics server on %s", o.Addr)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
 	}
+	return nil
 }
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/victortrac/busygraph/internal/input"
+)
+
+func TestRunStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- Run(ctx, nil, nil, Options{Addr: "127.0.0.1:0"}) }()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run returned %v after cancel, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
+
+func TestInputStatus(t *testing.T) {
+	status := input.Status{Error: "permission denied on 3 input devices"}
+	h := Handler(nil, nil, Options{InputStatus: func() input.Status { return status }})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/input", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status code %d", rec.Code)
+	}
+	var got input.Status
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Capturing || got.Error != status.Error {
+		t.Errorf("/api/input = %+v, want %+v", got, status)
+	}
+
+	rec = httptest.NewRecorder()
+	Handler(nil, nil, Options{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/input", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("/api/input without a status func: code %d, want 404", rec.Code)
+	}
+}
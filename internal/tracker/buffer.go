@@ -0,0 +1,366 @@
+package tracker
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/victortrac/busygraph/internal/input"
+)
+
+// Buffer aggregates input in memory into per-minute counts: keystrokes by
+// key, mouse activity, per-device totals and the typing rhythm. Nothing
+// about individual keystrokes is kept beyond the typing burst in progress.
+// A Tracker buffers its input in one until the next Flush; the input helper
+// keeps one of its own and sends what it takes to BusyGraph.
+type Buffer struct {
+	now func() time.Time
+	obs observer // told about input as it is counted, if set
+
+	// bufMu guards the buffers below. It is separate from the tracker's mu
+	// so that input events never wait on database I/O.
+	bufMu        sync.Mutex
+	keyBuf       map[keyBucket]int
+	mouseBuf     map[metricBucket]float64
+	devBuf       map[deviceBucket]float64
+	typBuf       map[metricBucket]float64
+	lastX, lastY int16 // pointer position for TrackMouseMove, -1 if unknown
+	typing       typingState
+}
+
+// NewBuffer returns an empty Buffer telling the time with now, or time.Now
+// if now is nil.
+func NewBuffer(now func() time.Time) *Buffer {
+	b := &Buffer{}
+	b.init(now)
+	return b
+}
+
+func (b *Buffer) init(now func() time.Time) {
+	if now == nil {
+		now = time.Now
+	}
+	b.now = now
+	b.keyBuf = make(map[keyBucket]int)
+	b.mouseBuf = make(map[metricBucket]float64)
+	b.devBuf = make(map[deviceBucket]float64)
+	b.typBuf = make(map[metricBucket]float64)
+	b.lastX, b.lastY = -1, -1
+}
+
+// observer is told about input as a Buffer counts it. A Tracker is one, and
+// exports it to Prometheus; the input helper's Buffer has none, so the
+// helper never touches the metrics.
+type observer interface {
+	observeKey(key, device string)
+	observeMouse(metric, device string, value float64)
+	observeInterval(gap time.Duration)
+}
+
+// Counts are the contents of a Buffer, as stored in the keystrokes,
+// mouse_metrics, device_metrics and typing_metrics tables.
+type Counts struct {
+	Keys    []KeyMinute    `json:"keys,omitempty"`
+	Mouse   []MetricMinute `json:"mouse,omitempty"`
+	Devices []DeviceMinute `json:"devices,omitempty"`
+	Typing  []MetricMinute `json:"typing,omitempty"`
+}
+
+// KeyMinute is the number of presses of one key in a minute.
+type KeyMinute struct {
+	Minute int64  `json:"minute"` // Unix time of the start of the minute
+	Key    string `json:"key"`
+	Count  int    `json:"count"`
+}
+
+// MetricMinute is the value of a metric in a minute.
+type MetricMinute struct {
+	Minute int64   `json:"minute"`
+	Metric string  `json:"metric"`
+	Value  float64 `json:"value"`
+}
+
+// DeviceMinute is the value of a metric for one input device in a minute.
+type DeviceMinute struct {
+	Minute int64   `json:"minute"`
+	Device string  `json:"device"`
+	Metric string  `json:"metric"`
+	Value  float64 `json:"value"`
+}
+
+// Empty reports whether c holds no counts.
+func (c Counts) Empty() bool {
+	return len(c.Keys) == 0 && len(c.Mouse) == 0 && len(c.Devices) == 0 && len(c.Typing) == 0
+}
+
+// Take returns the buffered counts and empties the buffer. A typing burst
+// whose last keystroke is long enough ago is ended first; one still in
+// progress stays open.
+func (b *Buffer) Take() Counts {
+	b.bufMu.Lock()
+	defer b.bufMu.Unlock()
+
+	// A burst is over once the pause after its last keystroke is long
+	// enough, even if no keystroke has come since.
+	if b.typing.keys > 0 && b.now().Sub(b.typing.last) >= burstGap {
+		b.endBurstLocked()
+	}
+
+	var c Counts
+	for k, n := range b.keyBuf {
+		c.Keys = append(c.Keys, KeyMinute{Minute: k.minute, Key: k.key, Count: n})
+	}
+	for k, v := range b.mouseBuf {
+		if v > 0 {
+			c.Mouse = append(c.Mouse, MetricMinute{Minute: k.minute, Metric: k.metric, Value: v})
+		}
+	}
+	for k, v := range b.devBuf {
+		c.Devices = append(c.Devices, DeviceMinute{Minute: k.minute, Device: k.device, Metric: k.metric, Value: v})
+	}
+	for k, v := range b.typBuf {
+		c.Typing = append(c.Typing, MetricMinute{Minute: k.minute, Metric: k.metric, Value: v})
+	}
+
+	// The pointer position is kept so distance stays continuous.
+	b.keyBuf = make(map[keyBucket]int)
+	b.mouseBuf = make(map[metricBucket]float64)
+	b.devBuf = make(map[deviceBucket]float64)
+	b.typBuf = make(map[metricBucket]float64)
+	return c
+}
+
+// Add merges counts taken from another Buffer into b.
+func (b *Buffer) Add(c Counts) {
+	b.bufMu.Lock()
+	defer b.bufMu.Unlock()
+	for _, k := range c.Keys {
+		b.keyBuf[keyBucket{minute: k.Minute, key: k.Key}] += k.Count
+	}
+	for _, m := range c.Mouse {
+		b.mouseBuf[metricBucket{minute: m.Minute, metric: m.Metric}] += m.Value
+	}
+	for _, d := range c.Devices {
+		b.devBuf[deviceBucket{minute: d.Minute, device: d.Device, metric: d.Metric}] += d.Value
+	}
+	for _, m := range c.Typing {
+		b.typBuf[metricBucket{minute: m.Minute, metric: m.Metric}] += m.Value
+	}
+}
+
+// keyBucket identifies a buffered keystroke count awaiting flush.
+type keyBucket struct {
+	minute int64
+	key    string
+}
+
+// deviceBucket identifies a buffered per-device metric awaiting flush.
+type deviceBucket struct {
+	minute int64
+	device string
+	metric string
+}
+
+// mouseButtons lists the buttons TrackMouseClick records, each as its own
+// clicks_<button> metric. Back and forward are the thumb buttons (BTN_SIDE
+// and BTN_EXTRA on Linux).
+var mouseButtons = []string{"left", "right", "middle", "back", "forward"}
+
+// DeviceInput records input attributed to one input device. Everything it
+// records also counts towards the tracker's overall totals.
+type DeviceInput struct {
+	b      *Buffer
+	device string
+}
+
+// Device returns a DeviceInput for the named keyboard or mouse. Input from
+// hooks that cannot tell devices apart goes through the Tracker methods
+// directly and is not attributed.
+func (b *Buffer) Device(name string) DeviceInput {
+	return DeviceInput{b: b, device: name}
+}
+
+// HandleEvent records an input event that has been through the hook's
+// processor, attributed to ev.Device: key presses count as keystrokes, and
+// key releases with a hold time and autorepeats feed key timing.
+func (b *Buffer) HandleEvent(ev input.Event) {
+	in := b.Device(ev.Device)
+	switch ev.Kind {
+	case input.KeyDown:
+		in.IncrementAt(ev.Key, ev.Time)
+		if ev.Physical != "" {
+			in.TrackKeyPosition(ev.Physical)
+		}
+	case input.KeyUp:
+		if ev.Held > 0 {
+			in.TrackKeyHold(input.KeyCategory(ev.Key), ev.Held)
+		}
+	case input.KeyRepeat:
+		in.TrackKeyRepeat(input.KeyCategory(ev.Key))
+	case input.ButtonDown:
+		in.TrackMouseClick(ev.Button)
+	case input.Motion:
+		in.TrackMouseDistance(math.Hypot(ev.DX, ev.DY))
+	case input.Scroll:
+		if ev.Horizontal {
+			in.TrackMouseHScroll(ev.Notches)
+		} else {
+			in.TrackMouseScroll(ev.Notches)
+		}
+	}
+}
+
+// Increment is Buffer.Increment attributed to the device.
+func (d DeviceInput) Increment(key string) { d.b.increment(d.device, key, d.b.now()) }
+
+// IncrementAt is Buffer.IncrementAt attributed to the device.
+func (d DeviceInput) IncrementAt(key string, at time.Time) { d.b.increment(d.device, key, at) }
+
+// TrackMouseClick is Buffer.TrackMouseClick attributed to the device.
+func (d DeviceInput) TrackMouseClick(button string) { d.b.trackMouseClick(d.device, button) }
+
+// TrackMouseScroll is Buffer.TrackMouseScroll attributed to the device.
+func (d DeviceInput) TrackMouseScroll(amount int16) { d.b.trackMouseScroll(d.device, "scroll", amount) }
+
+// TrackMouseHScroll is Buffer.TrackMouseHScroll attributed to the device.
+func (d DeviceInput) TrackMouseHScroll(amount int16) {
+	d.b.trackMouseScroll(d.device, "scroll_horizontal", amount)
+}
+
+// TrackMouseMove is Buffer.TrackMouseMove attributed to the device.
+func (d DeviceInput) TrackMouseMove(x, y int16) { d.b.trackMouseMove(d.device, x, y) }
+
+// TrackMouseDistance is Buffer.TrackMouseDistance attributed to the device.
+func (d DeviceInput) TrackMouseDistance(pixels float64) { d.b.trackMouseDistance(d.device, pixels) }
+
+// TrackMouseClick counts a press of "left", "right", "middle", "back" or
+// "forward"; other buttons are ignored.
+func (b *Buffer) TrackMouseClick(button string) {
+	b.trackMouseClick("", button)
+}
+
+// TrackMouseScroll counts vertical wheel notches in either direction.
+func (b *Buffer) TrackMouseScroll(amount int16) {
+	b.trackMouseScroll("", "scroll", amount)
+}
+
+// TrackMouseHScroll counts horizontal wheel notches (tilt wheels, thumb
+// wheels, sideways swipes) in either direction.
+func (b *Buffer) TrackMouseHScroll(amount int16) {
+	b.trackMouseScroll("", "scroll_horizontal", amount)
+}
+
+func (b *Buffer) TrackMouseMove(x, y int16) {
+	b.trackMouseMove("", x, y)
+}
+
+// TrackMouseDistance adds pointer travel measured by the caller, for devices
+// such as touchpads that report positions in their own units rather than
+// screen coordinates. It does not affect the position TrackMouseMove
+// measures from.
+func (b *Buffer) TrackMouseDistance(pixels float64) {
+	b.trackMouseDistance("", pixels)
+}
+
+func (b *Buffer) trackMouseClick(device, button string) {
+	if !slices.Contains(mouseButtons, button) {
+		return
+	}
+	metric := "clicks_" + button
+	if b.obs != nil {
+		b.obs.observeMouse(metric, device, 1)
+	}
+
+	b.bufMu.Lock()
+	defer b.bufMu.Unlock()
+	b.addMouseMetricLocked(metric, 1)
+	b.addDeviceMetricLocked(device, metric, 1)
+}
+
+func (b *Buffer) trackMouseScroll(device, metric string, amount int16) {
+	n := math.Abs(float64(amount))
+	if b.obs != nil {
+		b.obs.observeMouse(metric, device, n)
+	}
+
+	b.bufMu.Lock()
+	defer b.bufMu.Unlock()
+	b.addMouseMetricLocked(metric, n)
+	b.addDeviceMetricLocked(device, metric, n)
+}
+
+func (b *Buffer) trackMouseMove(device string, x, y int16) {
+	b.bufMu.Lock()
+	defer b.bufMu.Unlock()
+
+	if b.lastX != -1 {
+		dx := float64(x - b.lastX)
+		dy := float64(y - b.lastY)
+		b.addDistanceLocked(device, math.Sqrt(dx*dx+dy*dy))
+	}
+	b.lastX = x
+	b.lastY = y
+}
+
+func (b *Buffer) trackMouseDistance(device string, pixels float64) {
+	b.bufMu.Lock()
+	defer b.bufMu.Unlock()
+	b.addDistanceLocked(device, pixels)
+}
+
+// addDistanceLocked adds pointer travel. The caller holds bufMu.
+func (b *Buffer) addDistanceLocked(device string, pixels float64) {
+	if pixels <= 0 {
+		return
+	}
+	if b.obs != nil {
+		b.obs.observeMouse("distance", device, pixels)
+	}
+	b.addMouseMetricLocked("distance", pixels)
+	b.addDeviceMetricLocked(device, "distance", pixels)
+}
+
+// addMouseMetricLocked buffers value in the current minute. The caller holds
+// bufMu.
+func (b *Buffer) addMouseMetricLocked(metric string, value float64) {
+	bucket := b.now().Truncate(time.Minute).Unix()
+	b.mouseBuf[metricBucket{minute: bucket, metric: metric}] += value
+}
+
+// addDeviceMetricLocked buffers value for device in the current minute.
+// Unattributed input is not buffered. The caller holds bufMu.
+func (b *Buffer) addDeviceMetricLocked(device, metric string, value float64) {
+	if device == "" {
+		return
+	}
+	bucket := b.now().Truncate(time.Minute).Unix()
+	b.devBuf[deviceBucket{minute: bucket, device: device, metric: metric}] += value
+}
+
+// Increment increases the keystroke counter for a specific key. The count is
+// buffered in memory until it is taken, e.g. by the tracker's next Flush.
+func (b *Buffer) Increment(key string) {
+	b.increment("", key, b.now())
+}
+
+// IncrementAt is Increment for a key pressed at the given time, as reported
+// by the input event. The time only feeds the typing rhythm; the keystroke
+// is counted in the current minute like any other.
+func (b *Buffer) IncrementAt(key string, at time.Time) {
+	b.increment("", key, at)
+}
+
+func (b *Buffer) increment(device, key string, at time.Time) {
+	if b.obs != nil {
+		b.obs.observeKey(key, device)
+	}
+
+	bucket := b.now().Truncate(time.Minute).Unix()
+
+	b.bufMu.Lock()
+	b.keyBuf[keyBucket{minute: bucket, key: key}]++
+	b.addDeviceMetricLocked(device, "keystrokes", 1)
+	b.trackKeyTimeLocked(at)
+	b.bufMu.Unlock()
+}
@@ -0,0 +1,54 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBufferCountsAddToTracker(t *testing.T) {
+	now := time.Date(2026, 3, 10, 14, 30, 0, 0, time.Local)
+	tr := openTestTracker(t, "host", now)
+
+	b := NewBuffer(func() time.Time { return now.Add(-10 * time.Second) })
+	kbd, mouse := b.Device("kbd"), b.Device("mouse")
+	kbd.IncrementAt("a", now.Add(-10*time.Second))
+	kbd.IncrementAt("b", now.Add(-9800*time.Millisecond))
+	kbd.IncrementAt("a", now.Add(-9600*time.Millisecond))
+	mouse.TrackMouseClick("left")
+	mouse.TrackMouseDistance(120)
+
+	// The burst ends once the clock has moved past the pause.
+	b.now = func() time.Time { return now }
+	c := b.Take()
+	if c.Empty() {
+		t.Fatal("Take returned no counts")
+	}
+	if again := b.Take(); !again.Empty() {
+		t.Fatalf("second Take = %+v, want nothing", again)
+	}
+
+	tr.AddCounts(c)
+	tr.Flush()
+
+	stats := tr.GetStats("1h")
+	if stats.Total != 3 {
+		t.Errorf("total = %d, want 3", stats.Total)
+	}
+	if len(stats.TopKeys) == 0 || stats.TopKeys[0].Key != "a" || stats.TopKeys[0].Count != 2 {
+		t.Errorf("top keys = %+v, want a pressed twice first", stats.TopKeys)
+	}
+	if stats.Mouse.ClicksLeft != 1 || stats.Mouse.Distance != 120 {
+		t.Errorf("mouse = %+v, want 1 left click and 120px", stats.Mouse)
+	}
+	if stats.Typing.Bursts != 1 {
+		t.Errorf("bursts = %d, want 1", stats.Typing.Bursts)
+	}
+
+	devices := make(map[string]DeviceStats)
+	for _, d := range stats.Devices {
+		devices[d.Name] = d
+	}
+	if devices["kbd"].Keystrokes != 3 || devices["mouse"].Mouse.ClicksLeft != 1 {
+		t.Errorf("devices = %+v", stats.Devices)
+	}
+}
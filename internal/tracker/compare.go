@@ -0,0 +1,80 @@
+package tracker
+
+// PeriodSummary holds the headline metrics for one window.
+type PeriodSummary struct {
+	From          int64   `json:"from"`
+	To            int64   `json:"to"`
+	Keystrokes    int     `json:"keystrokes"`
+	KPMAvg        float64 `json:"kpm_avg"`
+	KPMMax        int     `json:"kpm_max"`
+	MouseDistance float64 `json:"mouse_distance"` // Pixels
+	Clicks        int     `json:"clicks"`
+	Scroll        int     `json:"scroll"`
+	CallMinutes   int     `json:"call_minutes"`
+	BusiestHour   int     `json:"busiest_hour"` // 0-23, -1 if no data
+}
+
+// Delta is the change in a metric from the previous window to the current
+// one. Percent is nil when the previous value is zero.
+type Delta struct {
+	Absolute float64  `json:"absolute"`
+	Percent  *float64 `json:"percent"`
+}
+
+// Comparison pairs a window with the equally long window before it.
+type Comparison struct {
+	Current  PeriodSummary    `json:"current"`
+	Previous PeriodSummary    `json:"previous"`
+	Deltas   map[string]Delta `json:"deltas"` // Keyed by PeriodSummary JSON name
+}
+
+// Previous returns the window of the same length ending where r starts.
+func (r Range) Previous() Range {
+	span := r.To.Sub(r.From)
+	return Range{From: r.From.Add(-span), To: r.From, Bucket: r.Bucket}
+}
+
+// Compare computes headline metrics for r and the preceding equivalent
+// window, plus the change between them.
+func (t *Tracker) Compare(r Range) Comparison {
+	cur := summarize(t.GetStatsForRange(r))
+	prev := summarize(t.GetStatsForRange(r.Previous()))
+
+	return Comparison{
+		Current:  cur,
+		Previous: prev,
+		Deltas: map[string]Delta{
+			"keystrokes":     delta(float64(cur.Keystrokes), float64(prev.Keystrokes)),
+			"kpm_avg":        delta(cur.KPMAvg, prev.KPMAvg),
+			"kpm_max":        delta(float64(cur.KPMMax), float64(prev.KPMMax)),
+			"mouse_distance": delta(cur.MouseDistance, prev.MouseDistance),
+			"clicks":         delta(float64(cur.Clicks), float64(prev.Clicks)),
+			"scroll":         delta(float64(cur.Scroll), float64(prev.Scroll)),
+			"call_minutes":   delta(float64(cur.CallMinutes), float64(prev.CallMinutes)),
+		},
+	}
+}
+
+func summarize(s Stats) PeriodSummary {
+	return PeriodSummary{
+		From:          s.From,
+		To:            s.To,
+		Keystrokes:    s.Total,
+		KPMAvg:        s.KPM.Avg,
+		KPMMax:        s.KPM.Max,
+		MouseDistance: s.Mouse.Distance,
+		Clicks:        s.Mouse.Clicks(),
+		Scroll:        s.Mouse.Scroll,
+		CallMinutes:   s.CallMinutes,
+		BusiestHour:   s.BusiestHour,
+	}
+}
+
+func delta(cur, prev float64) Delta {
+	d := Delta{Absolute: cur - prev}
+	if prev != 0 {
+		pct := (cur - prev) / prev * 100
+		d.Percent = &pct
+	}
+	return d
+}
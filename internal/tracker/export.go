@@ -0,0 +1,266 @@
+package tracker
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportPageSize is how many rows Export reads at a time. The tracker is
+// locked only while a page is read, not while it is written.
+var exportPageSize = 5000
+
+// exportTables maps export table names to their table, columns and the
+// columns of its primary key, in export order.
+var exportTables = map[string]struct {
+	table   string
+	columns []string
+	key     []string
+}{
+	"keystrokes": {"keystrokes", []string{"host", "minute", "key_char", "count"}, []string{"minute", "key_char"}},
+	"mouse":      {"mouse_metrics", []string{"host", "minute", "metric_name", "value"}, []string{"minute", "metric_name"}},
+	"devices":    {"device_metrics", []string{"host", "minute", "device", "metric_name", "value"}, []string{"minute", "device", "metric_name"}},
+	"calls":      {"video_calls", []string{"host", "minute", "in_call", "camera_active", "microphone_active", "app"}, []string{"minute"}},
+}
+
+// ExportOptions selects what Export writes. Zero From/To leave that end of
+// the window open.
+type ExportOptions struct {
+	Table  string // keystrokes, mouse, devices or calls
+	Format string // csv or jsonl
+	From   time.Time
+	To     time.Time
+}
+
+// Validate reports whether the options name a known table and format.
+func (o ExportOptions) Validate() error {
+	if _, ok := exportTables[o.Table]; !ok {
+		return fmt.Errorf("unknown table %q (want keystrokes, mouse, devices or calls)", o.Table)
+	}
+	if o.Format != "csv" && o.Format != "jsonl" {
+		return fmt.Errorf("unknown format %q (want csv or jsonl)", o.Format)
+	}
+	if !o.From.IsZero() && !o.To.IsZero() && !o.From.Before(o.To) {
+		return errors.New("from must be before to")
+	}
+	return nil
+}
+
+// Export streams raw minute rows, including those of federated peers, to w,
+// one database after another in order of host name. Rows are read a page at
+// a time along each table's primary key, so memory use does not grow with
+// the size of the export, no page sorts more than its own rows, and a slow
+// writer does not hold up tracking.
+func (t *Tracker) Export(w io.Writer, o ExportOptions) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+	et := exportTables[o.Table]
+
+	from, to := int64(math.MinInt64), int64(math.MaxInt64)
+	if !o.From.IsZero() {
+		from = o.From.Unix()
+	}
+	if !o.To.IsZero() {
+		to = o.To.Unix()
+	}
+
+	var rw rowWriter
+	if o.Format == "csv" {
+		rw = newCSVRowWriter(w)
+	} else {
+		rw = newJSONLRowWriter(w)
+	}
+	if err := rw.header(et.columns); err != nil {
+		return err
+	}
+
+	keyIndex := make([]int, len(et.key))
+	for i, k := range et.key {
+		keyIndex[i] = slices.Index(et.columns, k)
+	}
+	for _, src := range t.exportSources() {
+		// Each page continues after the key of the last row written.
+		var after []any
+		for {
+			page, err := t.exportPage(src, et.table, et.columns, et.key, from, to, after)
+			if err != nil {
+				return fmt.Errorf("query %s of %s: %w", et.table, src.host, err)
+			}
+			for _, values := range page {
+				if err := rw.row(values); err != nil {
+					return err
+				}
+			}
+			if len(page) < exportPageSize {
+				break
+			}
+
+			last := page[len(page)-1]
+			after = make([]any, len(keyIndex))
+			for i, c := range keyIndex {
+				after[i] = last[c]
+			}
+		}
+	}
+	return rw.flush()
+}
+
+// exportSource is a database whose rows Export writes.
+type exportSource struct {
+	fname string // peer database file, or "" for the tracker's own
+	host  string
+}
+
+// exportSources returns the tracker's database and its peers, by host name.
+func (t *Tracker) exportSources() []exportSource {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sources := []exportSource{{host: t.hostname}}
+	for fname := range t.attached {
+		sources = append(sources, exportSource{fname: fname, host: strings.TrimSuffix(fname, ".db")})
+	}
+	slices.SortFunc(sources, func(a, b exportSource) int { return strings.Compare(a.host, b.host) })
+	return sources
+}
+
+// exportPage returns the next page of rows of src's table within
+// [from, to), after the key values after if given. A peer detached since
+// the export started, or without the table, has no rows.
+func (t *Tracker) exportPage(src exportSource, table string, columns, key []string, from, to int64, after []any) ([][]any, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	schema := "main"
+	if src.fname != "" {
+		var ok bool
+		if schema, ok = t.attached[src.fname]; !ok {
+			return nil, nil
+		}
+	}
+	if len(tableColumns(t.db, schema, table)) == 0 {
+		return nil, nil
+	}
+	var vcols []viewColumn
+	for _, vt := range viewTables {
+		if vt.name == table {
+			vcols = vt.columns
+		}
+	}
+
+	query := "SELECT " + strings.Join(columns, ", ") + " FROM (" + t.viewSelect(schema, src.host, table, vcols) + ")" +
+		" WHERE minute >= ? AND minute < ?"
+	args := []any{from, to}
+	if after != nil {
+		query += " AND (" + strings.Join(key, ", ") + ") > (?" + strings.Repeat(", ?", len(key)-1) + ")"
+		args = append(args, after...)
+	}
+	query += " ORDER BY " + strings.Join(key, ", ") + " LIMIT ?"
+	args = append(args, exportPageSize)
+
+	rows, err := t.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var page [][]any
+	for rows.Next() {
+		values := make([]any, len(columns))
+		ptrs := make([]any, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		page = append(page, values)
+	}
+	return page, rows.Err()
+}
+
+// rowWriter encodes exported rows in one output format.
+type rowWriter interface {
+	header(columns []string) error
+	row(values []any) error
+	flush() error
+}
+
+type csvRowWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+func newCSVRowWriter(w io.Writer) *csvRowWriter {
+	return &csvRowWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvRowWriter) header(columns []string) error {
+	c.record = make([]string, len(columns))
+	return c.w.Write(columns)
+}
+
+func (c *csvRowWriter) row(values []any) error {
+	for i, v := range values {
+		c.record[i] = formatValue(v)
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvRowWriter) flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonlRowWriter struct {
+	enc     *json.Encoder
+	columns []string
+	obj     map[string]any
+}
+
+func newJSONLRowWriter(w io.Writer) *jsonlRowWriter {
+	return &jsonlRowWriter{enc: json.NewEncoder(w)}
+}
+
+func (j *jsonlRowWriter) header(columns []string) error {
+	j.columns = columns
+	j.obj = make(map[string]any, len(columns))
+	return nil
+}
+
+func (j *jsonlRowWriter) row(values []any) error {
+	for i, v := range values {
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		j.obj[j.columns[i]] = v
+	}
+	return j.enc.Encode(j.obj)
+}
+
+func (j *jsonlRowWriter) flush() error { return nil }
+
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
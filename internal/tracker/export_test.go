@@ -0,0 +1,121 @@
+package tracker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportIncludesPeersWithHost(t *testing.T) {
+	now := time.Date(2026, 3, 10, 14, 30, 0, 0, time.UTC)
+	dir := t.TempDir()
+
+	peer := openFixtureDB(t, filepath.Join(dir, "desk.db"))
+	mustExec(t, peer, legacySchema)
+	mustExec(t, peer, `INSERT INTO keystrokes VALUES (?, 'b', 2)`, now.Add(-2*time.Minute).Unix())
+	peer.Close()
+
+	tr, err := Open(WithDataDir(dir), WithHostname("laptop"), WithoutBackgroundJobs(),
+		WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer tr.Close()
+	tr.Increment("a")
+	tr.Flush()
+
+	var buf bytes.Buffer
+	if err := tr.Export(&buf, ExportOptions{Table: "keystrokes", Format: "csv"}); err != nil {
+		t.Fatalf("Export csv: %v", err)
+	}
+	want := fmt.Sprintf("host,minute,key_char,count\ndesk,%d,b,2\nlaptop,%d,a,1\n",
+		now.Add(-2*time.Minute).Unix(), now.Unix())
+	if buf.String() != want {
+		t.Fatalf("csv export:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	// Each database is paged through on its own.
+	defer func(n int) { exportPageSize = n }(exportPageSize)
+	exportPageSize = 1
+	buf.Reset()
+	if err := tr.Export(&buf, ExportOptions{Table: "keystrokes", Format: "csv"}); err != nil {
+		t.Fatalf("Export csv in pages: %v", err)
+	}
+	if buf.String() != want {
+		t.Fatalf("csv export in pages:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	err = tr.Export(&buf, ExportOptions{Table: "keystrokes", Format: "jsonl", From: now.Add(-time.Minute)})
+	if err != nil {
+		t.Fatalf("Export jsonl: %v", err)
+	}
+	var row struct {
+		Host    string `json:"host"`
+		Minute  int64  `json:"minute"`
+		KeyChar string `json:"key_char"`
+		Count   int    `json:"count"`
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("jsonl export has %d lines, want 1:\n%s", len(lines), buf.String())
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &row); err != nil {
+		t.Fatalf("decode %q: %v", lines[0], err)
+	}
+	if row.Host != "laptop" || row.Minute != now.Unix() || row.KeyChar != "a" || row.Count != 1 {
+		t.Fatalf("jsonl row = %+v", row)
+	}
+
+	if err := tr.Export(&buf, ExportOptions{Table: "passwords", Format: "csv"}); err == nil {
+		t.Fatal("Export accepted unknown table")
+	}
+}
+
+// writerFunc is an io.Writer calling a function.
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+func TestExportReadsInPages(t *testing.T) {
+	defer func(n int) { exportPageSize = n }(exportPageSize)
+	exportPageSize = 2
+
+	now := time.Date(2026, 3, 10, 14, 30, 0, 0, time.UTC)
+	tr := openTestTracker(t, "host", now)
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		tr.Increment(k)
+	}
+	tr.now = func() time.Time { return now.Add(time.Minute) }
+	tr.Increment("a")
+	tr.Flush()
+
+	// The tracker stays usable while the export is written.
+	var buf bytes.Buffer
+	w := writerFunc(func(p []byte) (int, error) {
+		tr.GetStats("1h")
+		return buf.Write(p)
+	})
+	if err := tr.Export(w, ExportOptions{Table: "keystrokes", Format: "jsonl"}); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var row struct {
+			Minute  int64  `json:"minute"`
+			KeyChar string `json:"key_char"`
+		}
+		if err := json.Unmarshal([]byte(line), &row); err != nil {
+			t.Fatalf("decode %q: %v", line, err)
+		}
+		got = append(got, fmt.Sprintf("%d:%s", row.Minute-now.Unix(), row.KeyChar))
+	}
+	if want := "0:a 0:b 0:c 0:d 0:e 60:a"; strings.Join(got, " ") != want {
+		t.Fatalf("exported %v, want %s", got, want)
+	}
+}
@@ -0,0 +1,606 @@
+package tracker
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MergeMode says how an imported row is combined with an existing row for the
+// same minute and key.
+type MergeMode string
+
+const (
+	// MergeSum adds imported counts to existing ones, for combining data
+	// recorded on different machines.
+	MergeSum MergeMode = "sum"
+	// MergeMax keeps the larger value, so importing data the store already
+	// has (e.g. an older copy of the same database) changes nothing.
+	MergeMax MergeMode = "max"
+)
+
+// ImportOptions controls Import.
+type ImportOptions struct {
+	Merge  MergeMode
+	DryRun bool // report what would change without writing anything
+	Force  bool // import even if the same file was imported before
+}
+
+// ImportReport describes the effect of one Import.
+type ImportReport struct {
+	Source   string              `json:"source"`
+	Skipped  bool                `json:"skipped"` // already imported and not forced
+	DryRun   bool                `json:"dry_run"`
+	Tables   []ImportTableReport `json:"tables"`
+	Warnings []string            `json:"warnings,omitempty"`
+}
+
+// ImportTableReport counts imported rows for one table. Rows from several
+// hosts for the same minute and key are merged first and count once.
+type ImportTableReport struct {
+	Table     string `json:"table"` // keystrokes, mouse, devices, typing or calls
+	Rows      int    `json:"rows"`
+	Inserted  int    `json:"inserted"`
+	Updated   int    `json:"updated"`
+	Unchanged int    `json:"unchanged"`
+}
+
+// importTable describes how rows of one minute table are staged and merged.
+type importTable struct {
+	name    string // export table name
+	table   string
+	defs    string // column definitions
+	columns []string
+	key     []string
+	// merge is the ON CONFLICT update for each mode; changed is true when
+	// merging staged row s into local row l alters l.
+	merge   map[MergeMode]string
+	changed map[MergeMode]string
+}
+
+// Call flags are always OR-ed: a minute was in a call if either side says so.
+const (
+	mergeCalls = "in_call = MAX(in_call, excluded.in_call), " +
+		"camera_active = MAX(camera_active, excluded.camera_active), " +
+		"microphone_active = MAX(microphone_active, excluded.microphone_active), " +
+		"app = COALESCE(NULLIF(app, ''), excluded.app)"
+	changedCalls = "s.in_call > l.in_call OR s.camera_active > l.camera_active OR " +
+		"s.microphone_active > l.microphone_active OR (COALESCE(l.app, '') = '' AND COALESCE(s.app, '') <> '')"
+)
+
+var importTables = []importTable{
+	{
+		name:    "keystrokes",
+		table:   "keystrokes",
+		defs:    "minute INTEGER, key_char TEXT, count INTEGER",
+		columns: []string{"minute", "key_char", "count"},
+		key:     []string{"minute", "key_char"},
+		merge: map[MergeMode]string{
+			MergeSum: "count = count + excluded.count",
+			MergeMax: "count = MAX(count, excluded.count)",
+		},
+		changed: map[MergeMode]string{
+			MergeSum: "s.count <> 0",
+			MergeMax: "s.count > l.count",
+		},
+	},
+	{
+		name:    "mouse",
+		table:   "mouse_metrics",
+		defs:    "minute INTEGER, metric_name TEXT, value REAL",
+		columns: []string{"minute", "metric_name", "value"},
+		key:     []string{"minute", "metric_name"},
+		merge: map[MergeMode]string{
+			MergeSum: "value = value + excluded.value",
+			MergeMax: "value = MAX(value, excluded.value)",
+		},
+		changed: map[MergeMode]string{
+			MergeSum: "s.value <> 0",
+			MergeMax: "s.value > l.value",
+		},
+	},
+	{
+		name:    "devices",
+		table:   "device_metrics",
+		defs:    "minute INTEGER, device TEXT, metric_name TEXT, value REAL",
+		columns: []string{"minute", "device", "metric_name", "value"},
+		key:     []string{"minute", "device", "metric_name"},
+		merge: map[MergeMode]string{
+			MergeSum: "value = value + excluded.value",
+			MergeMax: "value = MAX(value, excluded.value)",
+		},
+		changed: map[MergeMode]string{
+			MergeSum: "s.value <> 0",
+			MergeMax: "s.value > l.value",
+		},
+	},
+	{
+		// Exports leave typing metrics out, so only databases have them.
+		name:    "typing",
+		table:   "typing_metrics",
+		defs:    "minute INTEGER, metric_name TEXT, value REAL",
+		columns: []string{"minute", "metric_name", "value"},
+		key:     []string{"minute", "metric_name"},
+		merge: map[MergeMode]string{
+			MergeSum: "value = value + excluded.value",
+			MergeMax: "value = MAX(value, excluded.value)",
+		},
+		changed: map[MergeMode]string{
+			MergeSum: "s.value <> 0",
+			MergeMax: "s.value > l.value",
+		},
+	},
+	{
+		name:    "calls",
+		table:   "video_calls",
+		defs:    "minute INTEGER, in_call INTEGER, camera_active INTEGER, microphone_active INTEGER, app TEXT",
+		columns: []string{"minute", "in_call", "camera_active", "microphone_active", "app"},
+		key:     []string{"minute"},
+		merge:   map[MergeMode]string{MergeSum: mergeCalls, MergeMax: mergeCalls},
+		changed: map[MergeMode]string{MergeSum: changedCalls, MergeMax: changedCalls},
+	},
+}
+
+// upsertSQL returns an INSERT of rows into schema.table that merges with
+// existing rows using mode.
+func (it importTable) upsertSQL(schema, rows string, mode MergeMode) string {
+	key := strings.Join(it.key, ", ")
+	return fmt.Sprintf("INSERT INTO %s.%s (%s) %s ON CONFLICT(%s) DO UPDATE SET %s",
+		schema, it.table, strings.Join(it.columns, ", "), rows, key, it.merge[mode])
+}
+
+// Import merges a file produced by Export (.csv or .jsonl) or another
+// BusyGraph database (.db) into the local store. Re-importing a file with the
+// same contents is skipped unless forced, so summing imports are idempotent.
+//
+// Imported minutes that are already covered by rollups are folded into them
+// as well. Where raw retention has removed the local minutes, MergeMax cannot
+// see the old values and behaves like MergeSum.
+//
+// Rows are merged one day at a time, each day in its own transaction, so a
+// running BusyGraph can keep writing to the database during a long import.
+// An import that fails part way keeps the days already merged but is not
+// recorded, so importing the file again with MergeMax completes it.
+func (t *Tracker) Import(path string, o ImportOptions) (*ImportReport, error) {
+	if o.Merge != MergeSum && o.Merge != MergeMax {
+		return nil, fmt.Errorf("unknown merge mode %q (want sum or max)", o.Merge)
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	switch ext {
+	case ".csv", ".jsonl", ".ndjson", ".db":
+	default:
+		return nil, fmt.Errorf("%s: unsupported file type (want .csv, .jsonl or .db)", path)
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	digest, err := fileDigest(path)
+	if err != nil {
+		return nil, err
+	}
+	report := &ImportReport{Source: path, DryRun: o.DryRun}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if ext == ".db" {
+		if self, err := os.Stat(filepath.Join(t.dataDir, t.hostname+".db")); err == nil {
+			if src, err := os.Stat(path); err == nil && os.SameFile(self, src) {
+				return nil, errors.New("cannot import the local database into itself")
+			}
+		}
+	}
+
+	if !o.Force {
+		var n int
+		t.db.QueryRow(`SELECT COUNT(*) FROM main.imports WHERE digest = ?`, digest).Scan(&n)
+		if n > 0 {
+			report.Skipped = true
+			return report, nil
+		}
+	}
+
+	// Staged rows and the prior state of changed minutes live in scratch
+	// schemas. ATTACH is not allowed inside a transaction.
+	schemas := []string{"import_stage", "import_prior"}
+	for _, s := range schemas {
+		if _, err := t.db.Exec("ATTACH DATABASE ':memory:' AS " + s); err != nil {
+			return nil, fmt.Errorf("attach %s: %w", s, err)
+		}
+		defer t.db.Exec("DETACH DATABASE " + s)
+	}
+
+	var srcSelect map[string]string
+	if ext == ".db" {
+		if _, err := t.db.Exec("ATTACH DATABASE ? AS import_src", path); err != nil {
+			return nil, fmt.Errorf("attach %s: %w", path, err)
+		}
+		defer t.db.Exec("DETACH DATABASE import_src")
+		if srcSelect, err = t.importSourceSelects(report); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	for _, it := range importTables {
+		for _, s := range schemas {
+			ddl := fmt.Sprintf("CREATE TABLE %s.%s (%s, PRIMARY KEY (%s))", s, it.table, it.defs, strings.Join(it.key, ", "))
+			if _, err := t.db.Exec(ddl); err != nil {
+				return nil, fmt.Errorf("create %s.%s: %w", s, it.table, err)
+			}
+		}
+	}
+
+	// The scratch schemas are in memory, so staging does not lock the
+	// database.
+	if err := t.stageImport(path, ext, srcSelect, o.Merge); err != nil {
+		return nil, err
+	}
+
+	for _, it := range importTables {
+		r := ImportTableReport{Table: it.name}
+		on := make([]string, len(it.key))
+		for i, k := range it.key {
+			on[i] = fmt.Sprintf("l.%[1]s = s.%[1]s", k)
+		}
+		err := t.db.QueryRow(fmt.Sprintf(`
+			SELECT COUNT(*), COALESCE(SUM(l.minute IS NULL), 0), COALESCE(SUM(l.minute IS NOT NULL AND (%s)), 0)
+			FROM import_stage.%s s LEFT JOIN main.%s l ON %s`,
+			it.changed[o.Merge], it.table, it.table, strings.Join(on, " AND ")),
+		).Scan(&r.Rows, &r.Inserted, &r.Updated)
+		if err != nil {
+			return nil, fmt.Errorf("compare %s: %w", it.table, err)
+		}
+		r.Unchanged = r.Rows - r.Inserted - r.Updated
+		report.Tables = append(report.Tables, r)
+	}
+
+	if o.DryRun {
+		return report, nil
+	}
+
+	staged := make([]string, len(importTables))
+	for i, it := range importTables {
+		staged[i] = "SELECT minute FROM import_stage." + it.table
+	}
+	rows, err := t.db.Query("SELECT DISTINCT minute / 86400 * 86400 AS day FROM (" + strings.Join(staged, " UNION ALL ") + ") ORDER BY day")
+	if err != nil {
+		return nil, fmt.Errorf("list imported days: %w", err)
+	}
+	var days []int64
+	for rows.Next() {
+		var day int64
+		rows.Scan(&day)
+		days = append(days, day)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list imported days: %w", err)
+	}
+
+	for _, day := range days {
+		if err := t.mergeImportDay(day, o.Merge); err != nil {
+			return nil, fmt.Errorf("merge %s: %w", time.Unix(day, 0).UTC().Format("2006-01-02"), err)
+		}
+	}
+
+	_, err = t.db.Exec(`
+		INSERT INTO main.imports (digest, source, merge, imported_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(digest) DO UPDATE SET source = excluded.source, merge = excluded.merge, imported_at = excluded.imported_at
+	`, digest, path, string(o.Merge), t.now().Unix())
+	if err != nil {
+		return nil, fmt.Errorf("record import: %w", err)
+	}
+	log.Printf("Imported %s (%s)", path, o.Merge)
+	return report, nil
+}
+
+// stageImport reads the rows to import into the import_stage schema, from
+// the database attached as import_src using srcSelect or from the export
+// file at path. It writes outside a transaction, which would lock the local
+// database. The caller holds mu.
+func (t *Tracker) stageImport(path, ext string, srcSelect map[string]string, mode MergeMode) error {
+	if ext == ".db" {
+		for _, it := range importTables {
+			if srcSelect[it.table] == "" {
+				continue // not in the source's schema
+			}
+			if _, err := t.db.Exec(it.upsertSQL("import_stage", srcSelect[it.table], mode)); err != nil {
+				return fmt.Errorf("read %s: %w", it.table, err)
+			}
+		}
+		return nil
+	}
+
+	st, err := newStager(t.db, mode)
+	if err != nil {
+		return err
+	}
+	defer st.close()
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if ext == ".csv" {
+		err = st.readCSV(f)
+	} else {
+		err = st.readJSONL(f)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// mergeImportDay merges the staged rows of the UTC day starting at day into
+// the local tables in one transaction. The caller holds mu.
+func (t *Tracker) mergeImportDay(day int64, mode MergeMode) error {
+	tx, err := t.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Rollups only read minute rows past the watermark, so days before it
+	// that gain rows have to be refolded. Snapshot them before merging.
+	// The extra day and the five minutes before cover call starts, which
+	// depend on neighbouring minutes.
+	var watermark int64
+	tx.QueryRow(`SELECT COALESCE(MAX(value), 0) FROM main.rollup_state WHERE name = 'watermark'`).Scan(&watermark)
+	lo, hi := day, min(day+2*86400, watermark)
+	refold := lo < hi
+	if refold {
+		for _, it := range importTables {
+			if _, err := tx.Exec("DELETE FROM import_prior." + it.table); err != nil {
+				return fmt.Errorf("clear snapshot of %s: %w", it.table, err)
+			}
+			_, err := tx.Exec(fmt.Sprintf("INSERT INTO import_prior.%[1]s SELECT %[2]s FROM main.%[1]s WHERE minute >= ? AND minute < ?",
+				it.table, strings.Join(it.columns, ", ")), lo-300, hi)
+			if err != nil {
+				return fmt.Errorf("snapshot %s: %w", it.table, err)
+			}
+		}
+	}
+
+	for _, it := range importTables {
+		rows := fmt.Sprintf("SELECT %s FROM import_stage.%s WHERE minute >= ? AND minute < ?", strings.Join(it.columns, ", "), it.table)
+		if _, err := tx.Exec(it.upsertSQL("main", rows, mode), day, day+86400); err != nil {
+			return fmt.Errorf("merge %s: %w", it.table, err)
+		}
+	}
+
+	if refold {
+		for _, r := range rollupTables {
+			if r.source != "" && !slices.ContainsFunc(importTables, func(it importTable) bool { return it.table == r.source }) {
+				continue // not imported, so unchanged
+			}
+			if _, err := tx.Exec(r.refoldSQL(), lo, hi); err != nil {
+				return fmt.Errorf("refold %s: %w", r.table, err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// importSourceSelects checks the database attached as import_src and returns
+// a SELECT of each minute table it has, with fallbacks for older schemas.
+func (t *Tracker) importSourceSelects(report *ImportReport) (map[string]string, error) {
+	if !hasExpectedTables(t.db, "import_src") {
+		return nil, errors.New("not a BusyGraph database")
+	}
+	if v, err := userVersion(t.db, "import_src"); err != nil {
+		return nil, err
+	} else if v > schemaVersion {
+		report.Warnings = append(report.Warnings,
+			fmt.Sprintf("source uses schema version %d (this build: %d); newer columns are ignored", v, schemaVersion))
+	}
+
+	if len(tableColumns(t.db, "import_src", "activity_hourly")) > 0 {
+		var pruned int
+		t.db.QueryRow(`SELECT COUNT(*) FROM import_src.activity_hourly
+			WHERE hour < (SELECT MIN(minute) FROM import_src.keystrokes)`).Scan(&pruned)
+		if pruned > 0 {
+			report.Warnings = append(report.Warnings,
+				"source has rolled-up hours whose minute data was removed by raw retention; only minute data is imported")
+		}
+	}
+
+	selects := make(map[string]string)
+	for _, vt := range viewTables {
+		if len(tableColumns(t.db, "import_src", vt.name)) == 0 {
+			continue
+		}
+		sel := t.viewSelect("import_src", "", vt.name, vt.columns)
+		for _, it := range importTables {
+			if it.table == vt.name {
+				selects[it.table] = fmt.Sprintf("SELECT %s FROM (%s) WHERE true", strings.Join(it.columns, ", "), sel)
+			}
+		}
+	}
+	return selects, nil
+}
+
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("read %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// importRow is one exported row. Which fields are set decides its table.
+type importRow struct {
+	Minute           *int64   `json:"minute"`
+	KeyChar          *string  `json:"key_char"`
+	Device           *string  `json:"device"`
+	Count            *int64   `json:"count"`
+	MetricName       *string  `json:"metric_name"`
+	Value            *float64 `json:"value"`
+	InCall           *int64   `json:"in_call"`
+	CameraActive     *int64   `json:"camera_active"`
+	MicrophoneActive *int64   `json:"microphone_active"`
+	App              *string  `json:"app"`
+}
+
+// stager writes parsed rows into the import_stage schema.
+type stager struct {
+	stmts map[string]*sql.Stmt
+}
+
+func newStager(db *sql.DB, mode MergeMode) (*stager, error) {
+	st := &stager{stmts: make(map[string]*sql.Stmt)}
+	for _, it := range importTables {
+		values := "VALUES (?" + strings.Repeat(", ?", len(it.columns)-1) + ")"
+		stmt, err := db.Prepare(it.upsertSQL("import_stage", values, mode))
+		if err != nil {
+			st.close()
+			return nil, fmt.Errorf("prepare %s: %w", it.table, err)
+		}
+		st.stmts[it.name] = stmt
+	}
+	return st, nil
+}
+
+func (st *stager) close() {
+	for _, stmt := range st.stmts {
+		stmt.Close()
+	}
+}
+
+func (st *stager) add(r importRow) error {
+	if r.Minute == nil {
+		return errors.New("missing minute")
+	}
+	if *r.Minute%60 != 0 {
+		return fmt.Errorf("minute %d is not a whole minute", *r.Minute)
+	}
+
+	var err error
+	switch {
+	case r.KeyChar != nil:
+		if r.Count == nil {
+			return errors.New("keystroke row without count")
+		}
+		_, err = st.stmts["keystrokes"].Exec(*r.Minute, *r.KeyChar, *r.Count)
+	case r.Device != nil:
+		if r.MetricName == nil || r.Value == nil {
+			return errors.New("device row without metric_name or value")
+		}
+		_, err = st.stmts["devices"].Exec(*r.Minute, *r.Device, *r.MetricName, *r.Value)
+	case r.MetricName != nil:
+		if r.Value == nil {
+			return errors.New("mouse row without value")
+		}
+		_, err = st.stmts["mouse"].Exec(*r.Minute, *r.MetricName, *r.Value)
+	case r.InCall != nil:
+		app := ""
+		if r.App != nil {
+			app = *r.App
+		}
+		_, err = st.stmts["calls"].Exec(*r.Minute, *r.InCall, deref(r.CameraActive), deref(r.MicrophoneActive), app)
+	default:
+		return errors.New("row does not match keystrokes, mouse, devices or calls")
+	}
+	return err
+}
+
+func deref(p *int64) int64 {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
+
+func (st *stager) readJSONL(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var row importRow
+		if err := dec.Decode(&row); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("record %d: %w", line, err)
+		}
+		if err := st.add(row); err != nil {
+			return fmt.Errorf("record %d: %w", line, err)
+		}
+	}
+}
+
+func (st *stager) readCSV(r io.Reader) error {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("read header: %w", err)
+	}
+	cr.ReuseRecord = true
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := cr.FieldPos(0)
+		var row importRow
+		for i, name := range header {
+			if err := setCSVField(&row, name, record[i]); err != nil {
+				return fmt.Errorf("line %d: %s: %w", line, name, err)
+			}
+		}
+		if err := st.add(row); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+}
+
+func setCSVField(row *importRow, name, s string) error {
+	parseInt := func(dst **int64) error {
+		n, err := strconv.ParseInt(s, 10, 64)
+		*dst = &n
+		return err
+	}
+	switch name {
+	case "minute":
+		return parseInt(&row.Minute)
+	case "count":
+		return parseInt(&row.Count)
+	case "in_call":
+		return parseInt(&row.InCall)
+	case "camera_active":
+		return parseInt(&row.CameraActive)
+	case "microphone_active":
+		return parseInt(&row.MicrophoneActive)
+	case "value":
+		v, err := strconv.ParseFloat(s, 64)
+		row.Value = &v
+		return err
+	case "key_char":
+		row.KeyChar = &s
+	case "device":
+		row.Device = &s
+	case "metric_name":
+		row.MetricName = &s
+	case "app":
+		row.App = &s
+	}
+	return nil
+}
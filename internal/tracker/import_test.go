@@ -0,0 +1,175 @@
+package tracker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestImportMergesOverlappingMinutes(t *testing.T) {
+	now := time.Date(2026, 3, 10, 14, 30, 0, 0, time.UTC)
+	m1 := now.Add(-3 * time.Minute).Unix()
+	m2 := now.Add(-2 * time.Minute).Unix()
+	m3 := now.Add(-time.Minute).Unix()
+
+	// Two hosts overlap on m1; an export with both is merged before it
+	// meets the local row.
+	src := filepath.Join(t.TempDir(), "export.csv")
+	csv := "host,minute,key_char,count\n" +
+		"desk," + fmt.Sprint(m1) + ",a,3\n" +
+		"laptop," + fmt.Sprint(m1) + ",a,1\n" +
+		"desk," + fmt.Sprint(m3) + ",b,1\n"
+	if err := os.WriteFile(src, []byte(csv), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		mode  MergeMode
+		wantA int
+	}{
+		{MergeSum, 2 + 3 + 1},
+		{MergeMax, 3},
+	} {
+		t.Run(string(tc.mode), func(t *testing.T) {
+			tr := openTestTracker(t, "host", now)
+			mustExec(t, tr.db, `INSERT INTO keystrokes VALUES (?, 'a', 2)`, m1)
+			mustExec(t, tr.db, `INSERT INTO keystrokes VALUES (?, 'a', 1)`, m2)
+
+			want := ImportTableReport{Table: "keystrokes", Rows: 2, Inserted: 1, Updated: 1}
+			report, err := tr.Import(src, ImportOptions{Merge: tc.mode, DryRun: true})
+			if err != nil {
+				t.Fatalf("dry run: %v", err)
+			}
+			if report.Tables[0] != want {
+				t.Fatalf("dry run report = %+v, want %+v", report.Tables[0], want)
+			}
+			if got := keyCount(t, tr, m1, "a"); got != 2 {
+				t.Fatalf("dry run changed m1 to %d", got)
+			}
+
+			if report, err = tr.Import(src, ImportOptions{Merge: tc.mode}); err != nil {
+				t.Fatalf("Import: %v", err)
+			}
+			if report.Tables[0] != want {
+				t.Fatalf("report = %+v, want %+v", report.Tables[0], want)
+			}
+			if got := keyCount(t, tr, m1, "a"); got != tc.wantA {
+				t.Fatalf("m1 a = %d, want %d", got, tc.wantA)
+			}
+			if keyCount(t, tr, m2, "a") != 1 || keyCount(t, tr, m3, "b") != 1 {
+				t.Fatal("non-overlapping minutes not preserved")
+			}
+
+			if report, err = tr.Import(src, ImportOptions{Merge: tc.mode}); err != nil || !report.Skipped {
+				t.Fatalf("second import = %+v, %v; want skipped", report, err)
+			}
+			if got := keyCount(t, tr, m1, "a"); got != tc.wantA {
+				t.Fatalf("m1 a after second import = %d, want %d", got, tc.wantA)
+			}
+		})
+	}
+}
+
+func TestImportDatabaseFoldsIntoRollups(t *testing.T) {
+	now := time.Date(2026, 3, 10, 14, 30, 0, 0, time.UTC)
+	old := now.Add(-5 * 24 * time.Hour).Unix()
+
+	// A legacy database whose call continues the local one.
+	src := filepath.Join(t.TempDir(), "busygraph.db")
+	db := openFixtureDB(t, src)
+	mustExec(t, db, legacySchema)
+	insertFixtureRows(t, db, old+60)
+	db.Close()
+
+	tr, err := Open(WithDataDir(t.TempDir()), WithHostname("host"), WithoutBackgroundJobs(),
+		WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer tr.Close()
+	mustExec(t, tr.db, `INSERT INTO keystrokes VALUES (?, 'a', 10)`, old)
+	mustExec(t, tr.db, `INSERT INTO video_calls VALUES (?, 1, 0, 1, 'Zoom')`, old)
+	if err := tr.Rollup(); err != nil {
+		t.Fatalf("Rollup: %v", err)
+	}
+
+	report, err := tr.Import(src, ImportOptions{Merge: MergeSum})
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	for _, r := range report.Tables {
+		if r.Inserted != r.Rows || r.Updated != 0 {
+			t.Fatalf("%s report = %+v, want only inserts", r.Table, r)
+		}
+	}
+
+	for _, r := range []string{"1y", "7d"} {
+		stats := tr.GetStats(r)
+		if stats.Total != 15 || stats.Typing.Backspaces != 1 || stats.Mouse.ClicksLeft != 2 || stats.KPM.Max != 10 {
+			t.Fatalf("%s stats = total %d, backspaces %d, clicks %d, max kpm %d",
+				r, stats.Total, stats.Typing.Backspaces, stats.Mouse.ClicksLeft, stats.KPM.Max)
+		}
+	}
+	calls := tr.GetVideoCallStats("7d")
+	if calls.TotalMinutes != 2 || calls.TotalCalls != 1 || calls.CameraMinutes != 1 || calls.MicrophoneMinutes != 1 {
+		t.Fatalf("call stats = %+v", calls)
+	}
+}
+
+func TestImportDatabaseWithTypingOverSeveralDays(t *testing.T) {
+	now := time.Date(2026, 3, 10, 14, 30, 0, 0, time.UTC)
+	first := now.Add(-5 * 24 * time.Hour).Unix()  // rolled up
+	second := now.Add(-3 * 24 * time.Hour).Unix() // rolled up, two days later
+	last := now.Add(-time.Hour).Unix()            // not rolled up yet
+
+	src := filepath.Join(t.TempDir(), "old.db")
+	db := openFixtureDB(t, src)
+	if err := migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	for _, m := range []int64{first, second, last} {
+		mustExec(t, db, `INSERT INTO keystrokes VALUES (?, 'a', 4)`, m)
+		mustExec(t, db, `INSERT INTO typing_metrics VALUES (?, 'bursts', 1), (?, 'burst_keys', 4)`, m, m)
+	}
+	db.Close()
+
+	tr, err := Open(WithDataDir(t.TempDir()), WithHostname("host"), WithoutBackgroundJobs(),
+		WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer tr.Close()
+	if err := tr.Rollup(); err != nil {
+		t.Fatalf("Rollup: %v", err)
+	}
+
+	report, err := tr.Import(src, ImportOptions{Merge: MergeSum})
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	var typing ImportTableReport
+	for _, r := range report.Tables {
+		if r.Table == "typing" {
+			typing = r
+		}
+	}
+	if typing.Rows != 6 || typing.Inserted != 6 {
+		t.Fatalf("typing report = %+v, want 6 rows inserted", typing)
+	}
+
+	for _, r := range []string{"1y", "7d"} {
+		stats := tr.GetStats(r)
+		if stats.Total != 12 || stats.Typing.Bursts != 3 {
+			t.Fatalf("%s stats = total %d, bursts %d; want 12 and 3", r, stats.Total, stats.Typing.Bursts)
+		}
+	}
+}
+
+func keyCount(t *testing.T, tr *Tracker, minute int64, key string) int {
+	t.Helper()
+	var n int
+	tr.db.QueryRow(`SELECT count FROM keystrokes WHERE minute = ? AND key_char = ?`, minute, key).Scan(&n)
+	return n
+}
@@ -0,0 +1,217 @@
+package tracker
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// migration upgrades the schema by one version.
+type migration struct {
+	name string
+	up   string
+}
+
+// migrations lists every schema change in order; migrations[i] takes a
+// database from user_version i to i+1. Never edit or reorder an existing
+// entry, append a new one instead.
+var migrations = []migration{
+	{
+		// Version 0 databases were created by builds that predate
+		// user_version and may already have these tables.
+		name: "initial schema",
+		up: `
+			CREATE TABLE IF NOT EXISTS keystrokes (
+				minute INTEGER,
+				key_char TEXT,
+				count INTEGER,
+				PRIMARY KEY (minute, key_char)
+			);
+			CREATE TABLE IF NOT EXISTS mouse_metrics (
+				minute INTEGER,
+				metric_name TEXT,
+				value REAL,
+				PRIMARY KEY (minute, metric_name)
+			);
+			CREATE TABLE IF NOT EXISTS video_calls (
+				minute INTEGER PRIMARY KEY,
+				in_call INTEGER,
+				camera_active INTEGER,
+				microphone_active INTEGER,
+				app TEXT
+			);
+		`,
+	},
+	{
+		// Rollups of minute data; see rollup.go. Buckets are UTC-aligned
+		// bucket start times. The per-app call and activity tables are small
+		// enough that they are only kept at hourly resolution.
+		name: "rollup tables",
+		up: `
+			CREATE TABLE keystrokes_hourly (
+				hour INTEGER,
+				key_char TEXT,
+				count INTEGER,
+				PRIMARY KEY (hour, key_char)
+			);
+			CREATE TABLE keystrokes_daily (
+				day INTEGER,
+				key_char TEXT,
+				count INTEGER,
+				PRIMARY KEY (day, key_char)
+			);
+			CREATE TABLE mouse_metrics_hourly (
+				hour INTEGER,
+				metric_name TEXT,
+				value REAL,
+				PRIMARY KEY (hour, metric_name)
+			);
+			CREATE TABLE mouse_metrics_daily (
+				day INTEGER,
+				metric_name TEXT,
+				value REAL,
+				PRIMARY KEY (day, metric_name)
+			);
+			CREATE TABLE video_calls_hourly (
+				hour INTEGER,
+				app TEXT,
+				minutes INTEGER,
+				camera_minutes INTEGER,
+				microphone_minutes INTEGER,
+				PRIMARY KEY (hour, app)
+			);
+			CREATE TABLE activity_hourly (
+				hour INTEGER PRIMARY KEY,
+				keystrokes INTEGER,
+				active_minutes INTEGER,
+				call_minutes INTEGER,
+				call_starts INTEGER,
+				peak_kpm INTEGER
+			);
+			CREATE TABLE rollup_state (
+				name TEXT PRIMARY KEY,
+				value INTEGER
+			);
+		`,
+	},
+	{
+		// Files merged by Import, keyed by content digest, so summing
+		// imports are not applied twice.
+		name: "import log",
+		up: `
+			CREATE TABLE imports (
+				digest TEXT PRIMARY KEY,
+				source TEXT,
+				merge TEXT,
+				imported_at INTEGER
+			);
+		`,
+	},
+	{
+		// Input attributed to the keyboard or mouse it came from, using the
+		// mouse_metrics metric names plus "keystrokes". Rolled up like the
+		// other minute tables.
+		name: "device metrics",
+		up: `
+			CREATE TABLE device_metrics (
+				minute INTEGER,
+				device TEXT,
+				metric_name TEXT,
+				value REAL,
+				PRIMARY KEY (minute, device, metric_name)
+			);
+			CREATE TABLE device_metrics_hourly (
+				hour INTEGER,
+				device TEXT,
+				metric_name TEXT,
+				value REAL,
+				PRIMARY KEY (hour, device, metric_name)
+			);
+			CREATE TABLE device_metrics_daily (
+				day INTEGER,
+				device TEXT,
+				metric_name TEXT,
+				value REAL,
+				PRIMARY KEY (day, device, metric_name)
+			);
+		`,
+	},
+	{
+		// Typing rhythm: inter-key interval histogram buckets and burst
+		// totals per minute, see typing.go. Rolled up like mouse_metrics.
+		name: "typing metrics",
+		up: `
+			CREATE TABLE typing_metrics (
+				minute INTEGER,
+				metric_name TEXT,
+				value REAL,
+				PRIMARY KEY (minute, metric_name)
+			);
+			CREATE TABLE typing_metrics_hourly (
+				hour INTEGER,
+				metric_name TEXT,
+				value REAL,
+				PRIMARY KEY (hour, metric_name)
+			);
+			CREATE TABLE typing_metrics_daily (
+				day INTEGER,
+				metric_name TEXT,
+				value REAL,
+				PRIMARY KEY (day, metric_name)
+			);
+		`,
+	},
+}
+
+// schemaVersion is the user_version written by the newest migration.
+var schemaVersion = len(migrations)
+
+// migrate brings db up to schemaVersion.
+func migrate(db *sql.DB) error {
+	return migrateTo(db, schemaVersion)
+}
+
+// migrateTo applies pending migrations up to target, each in its own
+// transaction. It refuses to touch a database newer than this build.
+func migrateTo(db *sql.DB, target int) error {
+	current, err := userVersion(db, "main")
+	if err != nil {
+		return err
+	}
+	if current > schemaVersion {
+		return fmt.Errorf("database schema version %d is newer than this build supports (%d); upgrade BusyGraph", current, schemaVersion)
+	}
+
+	for v := current; v < target; v++ {
+		m := migrations[v]
+		log.Printf("Applying schema migration %d: %s", v+1, m.name)
+
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("migration %d: %w", v+1, err)
+		}
+		if _, err := tx.Exec(m.up); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d (%s): %w", v+1, m.name, err)
+		}
+		// PRAGMA does not accept bound parameters.
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", v+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: set user_version: %w", v+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d: %w", v+1, err)
+		}
+	}
+	return nil
+}
+
+// userVersion reads PRAGMA user_version for the given schema name (e.g.
+// "main" or an attached alias).
+func userVersion(db *sql.DB, schema string) (int, error) {
+	var v int
+	if err := db.QueryRow("PRAGMA " + schema + ".user_version").Scan(&v); err != nil {
+		return 0, fmt.Errorf("read %s.user_version: %w", schema, err)
+	}
+	return v, nil
+}
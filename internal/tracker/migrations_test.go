@@ -0,0 +1,139 @@
+package tracker
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// legacySchema is what builds before user_version created, reported as
+// version 0.
+const legacySchema = `
+	CREATE TABLE IF NOT EXISTS keystrokes (
+		minute INTEGER,
+		key_char TEXT,
+		count INTEGER,
+		PRIMARY KEY (minute, key_char)
+	);
+	CREATE TABLE IF NOT EXISTS mouse_metrics (
+		minute INTEGER,
+		metric_name TEXT,
+		value REAL,
+		PRIMARY KEY (minute, metric_name)
+	);
+	CREATE TABLE IF NOT EXISTS video_calls (
+		minute INTEGER PRIMARY KEY,
+		in_call INTEGER,
+		camera_active INTEGER,
+		microphone_active INTEGER,
+		app TEXT
+	);
+`
+
+// fixtureRows is valid against every historical schema version.
+var fixtureRows = []string{
+	`INSERT INTO keystrokes (minute, key_char, count) VALUES (?1, 'a', 4), (?1, '[BACKSPACE]', 1)`,
+	`INSERT INTO mouse_metrics (minute, metric_name, value) VALUES (?1, 'clicks_left', 2)`,
+	`INSERT INTO video_calls (minute, in_call, camera_active, microphone_active, app) VALUES (?1, 1, 1, 0, 'Zoom')`,
+}
+
+func TestMigrateUpgradesEveryVersion(t *testing.T) {
+	now := time.Date(2026, 3, 10, 14, 30, 0, 0, time.Local)
+	minute := now.Add(-10 * time.Minute).Unix()
+
+	for v := 0; v <= schemaVersion; v++ {
+		t.Run(fmt.Sprintf("v%d", v), func(t *testing.T) {
+			dir := t.TempDir()
+			db := openFixtureDB(t, filepath.Join(dir, "host.db"))
+			if v == 0 {
+				mustExec(t, db, legacySchema)
+			} else if err := migrateTo(db, v); err != nil {
+				t.Fatalf("migrateTo(%d): %v", v, err)
+			}
+			insertFixtureRows(t, db, minute)
+			db.Close()
+
+			tr, err := Open(WithDataDir(dir), WithHostname("host"), WithClock(func() time.Time { return now }))
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			defer tr.Close()
+
+			if got, _ := userVersion(tr.db, "main"); got != schemaVersion {
+				t.Fatalf("user_version = %d, want %d", got, schemaVersion)
+			}
+
+			stats := tr.GetStats("1h")
+			if stats.Total != 5 || stats.Typing.Backspaces != 1 || stats.Mouse.ClicksLeft != 2 {
+				t.Fatalf("stats after upgrade = total %d, backspaces %d, clicks %d",
+					stats.Total, stats.Typing.Backspaces, stats.Mouse.ClicksLeft)
+			}
+			if calls := tr.GetVideoCallStats("1h"); calls.TotalMinutes != 1 || calls.CameraMinutes != 1 {
+				t.Fatalf("call stats after upgrade = %+v", calls)
+			}
+		})
+	}
+}
+
+func TestOpenRefusesNewerSchema(t *testing.T) {
+	dir := t.TempDir()
+	db := openFixtureDB(t, filepath.Join(dir, "host.db"))
+	mustExec(t, db, legacySchema)
+	mustExec(t, db, fmt.Sprintf("PRAGMA user_version = %d", schemaVersion+1))
+	db.Close()
+
+	_, err := Open(WithDataDir(dir), WithHostname("host"))
+	if err == nil || !strings.Contains(err.Error(), "newer than this build") {
+		t.Fatalf("Open error = %v, want schema version error", err)
+	}
+}
+
+func TestViewsIncludeOlderPeers(t *testing.T) {
+	now := time.Date(2026, 3, 10, 14, 30, 0, 0, time.Local)
+	dir := t.TempDir()
+
+	peer := openFixtureDB(t, filepath.Join(dir, "peer.db"))
+	mustExec(t, peer, legacySchema)
+	insertFixtureRows(t, peer, now.Add(-time.Minute).Unix())
+	peer.Close()
+
+	tr, err := Open(WithDataDir(dir), WithHostname("host"), WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer tr.Close()
+
+	if v, _ := userVersion(tr.db, tr.attached["peer.db"]); v != 0 {
+		t.Fatalf("peer was modified: user_version = %d", v)
+	}
+	if stats := tr.GetStats("1h"); stats.Total != 5 {
+		t.Fatalf("total with peer = %d, want 5", stats.Total)
+	}
+}
+
+func openFixtureDB(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+func mustExec(t *testing.T, db *sql.DB, query string, args ...any) {
+	t.Helper()
+	if _, err := db.Exec(query, args...); err != nil {
+		t.Fatalf("exec %q: %v", strings.TrimSpace(query), err)
+	}
+}
+
+func insertFixtureRows(t *testing.T, db *sql.DB, minute int64) {
+	t.Helper()
+	for _, q := range fixtureRows {
+		mustExec(t, db, q, minute)
+	}
+}
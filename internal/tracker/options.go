@@ -0,0 +1,90 @@
+package tracker
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Option configures a Tracker created by Open or NewTracker.
+type Option func(*options)
+
+type options struct {
+	dataDir       string
+	hostname      string
+	flushInterval time.Duration
+	rollupAfter   time.Duration
+	rawRetention  time.Duration
+	peerRefresh   time.Duration
+	noPeers       bool
+	now           func() time.Time
+	noBackground  bool
+}
+
+// WithDataDir sets the directory holding <hostname>.db and any federated peer
+// databases. Defaults to $XDG_DATA_HOME/busygraph.
+func WithDataDir(dir string) Option {
+	return func(o *options) { o.dataDir = dir }
+}
+
+// WithHostname sets the name of the local database file. Defaults to
+// os.Hostname().
+func WithHostname(name string) Option {
+	return func(o *options) { o.hostname = name }
+}
+
+// WithFlushInterval sets how often buffered input is written to the database.
+// Defaults to 5 seconds.
+func WithFlushInterval(d time.Duration) Option {
+	return func(o *options) { o.flushInterval = d }
+}
+
+// WithRollupAfter sets how old minute data must be before it is folded into
+// the hourly and daily tables. Defaults to 48 hours.
+func WithRollupAfter(d time.Duration) Option {
+	return func(o *options) { o.rollupAfter = d }
+}
+
+// WithRawRetention sets how long minute data is kept once it has been rolled
+// up. Zero, the default, keeps it forever.
+func WithRawRetention(d time.Duration) Option {
+	return func(o *options) { o.rawRetention = d }
+}
+
+// WithPeerRefresh sets how often the data directory is scanned for peer
+// databases to attach or detach. The default is 30s.
+func WithPeerRefresh(d time.Duration) Option {
+	return func(o *options) { o.peerRefresh = d }
+}
+
+// WithoutPeers stops the tracker from attaching other databases in its data
+// directory, so stats cover this machine only.
+func WithoutPeers() Option {
+	return func(o *options) { o.noPeers = true }
+}
+
+// WithoutBackgroundJobs skips the flush, peer refresh and rollup loops. For
+// short-lived commands that only read or import data.
+func WithoutBackgroundJobs() Option {
+	return func(o *options) { o.noBackground = true }
+}
+
+// WithClock replaces time.Now as the tracker's source of time. Intended for
+// tests.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) { o.now = now }
+}
+
+// DefaultDataDir returns $XDG_DATA_HOME/busygraph, falling back to
+// ~/.local/share/busygraph.
+func DefaultDataDir() (string, error) {
+	dataDir := os.Getenv("XDG_DATA_HOME")
+	if dataDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dataDir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataDir, "busygraph"), nil
+}
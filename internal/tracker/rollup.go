@@ -0,0 +1,323 @@
+package tracker
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Minute data older than the rollup age is folded into hourly and daily
+// tables once per rollupInterval. Folding always advances in whole UTC days
+// and the high-water mark is kept in rollup_state, so each minute is folded
+// exactly once. Raw minute rows are only deleted (by the optional raw
+// retention) after they have been folded.
+const rollupInterval = time.Hour
+
+// rollupTable describes one rollup table and how it is derived from minute
+// data.
+type rollupTable struct {
+	table   string // rollup table, also the suffix of its all_* view
+	source  string // minute table it is derived from, if only one
+	columns string // columns in insert order
+	key     string // primary key columns
+	// live returns minute rows shaped like the rollup table for rows of
+	// schema matching cond. Rows need not be grouped.
+	live func(schema, cond string) string
+	// aggregate is the select list that groups live rows into table rows.
+	aggregate string
+	// merge is the ON CONFLICT update applied when a bucket already exists.
+	merge string
+}
+
+var rollupTables = []rollupTable{
+	{
+		table:     "keystrokes_hourly",
+		source:    "keystrokes",
+		columns:   "hour, key_char, count",
+		key:       "hour, key_char",
+		live:      liveKeystrokes(3600, "hour"),
+		aggregate: "hour, key_char, SUM(count)",
+		merge:     "count = count + excluded.count",
+	},
+	{
+		table:     "keystrokes_daily",
+		source:    "keystrokes",
+		columns:   "day, key_char, count",
+		key:       "day, key_char",
+		live:      liveKeystrokes(86400, "day"),
+		aggregate: "day, key_char, SUM(count)",
+		merge:     "count = count + excluded.count",
+	},
+	{
+		table:     "mouse_metrics_hourly",
+		source:    "mouse_metrics",
+		columns:   "hour, metric_name, value",
+		key:       "hour, metric_name",
+		live:      liveMetrics("mouse_metrics", 3600, "hour"),
+		aggregate: "hour, metric_name, SUM(value)",
+		merge:     "value = value + excluded.value",
+	},
+	{
+		table:     "mouse_metrics_daily",
+		source:    "mouse_metrics",
+		columns:   "day, metric_name, value",
+		key:       "day, metric_name",
+		live:      liveMetrics("mouse_metrics", 86400, "day"),
+		aggregate: "day, metric_name, SUM(value)",
+		merge:     "value = value + excluded.value",
+	},
+	{
+		table:     "device_metrics_hourly",
+		source:    "device_metrics",
+		columns:   "hour, device, metric_name, value",
+		key:       "hour, device, metric_name",
+		live:      liveDeviceMetrics(3600, "hour"),
+		aggregate: "hour, device, metric_name, SUM(value)",
+		merge:     "value = value + excluded.value",
+	},
+	{
+		table:     "device_metrics_daily",
+		source:    "device_metrics",
+		columns:   "day, device, metric_name, value",
+		key:       "day, device, metric_name",
+		live:      liveDeviceMetrics(86400, "day"),
+		aggregate: "day, device, metric_name, SUM(value)",
+		merge:     "value = value + excluded.value",
+	},
+	{
+		table:     "typing_metrics_hourly",
+		source:    "typing_metrics",
+		columns:   "hour, metric_name, value",
+		key:       "hour, metric_name",
+		live:      liveMetrics("typing_metrics", 3600, "hour"),
+		aggregate: "hour, metric_name, SUM(value)",
+		merge:     "value = value + excluded.value",
+	},
+	{
+		table:     "typing_metrics_daily",
+		source:    "typing_metrics",
+		columns:   "day, metric_name, value",
+		key:       "day, metric_name",
+		live:      liveMetrics("typing_metrics", 86400, "day"),
+		aggregate: "day, metric_name, SUM(value)",
+		merge:     "value = value + excluded.value",
+	},
+	{
+		table:     "video_calls_hourly",
+		source:    "video_calls",
+		columns:   "hour, app, minutes, camera_minutes, microphone_minutes",
+		key:       "hour, app",
+		live:      liveVideoCalls,
+		aggregate: "hour, app, SUM(minutes), SUM(camera_minutes), SUM(microphone_minutes)",
+		merge: "minutes = minutes + excluded.minutes, " +
+			"camera_minutes = camera_minutes + excluded.camera_minutes, " +
+			"microphone_minutes = microphone_minutes + excluded.microphone_minutes",
+	},
+	{
+		table:     "activity_hourly",
+		columns:   "hour, keystrokes, active_minutes, call_minutes, call_starts, peak_kpm",
+		key:       "hour",
+		live:      liveActivity,
+		aggregate: "hour, SUM(keystrokes), SUM(active_minutes), SUM(call_minutes), SUM(call_starts), MAX(peak_kpm)",
+		merge: "keystrokes = keystrokes + excluded.keystrokes, " +
+			"active_minutes = active_minutes + excluded.active_minutes, " +
+			"call_minutes = call_minutes + excluded.call_minutes, " +
+			"call_starts = call_starts + excluded.call_starts, " +
+			"peak_kpm = MAX(peak_kpm, excluded.peak_kpm)",
+	},
+}
+
+func liveKeystrokes(size int, col string) func(schema, cond string) string {
+	return func(schema, cond string) string {
+		return fmt.Sprintf("SELECT minute / %[1]d * %[1]d AS %[2]s, key_char, count FROM %[3]s.keystrokes WHERE %[4]s",
+			size, col, schema, cond)
+	}
+}
+
+// liveMetrics reads a minute table with metric_name and value columns
+// (mouse_metrics, typing_metrics).
+func liveMetrics(table string, size int, col string) func(schema, cond string) string {
+	return func(schema, cond string) string {
+		return fmt.Sprintf("SELECT minute / %[1]d * %[1]d AS %[2]s, metric_name, value FROM %[3]s.%[5]s WHERE %[4]s",
+			size, col, schema, cond, table)
+	}
+}
+
+func liveDeviceMetrics(size int, col string) func(schema, cond string) string {
+	return func(schema, cond string) string {
+		return fmt.Sprintf("SELECT minute / %[1]d * %[1]d AS %[2]s, device, metric_name, value FROM %[3]s.device_metrics WHERE %[4]s",
+			size, col, schema, cond)
+	}
+}
+
+func liveVideoCalls(schema, cond string) string {
+	return fmt.Sprintf(`SELECT minute / 3600 * 3600 AS hour, COALESCE(app, '') AS app, 1 AS minutes,
+		camera_active AS camera_minutes, microphone_active AS microphone_minutes
+		FROM %s.video_calls WHERE in_call = 1 AND %s`, schema, cond)
+}
+
+// liveActivity derives per-hour activity from minute rows. A minute is
+// active if it has keystrokes or a call; a call starts when the previous call
+// minute is more than 5 minutes earlier (matching GetVideoCallStats).
+func liveActivity(schema, cond string) string {
+	return fmt.Sprintf(`SELECT minute / 3600 * 3600 AS hour, SUM(keys) AS keystrokes, COUNT(*) AS active_minutes,
+		SUM(in_call) AS call_minutes, SUM(call_start) AS call_starts, MAX(keys) AS peak_kpm
+		FROM (
+			SELECT minute, SUM(keys) AS keys, MAX(in_call) AS in_call, MAX(call_start) AS call_start
+			FROM (
+				SELECT minute, count AS keys, 0 AS in_call, 0 AS call_start
+				FROM %[1]s.keystrokes WHERE %[2]s
+				UNION ALL
+				SELECT minute, 0, 1, CASE WHEN prev IS NULL OR minute - prev > 300 THEN 1 ELSE 0 END
+				FROM (
+					SELECT minute, LAG(minute) OVER (ORDER BY minute) AS prev
+					FROM %[1]s.video_calls WHERE in_call = 1
+				) WHERE %[2]s
+			)
+			GROUP BY minute
+		)
+		GROUP BY hour`, schema, cond)
+}
+
+// foldSQL returns the statement that folds minute rows in [?1, ?2) of the
+// main schema into the rollup table.
+func (r rollupTable) foldSQL() string {
+	// WHERE true disambiguates the upsert's ON clause from a join constraint.
+	return fmt.Sprintf("INSERT INTO main.%s (%s) SELECT %s FROM (%s) WHERE true GROUP BY %s ON CONFLICT(%s) DO UPDATE SET %s",
+		r.table, r.columns, r.aggregate, r.live("main", "minute >= ?1 AND minute < ?2"), r.key, r.key, r.merge)
+}
+
+// refoldSQL returns the statement that corrects the rollup table after minute
+// rows in [?1, ?2) of the main schema changed. The import_prior schema holds
+// those minutes as they were before; folding the current rows together with
+// the negated prior ones adds exactly the difference. Values only ever grow,
+// so MAX columns are unaffected by the negated rows.
+func (r rollupTable) refoldSQL() string {
+	key := make(map[string]bool)
+	for _, k := range strings.Split(r.key, ", ") {
+		key[k] = true
+	}
+	cols := strings.Split(r.columns, ", ")
+	negated := make([]string, len(cols))
+	for i, c := range cols {
+		if key[c] {
+			negated[i] = c
+		} else {
+			negated[i] = "-" + c
+		}
+	}
+	cond := "minute >= ?1 AND minute < ?2"
+	return fmt.Sprintf("INSERT INTO main.%s (%s) SELECT %s FROM (SELECT %s FROM (%s) UNION ALL SELECT %s FROM (%s)) WHERE true GROUP BY %s ON CONFLICT(%s) DO UPDATE SET %s",
+		r.table, r.columns, r.aggregate, r.columns, r.live("main", cond), strings.Join(negated, ", "), r.live("import_prior", cond),
+		r.key, r.key, r.merge)
+}
+
+// Rollup folds minute data older than the rollup age into the hourly and
+// daily tables, then deletes raw minute rows past the raw retention.
+func (t *Tracker) Rollup() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	cutoff := now.Add(-t.rollupAfter).Unix() / 86400 * 86400
+
+	tx, err := t.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin rollup: %w", err)
+	}
+	defer tx.Rollback()
+
+	var watermark int64
+	tx.QueryRow(`SELECT COALESCE(MAX(value), 0) FROM main.rollup_state WHERE name = 'watermark'`).Scan(&watermark)
+
+	if cutoff > watermark {
+		for _, r := range rollupTables {
+			if _, err := tx.Exec(r.foldSQL(), watermark, cutoff); err != nil {
+				return fmt.Errorf("fold %s: %w", r.table, err)
+			}
+		}
+		_, err := tx.Exec(`
+			INSERT INTO main.rollup_state (name, value) VALUES ('watermark', ?)
+			ON CONFLICT(name) DO UPDATE SET value = excluded.value
+		`, cutoff)
+		if err != nil {
+			return fmt.Errorf("update rollup watermark: %w", err)
+		}
+		log.Printf("Rolled up minute data before %s", time.Unix(cutoff, 0).UTC().Format("2006-01-02"))
+		watermark = cutoff
+	}
+
+	if t.rawRetention > 0 {
+		// Never delete minutes that have not been folded yet.
+		limit := now.Add(-t.rawRetention).Unix()
+		if limit > watermark {
+			limit = watermark
+		}
+		for _, table := range []string{"keystrokes", "mouse_metrics", "device_metrics", "typing_metrics", "video_calls"} {
+			if _, err := tx.Exec("DELETE FROM main."+table+" WHERE minute < ?", limit); err != nil {
+				return fmt.Errorf("apply retention to %s: %w", table, err)
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (t *Tracker) rollupLoop() {
+	defer t.loops.Done()
+
+	if err := t.Rollup(); err != nil {
+		log.Printf("Failed to roll up minute data: %v", err)
+	}
+
+	ticker := time.NewTicker(rollupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stopCh:
+			return
+		case <-ticker.C:
+			if err := t.Rollup(); err != nil {
+				log.Printf("Failed to roll up minute data: %v", err)
+			}
+		}
+	}
+}
+
+// recreateRollupViews builds an all_* view per rollup table. Each schema
+// contributes its rolled-up rows plus live minute rows past its own
+// watermark, so readers see a complete series however far rollup has got.
+// Peers from builds without rollups contribute live rows only; peers without
+// a table's source (device_metrics before schema version 4, typing_metrics
+// before 5) are skipped.
+func (t *Tracker) recreateRollupViews() {
+	schemas := []string{"main"}
+	for _, alias := range t.attached {
+		schemas = append(schemas, alias)
+	}
+
+	for _, r := range rollupTables {
+		t.db.Exec("DROP VIEW IF EXISTS all_" + r.table)
+
+		var parts []string
+		for _, schema := range schemas {
+			if r.source != "" && len(tableColumns(t.db, schema, r.source)) == 0 {
+				continue
+			}
+			cond := "1"
+			if len(tableColumns(t.db, schema, "rollup_state")) > 0 {
+				cond = fmt.Sprintf("minute >= (SELECT COALESCE(MAX(value), 0) FROM %s.rollup_state WHERE name = 'watermark')", schema)
+			}
+			if len(tableColumns(t.db, schema, r.table)) > 0 {
+				parts = append(parts, fmt.Sprintf("SELECT %s FROM %s.%s", r.columns, schema, r.table))
+			}
+			parts = append(parts, fmt.Sprintf("SELECT %s FROM (%s)", r.columns, r.live(schema, cond)))
+		}
+
+		query := "CREATE TEMP VIEW all_" + r.table + " AS " + strings.Join(parts, " UNION ALL ")
+		if _, err := t.db.Exec(query); err != nil {
+			log.Printf("Failed to create view all_%s: %v", r.table, err)
+		}
+	}
+}
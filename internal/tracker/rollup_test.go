@@ -0,0 +1,93 @@
+package tracker
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRollupPreservesStats(t *testing.T) {
+	now := time.Date(2026, 3, 10, 14, 30, 0, 0, time.Local)
+	old := now.Add(-5 * 24 * time.Hour).Unix()
+	recent := now.Add(-30 * time.Minute).Unix()
+
+	dir := t.TempDir()
+	db := openFixtureDB(t, filepath.Join(dir, "host.db"))
+	if err := migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	for _, q := range []struct {
+		query string
+		args  []any
+	}{
+		{`INSERT INTO keystrokes VALUES (?, 'a', 10), (?, '[BACKSPACE]', 2), (?, 'a', 5), (?, 'b', 7)`,
+			[]any{old, old, old + 60, recent}},
+		{`INSERT INTO mouse_metrics VALUES (?, 'clicks_left', 3)`, []any{old}},
+		{`INSERT INTO video_calls VALUES (?, 1, 1, 0, 'Zoom'), (?, 1, 0, 1, 'Zoom')`, []any{old, old + 60}},
+	} {
+		mustExec(t, db, q.query, q.args...)
+	}
+	db.Close()
+
+	tr, err := Open(
+		WithDataDir(dir),
+		WithHostname("host"),
+		WithFlushInterval(time.Hour),
+		WithRawRetention(72*time.Hour),
+		WithClock(func() time.Time { return now }),
+	)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer tr.Close()
+
+	// Open starts a rollup in the background; running it again is a no-op
+	// apart from waiting for it.
+	if err := tr.Rollup(); err != nil {
+		t.Fatalf("Rollup: %v", err)
+	}
+
+	var watermark int64
+	tr.db.QueryRow(`SELECT value FROM rollup_state WHERE name = 'watermark'`).Scan(&watermark)
+	if want := now.Add(-48*time.Hour).Unix() / 86400 * 86400; watermark != want {
+		t.Fatalf("watermark = %d, want %d", watermark, want)
+	}
+
+	var rawRows, hourlyRows int
+	tr.db.QueryRow(`SELECT COUNT(*) FROM keystrokes`).Scan(&rawRows)
+	tr.db.QueryRow(`SELECT COUNT(*) FROM keystrokes_hourly`).Scan(&hourlyRows)
+	if rawRows != 1 || hourlyRows != 2 {
+		t.Fatalf("raw rows = %d, hourly rows = %d; want 1 and 2", rawRows, hourlyRows)
+	}
+
+	for _, r := range []string{"7d", "30d", "1y"} {
+		stats := tr.GetStats(r)
+		if stats.Total != 24 || stats.Typing.Backspaces != 2 || stats.KPM.Max != 12 || stats.Mouse.ClicksLeft != 3 {
+			t.Fatalf("%s stats = total %d, backspaces %d, max kpm %d, clicks %d",
+				r, stats.Total, stats.Typing.Backspaces, stats.KPM.Max, stats.Mouse.ClicksLeft)
+		}
+		if len(stats.TopKeys) == 0 || stats.TopKeys[0] != (KeyCount{Key: "a", Count: 15}) {
+			t.Fatalf("%s top keys = %+v", r, stats.TopKeys)
+		}
+	}
+
+	if stats := tr.GetStats("1h"); stats.Total != 7 {
+		t.Fatalf("1h total = %d, want 7", stats.Total)
+	}
+
+	calendarTotal := 0
+	for _, p := range tr.GetStats("1h").Calendar {
+		calendarTotal += p.Count
+	}
+	if calendarTotal != 24 {
+		t.Fatalf("calendar total = %d, want 24", calendarTotal)
+	}
+
+	calls := tr.GetVideoCallStats("7d")
+	if calls.TotalMinutes != 2 || calls.TotalCalls != 1 || calls.CameraMinutes != 1 || calls.MicrophoneMinutes != 1 {
+		t.Fatalf("call stats = %+v", calls)
+	}
+	if len(calls.AppBreakdown) != 1 || calls.AppBreakdown[0] != (AppCallStats{App: "Zoom", Minutes: 2}) {
+		t.Fatalf("app breakdown = %+v", calls.AppBreakdown)
+	}
+}
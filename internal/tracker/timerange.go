@@ -0,0 +1,164 @@
+package tracker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxHistoryPoints bounds the number of History buckets a single query may
+// produce.
+const maxHistoryPoints = 10000
+
+// Range is the half-open window [From, To) that stats are computed for,
+// with Bucket as the History resolution.
+type Range struct {
+	From   time.Time
+	To     time.Time
+	Bucket time.Duration
+}
+
+// NamedRange returns the window for one of the dashboard presets (1h, 24h,
+// 7d, 30d, 1y) ending now. The window runs to the end of the current minute
+// so the bucket being written to is included, and starts a whole preset
+// earlier, so "1h" is exactly 60 minutes and Previous does not overlap it.
+func NamedRange(name string, now time.Time) (Range, error) {
+	end := now.Truncate(time.Minute).Add(time.Minute)
+	switch name {
+	case "1h":
+		return Range{From: end.Add(-60 * time.Minute), To: end, Bucket: time.Minute}, nil
+	case "24h":
+		return Range{From: end.Add(-24 * time.Hour), To: end, Bucket: time.Minute}, nil
+	case "7d":
+		return Range{From: end.Add(-7 * 24 * time.Hour), To: end, Bucket: time.Hour}, nil
+	case "30d":
+		return Range{From: end.Add(-30 * 24 * time.Hour), To: end, Bucket: time.Hour}, nil
+	case "1y":
+		return Range{From: end.AddDate(-1, 0, 0), To: end, Bucket: 24 * time.Hour}, nil
+	}
+	return Range{}, fmt.Errorf("unknown range %q (want 1h, 24h, 7d, 30d or 1y)", name)
+}
+
+// NewRange validates an explicit window. A zero bucket picks the same
+// resolution the presets use for a window of that length.
+func NewRange(from, to time.Time, bucket time.Duration) (Range, error) {
+	if !from.Before(to) {
+		return Range{}, fmt.Errorf("from (%s) must be before to (%s)", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+
+	span := to.Sub(from)
+	if bucket == 0 {
+		switch {
+		case span <= 24*time.Hour:
+			bucket = time.Minute
+		case span <= 31*24*time.Hour:
+			bucket = time.Hour
+		default:
+			bucket = 24 * time.Hour
+		}
+	}
+	if bucket < time.Minute || bucket%time.Minute != 0 {
+		return Range{}, fmt.Errorf("bucket %s must be a whole number of minutes", bucket)
+	}
+	if span/bucket > maxHistoryPoints {
+		return Range{}, fmt.Errorf("window of %s at %s buckets exceeds %d points", span, bucket, maxHistoryPoints)
+	}
+	return Range{From: from, To: to, Bucket: bucket}, nil
+}
+
+// ParseRange builds a window from user input: either a preset name, or from
+// (and optionally to, defaulting to now) in any form ParseTime accepts. An
+// empty bucket picks one from the window length.
+func ParseRange(name, from, to, bucket string, now time.Time) (Range, error) {
+	var size time.Duration
+	if bucket != "" {
+		var err error
+		if size, err = ParseBucket(bucket); err != nil {
+			return Range{}, err
+		}
+	}
+
+	if from == "" && to == "" {
+		rng, err := NamedRange(name, now)
+		if err != nil {
+			return Range{}, err
+		}
+		if size != 0 {
+			return NewRange(rng.From, rng.To, size)
+		}
+		return rng, nil
+	}
+
+	if name != "" {
+		return Range{}, fmt.Errorf("range cannot be combined with from/to")
+	}
+	if from == "" {
+		return Range{}, fmt.Errorf("to requires from")
+	}
+
+	start, err := ParseTime(from, false)
+	if err != nil {
+		return Range{}, fmt.Errorf("from: %w", err)
+	}
+	end := now
+	if to != "" {
+		if end, err = ParseTime(to, true); err != nil {
+			return Range{}, fmt.Errorf("to: %w", err)
+		}
+	}
+	return NewRange(start, end, size)
+}
+
+// ParseTime accepts Unix seconds, RFC 3339 timestamps and YYYY-MM-DD dates
+// (local time). When end is true a bare date means the end of that day, so
+// "to=2026-03-10" includes the whole of March 10.
+func ParseTime(s string, end bool) (time.Time, error) {
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	if ts, err := time.Parse(time.RFC3339, s); err == nil {
+		return ts, nil
+	}
+	if day, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		if end {
+			day = day.AddDate(0, 0, 1)
+		}
+		return day, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (want Unix seconds, RFC 3339 or YYYY-MM-DD)", s)
+}
+
+// ParseBucket accepts Go durations ("5m", "1h") and whole days ("1d").
+func ParseBucket(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid bucket %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid bucket %q", s)
+	}
+	return d, nil
+}
+
+// bounds returns the window as Unix seconds.
+func (r Range) bounds() (from, to int64) {
+	return r.From.Unix(), r.To.Unix()
+}
+
+// elapsed returns the part of the window up to now, used for per-minute and
+// per-day averages so a window reaching into the future isn't diluted.
+func (r Range) elapsed(now time.Time) time.Duration {
+	end := r.To
+	if now.Before(end) {
+		end = now
+	}
+	if end.Before(r.From) {
+		return 0
+	}
+	return end.Sub(r.From)
+}
@@ -4,9 +4,9 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
-	"math"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -20,10 +20,18 @@ import (
 var (
 	keystrokesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "busygraph_keystrokes_total",
-		Help: "The total number of keystrokes detected, partitioned by key",
-	}, []string{"key"})
+		Help: "The total number of keystrokes detected, partitioned by key and input device",
+	}, []string{"key", "device"})
+	mouseMetricsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "busygraph_mouse_total",
+		Help: "Mouse activity detected, partitioned by metric (clicks_<button>, scroll, scroll_horizontal, distance in pixels) and input device",
+	}, []string{"metric", "device"})
 )
 
+// busyTimeout is how long a write waits for another connection to the
+// database, such as a running `busygraph import`, to release its lock.
+const busyTimeout = 5 * time.Second
+
 type KeyCount struct {
 	Key   string `json:"key"`
 	Count int    `json:"count"`
@@ -47,18 +55,44 @@ type Stats struct {
 	KPM                  KPMStats       `json:"kpm"`
 	Typing               TypingStats    `json:"typing"`
 	TopKeys              []KeyCount     `json:"top_keys"`
+	TopShortcuts         []KeyCount     `json:"top_shortcuts"`
 	History              []TimePoint    `json:"history"`  // Last 60 minutes
 	Calendar             []TimePoint    `json:"calendar"` // Daily counts for the last year
 	Mouse                MouseStats     `json:"mouse"`
+	Devices              []DeviceStats  `json:"devices"`
 	VideoCall            VideoCallState `json:"video_call"`
 	BusiestHour          int            `json:"busiest_hour"`            // 0-23, -1 if no data
 	BusiestDay           int            `json:"busiest_day"`             // 0=Sunday..6=Saturday, -1 if no data
 	AvgCallMinutesPerDay float64        `json:"avg_call_minutes_per_day"`
+	CallMinutes          int            `json:"call_minutes"`
+	From                 int64          `json:"from"`           // Window start (Unix), inclusive
+	To                   int64          `json:"to"`             // Window end (Unix), exclusive
+	BucketSeconds        int64          `json:"bucket_seconds"` // History resolution
+}
+
+// DeviceStats is the input attributed to one keyboard or mouse. Devices with
+// the same name on different hosts are combined. Stats lists the busiest
+// device first.
+type DeviceStats struct {
+	Name       string     `json:"name"`
+	Keystrokes int        `json:"keystrokes"`
+	Mouse      MouseStats `json:"mouse"`
 }
 
 type TypingStats struct {
 	CharsPerBackspace float64 `json:"chars_per_backspace"`
 	Backspaces        int     `json:"backspaces"`
+
+	// Rhythm within typing bursts, runs of keystrokes without a pause of
+	// 3s or more; see typing.go.
+	WPM             float64         `json:"wpm"` // words of 5 keystrokes per minute while typing
+	Bursts          int             `json:"bursts"`
+	AvgBurstSeconds float64         `json:"avg_burst_seconds"`
+	Hesitations     int             `json:"hesitations"` // pauses of 1-3s within a burst
+	Intervals       []IntervalCount `json:"intervals"`   // inter-key interval histogram
+
+	KeyTiming []KeyTimingStats `json:"key_timing"` // by category, most pressed first
+	Positions []KeyCount       `json:"positions"`  // presses by physical key, labelled as on a US keyboard
 }
 
 // Tracker maintains the state of keystrokes
@@ -68,28 +102,62 @@ type Tracker struct {
 	dataDir  string
 	hostname string
 	attached map[string]string // filename -> SQL alias
+
+	flushInterval time.Duration
+	peerRefresh   time.Duration
+	noPeers       bool
+	rollupAfter   time.Duration
+	rawRetention  time.Duration
+
+	// Buffer holds input until the next Flush, and tells the time.
+	Buffer
+
+	stopCh    chan struct{}
+	loops     sync.WaitGroup
+	closeOnce sync.Once
 }
 
-// NewTracker creates a new Tracker instance and initializes DB
-func NewTracker() *Tracker {
-	// Determine data directory
-	dataDir := os.Getenv("XDG_DATA_HOME")
-	if dataDir == "" {
-		home, err := os.UserHomeDir()
+// NewTracker creates a new Tracker instance and initializes DB, exiting the
+// process if the database cannot be opened.
+func NewTracker(opts ...Option) *Tracker {
+	t, err := Open(opts...)
+	if err != nil {
+		log.Fatalf("Failed to open tracker: %v", err)
+	}
+	return t
+}
+
+// Open creates a new Tracker with the given options and initializes its DB.
+func Open(opts ...Option) (*Tracker, error) {
+	o := options{
+		flushInterval: 5 * time.Second,
+		peerRefresh:   30 * time.Second,
+		rollupAfter:   48 * time.Hour,
+		now:           time.Now,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	appDir := o.dataDir
+	if appDir == "" {
+		dir, err := DefaultDataDir()
 		if err != nil {
-			log.Fatalf("Failed to get user home directory: %v", err)
+			return nil, fmt.Errorf("get user home directory: %w", err)
 		}
-		dataDir = filepath.Join(home, ".local", "share")
+		appDir = dir
 	}
-
-	appDir := filepath.Join(dataDir, "busygraph")
 	if err := os.MkdirAll(appDir, 0755); err != nil {
-		log.Fatalf("Failed to create data directory %s: %v", appDir, err)
+		return nil, fmt.Errorf("create data directory %s: %w", appDir, err)
 	}
 
-	hostname, err := os.Hostname()
-	if err != nil {
-		log.Fatalf("Failed to get hostname: %v", err)
+	hostname := o.hostname
+	if hostname == "" {
+		h, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("get hostname: %w", err)
+		}
+		hostname = h
 	}
 
 	// Migration: rename legacy busygraph.db to <hostname>.db
@@ -99,7 +167,7 @@ func NewTracker() *Tracker {
 		if _, err := os.Stat(hostPath); os.IsNotExist(err) {
 			log.Printf("Migrating %s -> %s", legacyPath, hostPath)
 			if err := os.Rename(legacyPath, hostPath); err != nil {
-				log.Fatalf("Failed to migrate database: %v", err)
+				return nil, fmt.Errorf("migrate database: %w", err)
 			}
 			// Also migrate sidecar files
 			for _, suffix := range []string{"-wal", "-shm", "-journal"} {
@@ -111,58 +179,60 @@ func NewTracker() *Tracker {
 		}
 	}
 
-	db, err := sql.Open("sqlite", hostPath)
+	// Transactions take the write lock when they begin, waiting up to
+	// busyTimeout for it: one that read first could not wait for another
+	// writer without risking deadlock.
+	db, err := sql.Open("sqlite", fmt.Sprintf("%s?_pragma=busy_timeout(%d)&_txlock=immediate", hostPath, busyTimeout.Milliseconds()))
 	if err != nil {
-		log.Fatalf("Failed to open database: %v", err)
+		return nil, fmt.Errorf("open database: %w", err)
 	}
 
 	// Pin to 1 connection so ATTACH and TEMP VIEWs are visible to all queries.
 	db.SetMaxOpenConns(1)
 
-	// Create tables
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS keystrokes (
-			minute INTEGER,
-			key_char TEXT,
-			count INTEGER,
-			PRIMARY KEY (minute, key_char)
-		);
-		CREATE TABLE IF NOT EXISTS mouse_metrics (
-			minute INTEGER,
-			metric_name TEXT,
-			value REAL,
-			PRIMARY KEY (minute, metric_name)
-		);
-		CREATE TABLE IF NOT EXISTS video_calls (
-			minute INTEGER PRIMARY KEY,
-			in_call INTEGER,
-			camera_active INTEGER,
-			microphone_active INTEGER,
-			app TEXT
-		);
-	`)
-	if err != nil {
-		log.Fatalf("Failed to create table: %v", err)
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
 	}
 
 	t := &Tracker{
-		db:       db,
-		dataDir:  appDir,
-		hostname: hostname,
-		attached: make(map[string]string),
+		db:            db,
+		dataDir:       appDir,
+		hostname:      hostname,
+		attached:      make(map[string]string),
+		flushInterval: o.flushInterval,
+		peerRefresh:   o.peerRefresh,
+		noPeers:       o.noPeers,
+		rollupAfter:   o.rollupAfter,
+		rawRetention:  o.rawRetention,
+		stopCh:        make(chan struct{}),
 	}
+	t.Buffer.init(o.now)
+	t.obs = t
 
 	t.refreshAttachedLocked()
 
-	go t.flushLoop()
-	go t.refreshLoop()
-	return t
+	if !o.noBackground {
+		t.loops.Add(3)
+		go t.flushLoop()
+		go t.refreshLoop()
+		go t.rollupLoop()
+	}
+	return t, nil
 }
 
 func (t *Tracker) refreshLoop() {
-	ticker := time.NewTicker(30 * time.Second)
-	for range ticker.C {
-		t.refreshAttached()
+	defer t.loops.Done()
+
+	ticker := time.NewTicker(t.peerRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stopCh:
+			return
+		case <-ticker.C:
+			t.refreshAttached()
+		}
 	}
 }
 
@@ -173,10 +243,14 @@ func (t *Tracker) refreshAttached() {
 }
 
 func (t *Tracker) refreshAttachedLocked() {
-	matches, err := filepath.Glob(filepath.Join(t.dataDir, "*.db"))
-	if err != nil {
-		log.Printf("Failed to glob data dir: %v", err)
-		return
+	var matches []string
+	if !t.noPeers {
+		var err error
+		matches, err = filepath.Glob(filepath.Join(t.dataDir, "*.db"))
+		if err != nil {
+			log.Printf("Failed to glob data dir: %v", err)
+			return
+		}
 	}
 
 	ownFile := t.hostname + ".db"
@@ -191,6 +265,7 @@ func (t *Tracker) refreshAttachedLocked() {
 	}
 
 	// Detach DBs whose files no longer exist
+	detached := false
 	for fname, alias := range t.attached {
 		if !current[fname] {
 			_, err := t.db.Exec("DETACH DATABASE " + alias)
@@ -198,11 +273,12 @@ func (t *Tracker) refreshAttachedLocked() {
 				log.Printf("Failed to detach %s: %v", alias, err)
 			}
 			delete(t.attached, fname)
+			detached = true
 		}
 	}
 
 	// Attach new DB files
-	changed := false
+	changed := detached
 	for fname := range current {
 		if _, ok := t.attached[fname]; ok {
 			continue
@@ -219,6 +295,9 @@ func (t *Tracker) refreshAttachedLocked() {
 			t.db.Exec("DETACH DATABASE " + alias)
 			continue
 		}
+		if v, err := userVersion(t.db, alias); err == nil && v > schemaVersion {
+			log.Printf("%s uses schema version %d (this build: %d); newer columns are ignored", fname, v, schemaVersion)
+		}
 		t.attached[fname] = alias
 		changed = true
 		log.Printf("Attached %s as %s", fname, alias)
@@ -229,22 +308,119 @@ func (t *Tracker) refreshAttachedLocked() {
 	}
 }
 
-func (t *Tracker) recreateViews() {
-	tables := []string{"keystrokes", "mouse_metrics", "video_calls"}
-	for _, table := range tables {
-		t.db.Exec("DROP VIEW IF EXISTS all_" + table)
+// Info describes where a tracker keeps its data.
+type Info struct {
+	DataDir       string   `json:"data_dir"`
+	Database      string   `json:"database"`
+	SchemaVersion int      `json:"schema_version"`
+	Peers         []string `json:"peers"` // attached peer database files
+}
+
+// Info reports the tracker's database location and attached peers.
+func (t *Tracker) Info() Info {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	info := Info{
+		DataDir:  t.dataDir,
+		Database: filepath.Join(t.dataDir, t.hostname+".db"),
+		Peers:    make([]string, 0, len(t.attached)),
+	}
+	info.SchemaVersion, _ = userVersion(t.db, "main")
+	for fname := range t.attached {
+		info.Peers = append(info.Peers, fname)
+	}
+	sort.Strings(info.Peers)
+	return info
+}
 
-		parts := []string{"SELECT * FROM main." + table}
-		for _, alias := range t.attached {
-			parts = append(parts, "SELECT * FROM "+alias+"."+table)
+// viewColumn is a column exposed by an all_* view, with the expression used
+// for peer databases whose schema predates it.
+type viewColumn struct {
+	name     string
+	fallback string
+}
+
+// viewTables lists the tables federated through all_* views. Columns are
+// named explicitly so peers on older or newer schema versions still line up.
+// Each view also has a host column naming the database a row came from.
+var viewTables = []struct {
+	name    string
+	columns []viewColumn
+}{
+	{"keystrokes", []viewColumn{{"minute", "NULL"}, {"key_char", "''"}, {"count", "0"}}},
+	{"mouse_metrics", []viewColumn{{"minute", "NULL"}, {"metric_name", "''"}, {"value", "0"}}},
+	{"device_metrics", []viewColumn{{"minute", "NULL"}, {"device", "''"}, {"metric_name", "''"}, {"value", "0"}}},
+	{"typing_metrics", []viewColumn{{"minute", "NULL"}, {"metric_name", "''"}, {"value", "0"}}},
+	{"video_calls", []viewColumn{{"minute", "NULL"}, {"in_call", "0"}, {"camera_active", "0"}, {"microphone_active", "0"}, {"app", "''"}}},
+}
+
+func (t *Tracker) recreateViews() {
+	for _, vt := range viewTables {
+		t.db.Exec("DROP VIEW IF EXISTS all_" + vt.name)
+
+		parts := []string{t.viewSelect("main", t.hostname, vt.name, vt.columns)}
+		for fname, alias := range t.attached {
+			// Peers on older schemas may not have every table.
+			if len(tableColumns(t.db, alias, vt.name)) == 0 {
+				continue
+			}
+			parts = append(parts, t.viewSelect(alias, strings.TrimSuffix(fname, ".db"), vt.name, vt.columns))
 		}
 
-		query := "CREATE TEMP VIEW all_" + table + " AS " + strings.Join(parts, " UNION ALL ")
+		query := "CREATE TEMP VIEW all_" + vt.name + " AS " + strings.Join(parts, " UNION ALL ")
 		_, err := t.db.Exec(query)
 		if err != nil {
-			log.Printf("Failed to create view all_%s: %v", table, err)
+			log.Printf("Failed to create view all_%s: %v", vt.name, err)
+		}
+	}
+
+	t.recreateRollupViews()
+}
+
+// viewSelect builds the SELECT for one schema's contribution to an all_*
+// view, substituting fallbacks for columns the table does not have.
+func (t *Tracker) viewSelect(schema, host, table string, columns []viewColumn) string {
+	have := tableColumns(t.db, schema, table)
+	exprs := make([]string, len(columns))
+	for i, c := range columns {
+		if have[c.name] {
+			exprs[i] = c.name
+		} else {
+			exprs[i] = c.fallback + " AS " + c.name
+		}
+	}
+	exprs = append(exprs, sqlQuote(host)+" AS host")
+	return "SELECT " + strings.Join(exprs, ", ") + " FROM " + schema + "." + table
+}
+
+// sqlQuote returns s as an SQL string literal.
+func sqlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// tableColumns returns the set of column names of schema.table.
+func tableColumns(db *sql.DB, schema, table string) map[string]bool {
+	cols := make(map[string]bool)
+	rows, err := db.Query(fmt.Sprintf("PRAGMA %s.table_info(%s)", schema, table))
+	if err != nil {
+		return cols
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid     int
+			name    string
+			typ     string
+			notNull int
+			dflt    sql.NullString
+			pk      int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err == nil {
+			cols[name] = true
 		}
 	}
+	return cols
 }
 
 func sanitizeAlias(filename string) string {
@@ -275,197 +451,201 @@ func hasExpectedTables(db *sql.DB, alias string) bool {
 	return count == 3
 }
 
-// Mouse buffering
-var (
-	mouseDist        float64
-	mouseClicksLeft  int
-	mouseClicksRight int
-	mouseScroll      int
-	lastMouseX       int16 = -1
-	lastMouseY       int16 = -1
-)
-
-func (t *Tracker) TrackMouseClick(button string) {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-	if button == "left" {
-		mouseClicksLeft++
-	} else if button == "right" {
-		mouseClicksRight++
+func (t *Tracker) flushLoop() {
+	defer t.loops.Done()
+
+	ticker := time.NewTicker(t.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stopCh:
+			return
+		case <-ticker.C:
+			t.Flush()
+		}
 	}
 }
 
-func (t *Tracker) TrackMouseScroll(amount int16) {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-	if amount < 0 {
-		mouseScroll += int(-amount)
-	} else {
-		mouseScroll += int(amount)
-	}
-}
+// Flush writes all buffered keystrokes and mouse metrics to the database in a
+// single transaction.
+func (t *Tracker) Flush() {
+	// Take the buffered counts so input tracking can continue during the
+	// write.
+	c := t.Take()
 
-func (t *Tracker) TrackMouseMove(x, y int16) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	if lastMouseX != -1 {
-		dx := float64(x - lastMouseX)
-		dy := float64(y - lastMouseY)
-		dist := math.Sqrt(dx*dx + dy*dy)
-		mouseDist += dist
+	if err := t.writeCounts(c); err != nil {
+		// Keep the counts for the next flush rather than losing them.
+		log.Printf("Failed to flush: %v", err)
+		t.Add(c)
 	}
-	lastMouseX = x
-	lastMouseY = y
 }
 
-func (t *Tracker) flushLoop() {
-	ticker := time.NewTicker(5 * time.Second)
-	for range ticker.C {
-		t.flushMouseMetrics()
+// writeCounts adds c to the database in one transaction. The caller holds
+// mu.
+func (t *Tracker) writeCounts(c Counts) error {
+	tx, err := t.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin flush: %w", err)
 	}
-}
+	defer tx.Rollback()
 
-func (t *Tracker) flushMouseMetrics() {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-
-	bucket := time.Now().Truncate(time.Minute).Unix()
+	for _, k := range c.Keys {
+		_, err := tx.Exec(`
+			INSERT INTO keystrokes (minute, key_char, count) VALUES (?, ?, ?)
+			ON CONFLICT(minute, key_char) DO UPDATE SET count = count + ?
+		`, k.Minute, k.Key, k.Count, k.Count)
+		if err != nil {
+			return fmt.Errorf("flush keystrokes for %q: %w", k.Key, err)
+		}
+	}
 
-	// Flush logic
-	metrics := map[string]float64{
-		"clicks_left":  float64(mouseClicksLeft),
-		"clicks_right": float64(mouseClicksRight),
-		"scroll":       float64(mouseScroll),
-		"distance":     mouseDist,
+	for _, m := range c.Mouse {
+		_, err := tx.Exec(`
+			INSERT INTO mouse_metrics (minute, metric_name, value) VALUES (?, ?, ?)
+			ON CONFLICT(minute, metric_name) DO UPDATE SET value = value + ?
+		`, m.Minute, m.Metric, m.Value, m.Value)
+		if err != nil {
+			return fmt.Errorf("flush mouse metric %s: %w", m.Metric, err)
+		}
 	}
 
-	// Reset buffers
-	mouseClicksLeft = 0
-	mouseClicksRight = 0
-	mouseScroll = 0
-	mouseDist = 0
+	for _, d := range c.Devices {
+		_, err := tx.Exec(`
+			INSERT INTO device_metrics (minute, device, metric_name, value) VALUES (?, ?, ?, ?)
+			ON CONFLICT(minute, device, metric_name) DO UPDATE SET value = value + ?
+		`, d.Minute, d.Device, d.Metric, d.Value, d.Value)
+		if err != nil {
+			return fmt.Errorf("flush %s for device %q: %w", d.Metric, d.Device, err)
+		}
+	}
 
-	for name, val := range metrics {
-		if val > 0 {
-			_, err := t.db.Exec(`
-				INSERT INTO mouse_metrics (minute, metric_name, value) VALUES (?, ?, ?)
-				ON CONFLICT(minute, metric_name) DO UPDATE SET value = value + ?
-			`, bucket, name, val, val)
-			if err != nil {
-				log.Printf("Failed to flush mouse metric %s: %v", name, err)
-			}
+	for _, m := range c.Typing {
+		_, err := tx.Exec(`
+			INSERT INTO typing_metrics (minute, metric_name, value) VALUES (?, ?, ?)
+			ON CONFLICT(minute, metric_name) DO UPDATE SET value = value + ?
+		`, m.Minute, m.Metric, m.Value, m.Value)
+		if err != nil {
+			return fmt.Errorf("flush typing metric %s: %w", m.Metric, err)
 		}
 	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit flush: %w", err)
+	}
+	return nil
 }
 
-// Increment increases the keystroke counter for a specific key
-func (t *Tracker) Increment(key string) {
-	// Update Prometheus (in-memory, ephemeral)
-	keystrokesTotal.WithLabelValues(key).Inc()
+// AddCounts buffers counts taken from another Buffer, such as the input
+// helper's, for the next Flush. They add to the Prometheus totals without a
+// device, since the counts do not say which device each key came from.
+func (t *Tracker) AddCounts(c Counts) {
+	for _, k := range c.Keys {
+		keystrokesTotal.WithLabelValues(k.Key, "").Add(float64(k.Count))
+	}
+	for _, m := range c.Mouse {
+		mouseMetricsTotal.WithLabelValues(m.Metric, "").Add(m.Value)
+	}
+	t.Add(c)
+}
 
-	// Persist to DB
-	// Note: We use a simple UPSERT. For high throughput, batching would be better.
-	t.mu.Lock()
-	defer t.mu.Unlock()
+// observeKey, observeMouse and observeInterval export the input the
+// tracker's own Buffer counts to Prometheus.
+func (t *Tracker) observeKey(key, device string) {
+	keystrokesTotal.WithLabelValues(key, device).Inc()
+}
 
-	bucket := time.Now().Truncate(time.Minute).Unix()
+func (t *Tracker) observeMouse(metric, device string, value float64) {
+	mouseMetricsTotal.WithLabelValues(metric, device).Add(value)
+}
 
-	_, err := t.db.Exec(`
-		INSERT INTO keystrokes (minute, key_char, count) VALUES (?, ?, 1)
-		ON CONFLICT(minute, key_char) DO UPDATE SET count = count + 1
-	`, bucket, key)
+func (t *Tracker) observeInterval(gap time.Duration) {
+	keystrokeInterval.Observe(gap.Seconds())
+}
+
+// Close stops the background loops, flushes any buffered input and closes the
+// database. It is safe to call more than once.
+func (t *Tracker) Close() {
+	t.closeOnce.Do(func() {
+		close(t.stopCh)
+		t.loops.Wait()
+		t.Flush()
+
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if err := t.db.Close(); err != nil {
+			log.Printf("Failed to close database: %v", err)
+		}
+	})
+}
+
+// GetStats returns stats for one of the dashboard presets, falling back to
+// 1h for unknown names.
+func (t *Tracker) GetStats(timeRange string) Stats {
+	r, err := NamedRange(timeRange, t.now())
 	if err != nil {
-		log.Printf("Failed to persist keystroke: %v", err)
+		r, _ = NamedRange("1h", t.now())
 	}
+	return t.GetStatsForRange(r)
 }
 
-func (t *Tracker) GetStats(timeRange string) Stats {
+// GetStatsForRange computes all stats for the window r.
+func (t *Tracker) GetStatsForRange(r Range) Stats {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
+	startTime, endTime := r.bounds()
+	groupBySeconds := int64(r.Bucket / time.Second)
+
 	stats := Stats{
-		Total:       0,
-		TopKeys:     make([]KeyCount, 0),
-		History:     make([]TimePoint, 0),
-		Calendar:    make([]TimePoint, 0),
-		BusiestHour: -1,
-		BusiestDay:  -1,
-	}
-
-	now := time.Now()
-	nowUnix := now.Unix()
-
-	// Determine range config
-	var startTime int64
-	var groupBySeconds int64
-	var points int
-
-	switch timeRange {
-	case "24h":
-		startTime = now.Add(-24 * time.Hour).Unix()
-		groupBySeconds = 60 // 1 minute
-		points = 24 * 60
-	case "7d":
-		startTime = now.Add(-7 * 24 * time.Hour).Unix()
-		groupBySeconds = 3600 // 1 hour
-		points = 7 * 24
-	case "30d":
-		startTime = now.Add(-30 * 24 * time.Hour).Unix()
-		groupBySeconds = 3600 // 1 hour
-		points = 30 * 24
-	case "1y":
-		startTime = now.AddDate(-1, 0, 0).Unix()
-		groupBySeconds = 86400 // 1 day
-		points = 365
-	default: // "1h"
-		startTime = now.Add(-60 * time.Minute).Unix()
-		groupBySeconds = 60 // 1 minute
-		points = 60
+		Total:         0,
+		TopKeys:       make([]KeyCount, 0),
+		TopShortcuts:  make([]KeyCount, 0),
+		Devices:       make([]DeviceStats, 0),
+		History:       make([]TimePoint, 0),
+		Calendar:      make([]TimePoint, 0),
+		BusiestHour:   -1,
+		BusiestDay:    -1,
+		From:          startTime,
+		To:            endTime,
+		BucketSeconds: groupBySeconds,
 	}
 
+	now := t.now()
+
+	src := sourceFor(r)
+
 	// 1. Total (Dynamic)
-	t.db.QueryRow(`SELECT COALESCE(SUM(count), 0) FROM all_keystrokes WHERE minute >= ?`, startTime).Scan(&stats.Total)
+	t.db.QueryRow(src.query(`SELECT COALESCE(SUM(count), 0) FROM {keys} WHERE {bucket} >= ? AND {bucket} < ?`), startTime, endTime).Scan(&stats.Total)
 
-	// 2. Top Keys (Dynamic Range)
-	rows, err := t.db.Query(`
-		SELECT key_char, SUM(count) as total
-		FROM all_keystrokes
-		WHERE minute >= ?
-		GROUP BY key_char
-		ORDER BY total DESC
-		LIMIT 10
-	`, startTime)
-	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var kc KeyCount
-			rows.Scan(&kc.Key, &kc.Count)
-			stats.TopKeys = append(stats.TopKeys, kc)
-		}
-	}
+	// 2. Top Keys and Shortcuts (Dynamic Range)
+	stats.TopKeys = t.queryTopKeys(src, "NOT LIKE", startTime, endTime)
+	stats.TopShortcuts = t.queryTopKeys(src, "LIKE", startTime, endTime)
 
 	// 3. History (Dynamic Range & Aggregation)
 	var query string
 	if groupBySeconds == 60 {
-		query = `SELECT minute, SUM(count) FROM all_keystrokes WHERE minute >= ? GROUP BY minute ORDER BY minute ASC`
+		query = `SELECT minute, SUM(count) FROM all_keystrokes WHERE minute >= ? AND minute < ? GROUP BY minute ORDER BY minute ASC`
 	} else {
 		// Aggregate by larger bucket
-		// We use integer division to bucket
-		query = `
-			SELECT CAST(minute / ? AS INTEGER) * ? as bucket, SUM(count)
-			FROM all_keystrokes
-			WHERE minute >= ?
+		// We use integer division to bucket, shifted to the window's zone
+		query = src.query(`
+			SELECT CAST(({bucket} + ?) / ? AS INTEGER) * ? - ? as bucket, SUM(count)
+			FROM {keys}
+			WHERE {bucket} >= ? AND {bucket} < ?
 			GROUP BY bucket
 			ORDER BY bucket ASC
-		`
+		`)
 	}
 
 	var rowsHist *sql.Rows
+	var err error
 	if groupBySeconds == 60 {
-		rowsHist, err = t.db.Query(query, startTime)
+		rowsHist, err = t.db.Query(query, startTime, endTime)
 	} else {
-		rowsHist, err = t.db.Query(query, groupBySeconds, groupBySeconds, startTime)
+		rowsHist, err = t.db.Query(query, src.offset, groupBySeconds, groupBySeconds, src.offset, startTime, endTime)
 	}
 
 	historyMap := make(map[int64]int)
@@ -480,10 +660,10 @@ func (t *Tracker) GetStats(timeRange string) Stats {
 	}
 
 	// Fill gaps
-	// Align now to the bucket
-	nowBucket := (nowUnix / groupBySeconds) * groupBySeconds
-	for i := 0; i < points; i++ {
-		ts := nowBucket - int64(i)*groupBySeconds
+	// Align the end of the window to the bucket
+	lastBucket := ((endTime-1+src.offset)/groupBySeconds)*groupBySeconds - src.offset
+	for i := 0; i < maxHistoryPoints; i++ {
+		ts := lastBucket - int64(i)*groupBySeconds
 		if ts < startTime {
 			break
 		}
@@ -500,9 +680,9 @@ func (t *Tracker) GetStats(timeRange string) Stats {
 	// 4. Calendar (Fixed to 365 days)
 	calendarStart := now.AddDate(0, 0, -365).Unix()
 	rowsCal, err := t.db.Query(`
-		SELECT strftime('%Y-%m-%d', minute, 'unixepoch', 'localtime') as day, SUM(count)
-		FROM all_keystrokes
-		WHERE minute >= ?
+		SELECT strftime('%Y-%m-%d', hour, 'unixepoch', 'localtime') as day, SUM(keystrokes)
+		FROM all_activity_hourly
+		WHERE hour >= ?
 		GROUP BY day
 		ORDER BY day ASC
 	`, calendarStart)
@@ -516,7 +696,7 @@ func (t *Tracker) GetStats(timeRange string) Stats {
 
 			// Parse the local date string to get a timestamp for Local Midnight
 			tLocal, err := time.ParseInLocation("2006-01-02", dayStr, time.Local)
-			if err == nil {
+			if err == nil && cnt > 0 {
 				stats.Calendar = append(stats.Calendar, TimePoint{
 					Time:  tLocal.Unix(),
 					Count: cnt,
@@ -527,12 +707,12 @@ func (t *Tracker) GetStats(timeRange string) Stats {
 
 	// 5. Mouse Stats
 	// Need to aggregate by metric name over the selected time range
-	rowsMouse, err := t.db.Query(`
+	rowsMouse, err := t.db.Query(src.query(`
 		SELECT metric_name, SUM(value)
-		FROM all_mouse_metrics
-		WHERE minute >= ?
+		FROM {mouse}
+		WHERE {bucket} >= ? AND {bucket} < ?
 		GROUP BY metric_name
-	`, startTime)
+	`), startTime, endTime)
 
 	if err == nil {
 		defer rowsMouse.Close()
@@ -540,47 +720,47 @@ func (t *Tracker) GetStats(timeRange string) Stats {
 			var name string
 			var val float64
 			rowsMouse.Scan(&name, &val)
-			switch name {
-			case "clicks_left":
-				stats.Mouse.ClicksLeft = int(val)
-			case "clicks_right":
-				stats.Mouse.ClicksRight = int(val)
-			case "scroll":
-				stats.Mouse.Scroll = int(val)
-			case "distance":
-				stats.Mouse.Distance = val // Pixels
-			}
+			stats.Mouse.set(name, val)
 		}
 	}
 
+	// 5b. Per-device breakdown
+	stats.Devices = t.queryDeviceStats(src, startTime, endTime)
+
 	// 6. KPM Stats
-	// Avg: Total / Minutes in range (simplified)
-	minutes := float64(nowUnix-startTime) / 60.0
+	// Avg: Total / Minutes elapsed in range (simplified)
+	minutes := r.elapsed(now).Minutes()
 	if minutes < 1 {
 		minutes = 1
 	}
 	stats.KPM.Avg = float64(stats.Total) / minutes
 
 	// Max: The highest single minute sum in the range
-	err = t.db.QueryRow(`
-		SELECT COALESCE(MAX(minute_total), 0) FROM (
-			SELECT SUM(count) as minute_total
-			FROM all_keystrokes
-			WHERE minute >= ?
-			GROUP BY minute
-		)
-	`, startTime).Scan(&stats.KPM.Max)
+	if src.minute {
+		err = t.db.QueryRow(`
+			SELECT COALESCE(MAX(minute_total), 0) FROM (
+				SELECT SUM(count) as minute_total
+				FROM all_keystrokes
+				WHERE minute >= ? AND minute < ?
+				GROUP BY minute
+			)
+		`, startTime, endTime).Scan(&stats.KPM.Max)
+	} else {
+		err = t.db.QueryRow(`
+			SELECT COALESCE(MAX(peak_kpm), 0) FROM all_activity_hourly WHERE hour >= ? AND hour < ?
+		`, startTime, endTime).Scan(&stats.KPM.Max)
+	}
 	if err != nil {
 		stats.KPM.Max = 0
 	}
 
 	// 7. Typing Stats (Characters per Backspace)
 	var backspaceCount int
-	err = t.db.QueryRow(`
+	err = t.db.QueryRow(src.query(`
 		SELECT COALESCE(SUM(count), 0)
-		FROM all_keystrokes
-		WHERE minute >= ? AND key_char = '[BACKSPACE]'
-	`, startTime).Scan(&backspaceCount)
+		FROM {keys}
+		WHERE {bucket} >= ? AND {bucket} < ? AND key_char = '[BACKSPACE]'
+	`), startTime, endTime).Scan(&backspaceCount)
 	if err != nil {
 		backspaceCount = 0
 	}
@@ -593,22 +773,31 @@ func (t *Tracker) GetStats(timeRange string) Stats {
 	} else {
 		stats.Typing.CharsPerBackspace = 0 // No backspaces yet
 	}
+	t.queryTypingStats(src, startTime, endTime, &stats.Typing)
 
 	// 8. Activity Insights
+	// Minute ranges count distinct active minutes across all hosts; longer
+	// ranges use the per-hour activity rollup.
+	activeMinutes := `
+		SELECT minute AS ts, 1 AS active_minutes FROM (
+			SELECT DISTINCT minute FROM all_keystrokes WHERE minute >= ?1 AND minute < ?2
+			UNION
+			SELECT minute FROM all_video_calls WHERE minute >= ?1 AND minute < ?2 AND in_call = 1
+		)
+	`
+	if !src.minute {
+		activeMinutes = `SELECT hour AS ts, active_minutes FROM all_activity_hourly WHERE hour >= ?1 AND hour < ?2`
+	}
 
 	// Busiest hour of day
 	var busiestHour int
 	err = t.db.QueryRow(`
-		SELECT strftime('%H', minute, 'unixepoch', 'localtime') as hour, COUNT(*) as active_minutes
-		FROM (
-			SELECT DISTINCT minute FROM all_keystrokes WHERE minute >= ?
-			UNION
-			SELECT minute FROM all_video_calls WHERE minute >= ? AND in_call = 1
-		)
+		SELECT strftime('%H', ts, 'unixepoch', 'localtime') as hour, SUM(active_minutes) as active
+		FROM (`+activeMinutes+`)
 		GROUP BY hour
-		ORDER BY active_minutes DESC
+		ORDER BY active DESC
 		LIMIT 1
-	`, startTime, startTime).Scan(&busiestHour, new(int))
+	`, startTime, endTime).Scan(&busiestHour, new(int))
 	if err == nil {
 		stats.BusiestHour = busiestHour
 	}
@@ -616,28 +805,31 @@ func (t *Tracker) GetStats(timeRange string) Stats {
 	// Busiest day of week
 	var busiestDay int
 	err = t.db.QueryRow(`
-		SELECT strftime('%w', minute, 'unixepoch', 'localtime') as dow, COUNT(*) as active_minutes
-		FROM (
-			SELECT DISTINCT minute FROM all_keystrokes WHERE minute >= ?
-			UNION
-			SELECT minute FROM all_video_calls WHERE minute >= ? AND in_call = 1
-		)
+		SELECT strftime('%w', ts, 'unixepoch', 'localtime') as dow, SUM(active_minutes) as active
+		FROM (`+activeMinutes+`)
 		GROUP BY dow
-		ORDER BY active_minutes DESC
+		ORDER BY active DESC
 		LIMIT 1
-	`, startTime, startTime).Scan(&busiestDay, new(int))
+	`, startTime, endTime).Scan(&busiestDay, new(int))
 	if err == nil {
 		stats.BusiestDay = busiestDay
 	}
 
 	// Avg call minutes per day
 	var totalCallMinutes int
-	err = t.db.QueryRow(`
-		SELECT COALESCE(SUM(CASE WHEN in_call = 1 THEN 1 ELSE 0 END), 0)
-		FROM all_video_calls WHERE minute >= ?
-	`, startTime).Scan(&totalCallMinutes)
+	if src.minute {
+		err = t.db.QueryRow(`
+			SELECT COALESCE(SUM(CASE WHEN in_call = 1 THEN 1 ELSE 0 END), 0)
+			FROM all_video_calls WHERE minute >= ? AND minute < ?
+		`, startTime, endTime).Scan(&totalCallMinutes)
+	} else {
+		err = t.db.QueryRow(`
+			SELECT COALESCE(SUM(call_minutes), 0) FROM all_activity_hourly WHERE hour >= ? AND hour < ?
+		`, startTime, endTime).Scan(&totalCallMinutes)
+	}
 	if err == nil {
-		days := float64(nowUnix-startTime) / 86400.0
+		stats.CallMinutes = totalCallMinutes
+		days := r.elapsed(now).Hours() / 24
 		if days < 1 {
 			days = 1
 		}
@@ -647,6 +839,174 @@ func (t *Tracker) GetStats(timeRange string) Stats {
 	return stats
 }
 
+// chordPattern is a LIKE pattern matching shortcut chords recorded by the
+// hooks, e.g. "[CTRL]+c", and no plain key label.
+const chordPattern = "'[%]+%'"
+
+// queryTopKeys returns the ten most used keys whose label is (op "LIKE") or
+// is not (op "NOT LIKE") a shortcut chord. The caller holds mu.
+func (t *Tracker) queryTopKeys(src statsSource, op string, start, end int64) []KeyCount {
+	keys := make([]KeyCount, 0)
+	rows, err := t.db.Query(src.query(`
+		SELECT key_char, SUM(count) as total
+		FROM {keys}
+		WHERE {bucket} >= ? AND {bucket} < ? AND key_char `+op+` `+chordPattern+`
+		GROUP BY key_char
+		ORDER BY total DESC
+		LIMIT 10
+	`), start, end)
+	if err != nil {
+		return keys
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kc KeyCount
+		rows.Scan(&kc.Key, &kc.Count)
+		keys = append(keys, kc)
+	}
+	return keys
+}
+
+// queryDeviceStats returns the per-device breakdown for [startTime, endTime),
+// busiest device first.
+func (t *Tracker) queryDeviceStats(src statsSource, startTime, endTime int64) []DeviceStats {
+	devices := make([]DeviceStats, 0)
+	rows, err := t.db.Query(src.query(`
+		SELECT device, metric_name, SUM(value)
+		FROM {devices}
+		WHERE {bucket} >= ? AND {bucket} < ?
+		GROUP BY device, metric_name
+	`), startTime, endTime)
+	if err != nil {
+		return devices
+	}
+	defer rows.Close()
+
+	index := make(map[string]int)
+	for rows.Next() {
+		var name, metric string
+		var val float64
+		rows.Scan(&name, &metric, &val)
+		i, ok := index[name]
+		if !ok {
+			i = len(devices)
+			index[name] = i
+			devices = append(devices, DeviceStats{Name: name})
+		}
+		d := &devices[i]
+		if metric == "keystrokes" {
+			d.Keystrokes = int(val)
+		} else {
+			d.Mouse.set(metric, val)
+		}
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		a, b := devices[i], devices[j]
+		if a.Keystrokes != b.Keystrokes {
+			return a.Keystrokes > b.Keystrokes
+		}
+		if a.Mouse.Distance != b.Mouse.Distance {
+			return a.Mouse.Distance > b.Mouse.Distance
+		}
+		return a.Name < b.Name
+	})
+	return devices
+}
+
+// statsSource selects the tables GetStats reads at a given resolution.
+type statsSource struct {
+	minute  bool   // raw minute data
+	keys    string // view with key_char, count
+	mouse   string // view with metric_name, value
+	devices string // view with device, metric_name, value
+	typing  string // view with metric_name, value
+	bucket  string // bucket timestamp column of the views
+	offset  int64  // UTC offset of the window, in seconds, that History buckets align to
+}
+
+// statsLevel is one resolution stats can be read at.
+type statsLevel struct {
+	seconds int64
+	bucket  string // bucket timestamp column
+	suffix  string // suffix of the all_* views at this resolution
+}
+
+// statsLevels lists the resolutions from finest to coarsest. Rollup buckets
+// are aligned to UTC; see rollup.go.
+var statsLevels = []statsLevel{{60, "minute", ""}, {3600, "hour", "_hourly"}, {86400, "day", "_daily"}}
+
+// sourceFor picks the coarsest data whose buckets evenly divide r's bucket
+// and line up with the window's time zone, so long ranges read rollups
+// instead of every minute row while History buckets still start at local
+// midnight. Rollup buckets cut by either end of the window are replaced by
+// finer data, so a window need not start or end on a bucket boundary.
+func sourceFor(r Range) statsSource {
+	groupBySeconds := int64(r.Bucket / time.Second)
+	_, offset := r.From.Zone()
+	level := 0
+	for i, l := range statsLevels {
+		if groupBySeconds%l.seconds == 0 && int64(offset)%l.seconds == 0 {
+			level = i
+		}
+	}
+
+	from, to := r.bounds()
+	view := func(name, columns string) string {
+		return levelView(name, columns, level, from, to)
+	}
+	return statsSource{
+		minute:  level == 0,
+		keys:    view("all_keystrokes", "key_char, count"),
+		mouse:   view("all_mouse_metrics", "metric_name, value"),
+		devices: view("all_device_metrics", "device, metric_name, value"),
+		typing:  view("all_typing_metrics", "metric_name, value"),
+		bucket:  statsLevels[level].bucket,
+		offset:  int64(offset),
+	}
+}
+
+// levelView returns the view name at statsLevels[level], or, when from or
+// to falls inside one of its buckets, a subquery with the same columns that
+// reads the whole buckets from the view and the partial ones at either end
+// from the next finer level.
+func levelView(name, columns string, level int, from, to int64) string {
+	l := statsLevels[level]
+	if level == 0 {
+		return name
+	}
+	start := (from + l.seconds - 1) / l.seconds * l.seconds
+	end := to / l.seconds * l.seconds
+	if start == from && end == to {
+		return name + l.suffix
+	}
+
+	finer := statsLevels[level-1]
+	part := func(lo, hi int64) string {
+		return fmt.Sprintf("SELECT %s AS %s, %s FROM %s WHERE %s >= %d AND %s < %d",
+			finer.bucket, l.bucket, columns, levelView(name, columns, level-1, lo, hi), finer.bucket, lo, finer.bucket, hi)
+	}
+	if start >= end {
+		return "(" + part(from, to) + ")"
+	}
+	parts := []string{fmt.Sprintf("SELECT %s, %s FROM %s WHERE %s >= %d AND %s < %d",
+		l.bucket, columns, name+l.suffix, l.bucket, start, l.bucket, end)}
+	if from < start {
+		parts = append(parts, part(from, start))
+	}
+	if end < to {
+		parts = append(parts, part(end, to))
+	}
+	return "(" + strings.Join(parts, " UNION ALL ") + ")"
+}
+
+// query expands the {keys}, {mouse}, {devices}, {typing} and {bucket}
+// placeholders in q.
+func (s statsSource) query(q string) string {
+	return strings.NewReplacer("{keys}", s.keys, "{mouse}", s.mouse, "{devices}", s.devices, "{typing}", s.typing,
+		"{bucket}", s.bucket).Replace(q)
+}
+
 type HeatmapPoint struct {
 	Timestamp int64   `json:"ts"`
 	Value     float64 `json:"value"`
@@ -692,10 +1052,41 @@ func (t *Tracker) GetHeatmap() []HeatmapPoint {
 }
 
 type MouseStats struct {
-	Distance    float64 `json:"distance"`
-	ClicksLeft  int     `json:"clicks_left"`
-	ClicksRight int     `json:"clicks_right"`
-	Scroll      int     `json:"scroll"`
+	Distance         float64 `json:"distance"` // pixels
+	ClicksLeft       int     `json:"clicks_left"`
+	ClicksRight      int     `json:"clicks_right"`
+	ClicksMiddle     int     `json:"clicks_middle"`
+	ClicksBack       int     `json:"clicks_back"`
+	ClicksForward    int     `json:"clicks_forward"`
+	Scroll           int     `json:"scroll"`            // vertical wheel notches
+	ScrollHorizontal int     `json:"scroll_horizontal"` // horizontal wheel notches
+}
+
+// Clicks returns the clicks of all buttons combined.
+func (m MouseStats) Clicks() int {
+	return m.ClicksLeft + m.ClicksRight + m.ClicksMiddle + m.ClicksBack + m.ClicksForward
+}
+
+// set records the value of a mouse_metrics metric, ignoring unknown names.
+func (m *MouseStats) set(metric string, val float64) {
+	switch metric {
+	case "distance":
+		m.Distance = val
+	case "clicks_left":
+		m.ClicksLeft = int(val)
+	case "clicks_right":
+		m.ClicksRight = int(val)
+	case "clicks_middle":
+		m.ClicksMiddle = int(val)
+	case "clicks_back":
+		m.ClicksBack = int(val)
+	case "clicks_forward":
+		m.ClicksForward = int(val)
+	case "scroll":
+		m.Scroll = int(val)
+	case "scroll_horizontal":
+		m.ScrollHorizontal = int(val)
+	}
 }
 
 type KPMStats struct {
@@ -712,7 +1103,7 @@ func (t *Tracker) TrackVideoCall(inCall, cameraActive, micActive bool, app strin
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	bucket := time.Now().Truncate(time.Minute).Unix()
+	bucket := t.now().Truncate(time.Minute).Unix()
 
 	_, err := t.db.Exec(`
 		INSERT INTO video_calls (minute, in_call, camera_active, microphone_active, app)
@@ -753,8 +1144,18 @@ type AppCallStats struct {
 	Minutes int    `json:"minutes"`
 }
 
-// GetVideoCallStats returns video call statistics for the given time range
+// GetVideoCallStats returns video call statistics for one of the dashboard
+// presets, falling back to 1h for unknown names.
 func (t *Tracker) GetVideoCallStats(timeRange string) VideoCallStats {
+	r, err := NamedRange(timeRange, t.now())
+	if err != nil {
+		r, _ = NamedRange("1h", t.now())
+	}
+	return t.GetVideoCallStatsForRange(r)
+}
+
+// GetVideoCallStatsForRange returns video call statistics for the window r.
+func (t *Tracker) GetVideoCallStatsForRange(r Range) VideoCallStats {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
@@ -764,49 +1165,41 @@ func (t *Tracker) GetVideoCallStats(timeRange string) VideoCallStats {
 		Heatmap:      make([]HeatmapPoint, 0),
 	}
 
-	now := time.Now()
-	var startTime int64
-
-	switch timeRange {
-	case "24h":
-		startTime = now.Add(-24 * time.Hour).Unix()
-	case "7d":
-		startTime = now.Add(-7 * 24 * time.Hour).Unix()
-	case "30d":
-		startTime = now.Add(-30 * 24 * time.Hour).Unix()
-	case "1y":
-		startTime = now.AddDate(-1, 0, 0).Unix()
-	default: // "1h"
-		startTime = now.Add(-60 * time.Minute).Unix()
-	}
+	startTime, endTime := r.bounds()
 
-	// Combined query for total, camera, and microphone minutes (single table scan)
-	t.db.QueryRow(`
-		SELECT
-			COALESCE(SUM(CASE WHEN in_call = 1 THEN 1 ELSE 0 END), 0),
-			COALESCE(SUM(CASE WHEN camera_active = 1 THEN 1 ELSE 0 END), 0),
-			COALESCE(SUM(CASE WHEN microphone_active = 1 THEN 1 ELSE 0 END), 0)
-		FROM all_video_calls WHERE minute >= ?
-	`, startTime).Scan(&stats.TotalMinutes, &stats.CameraMinutes, &stats.MicrophoneMinutes)
+	// Hour-scale buckets read the hourly rollups; see rollup.go.
+	hourly := !sourceFor(r).minute
 
-	// Estimate number of calls using window function (count gaps > 5 minutes as separate calls)
-	t.db.QueryRow(`
-		SELECT COALESCE(COUNT(*), 0) FROM (
-			SELECT minute,
-				LAG(minute) OVER (ORDER BY minute) as prev_minute
-			FROM all_video_calls
-			WHERE minute >= ? AND in_call = 1
-		) WHERE prev_minute IS NULL OR minute - prev_minute > 300
-	`, startTime).Scan(&stats.TotalCalls)
+	if hourly {
+		t.db.QueryRow(`
+			SELECT COALESCE(SUM(minutes), 0), COALESCE(SUM(camera_minutes), 0), COALESCE(SUM(microphone_minutes), 0)
+			FROM all_video_calls_hourly WHERE hour >= ? AND hour < ?
+		`, startTime, endTime).Scan(&stats.TotalMinutes, &stats.CameraMinutes, &stats.MicrophoneMinutes)
+		t.db.QueryRow(`
+			SELECT COALESCE(SUM(call_starts), 0) FROM all_activity_hourly WHERE hour >= ? AND hour < ?
+		`, startTime, endTime).Scan(&stats.TotalCalls)
+	} else {
+		t.queryMinuteCallTotals(startTime, endTime, &stats)
+	}
 
 	// Per-app breakdown
-	rows, err := t.db.Query(`
+	appQuery := `
 		SELECT app, COUNT(*) as minutes
 		FROM all_video_calls
-		WHERE minute >= ? AND in_call = 1 AND app != ''
+		WHERE minute >= ? AND minute < ? AND in_call = 1 AND app != ''
 		GROUP BY app
 		ORDER BY minutes DESC
-	`, startTime)
+	`
+	if hourly {
+		appQuery = `
+			SELECT app, SUM(minutes) as minutes
+			FROM all_video_calls_hourly
+			WHERE hour >= ? AND hour < ? AND app != ''
+			GROUP BY app
+			ORDER BY minutes DESC
+		`
+	}
+	rows, err := t.db.Query(appQuery, startTime, endTime)
 	if err == nil {
 		defer rows.Close()
 		for rows.Next() {
@@ -817,13 +1210,23 @@ func (t *Tracker) GetVideoCallStats(timeRange string) VideoCallStats {
 	}
 
 	// Daily minutes (for calendar view)
-	rowsDaily, err := t.db.Query(`
+	dailyQuery := `
 		SELECT strftime('%Y-%m-%d', minute, 'unixepoch', 'localtime') as day, COUNT(*) as minutes
 		FROM all_video_calls
-		WHERE minute >= ? AND in_call = 1
+		WHERE minute >= ? AND minute < ? AND in_call = 1
 		GROUP BY day
 		ORDER BY day ASC
-	`, startTime)
+	`
+	if hourly {
+		dailyQuery = `
+			SELECT strftime('%Y-%m-%d', hour, 'unixepoch', 'localtime') as day, SUM(minutes) as minutes
+			FROM all_video_calls_hourly
+			WHERE hour >= ? AND hour < ?
+			GROUP BY day
+			ORDER BY day ASC
+		`
+	}
+	rowsDaily, err := t.db.Query(dailyQuery, startTime, endTime)
 	if err == nil {
 		defer rowsDaily.Close()
 		for rowsDaily.Next() {
@@ -841,10 +1244,10 @@ func (t *Tracker) GetVideoCallStats(timeRange string) VideoCallStats {
 		}
 	}
 
-	// Heatmap (minute-level data)
+	// Heatmap (minute-level data, limited by raw retention)
 	rowsHeat, err := t.db.Query(`
-		SELECT minute, in_call FROM all_video_calls WHERE minute >= ?
-	`, startTime)
+		SELECT minute, in_call FROM all_video_calls WHERE minute >= ? AND minute < ?
+	`, startTime, endTime)
 	if err == nil {
 		defer rowsHeat.Close()
 		for rowsHeat.Next() {
@@ -861,6 +1264,27 @@ func (t *Tracker) GetVideoCallStats(timeRange string) VideoCallStats {
 	return stats
 }
 
+// queryMinuteCallTotals fills call totals from raw minute data.
+func (t *Tracker) queryMinuteCallTotals(startTime, endTime int64, stats *VideoCallStats) {
+	// Combined query for total, camera, and microphone minutes (single table scan)
+	t.db.QueryRow(`
+		SELECT
+			COALESCE(SUM(CASE WHEN in_call = 1 THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN camera_active = 1 THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN microphone_active = 1 THEN 1 ELSE 0 END), 0)
+		FROM all_video_calls WHERE minute >= ? AND minute < ?
+	`, startTime, endTime).Scan(&stats.TotalMinutes, &stats.CameraMinutes, &stats.MicrophoneMinutes)
+
+	// Estimate number of calls using window function (count gaps > 5 minutes as separate calls)
+	t.db.QueryRow(`
+		SELECT COALESCE(COUNT(*), 0) FROM (
+			SELECT minute,
+				LAG(minute) OVER (ORDER BY minute) as prev_minute
+			FROM all_video_calls
+			WHERE minute >= ? AND minute < ? AND in_call = 1
+		) WHERE prev_minute IS NULL OR minute - prev_minute > 300
+	`, startTime, endTime).Scan(&stats.TotalCalls)
+}
 
 // GetVideoCallHeatmap returns heatmap data for video calls
 func (t *Tracker) GetVideoCallHeatmap() []HeatmapPoint {
@@ -0,0 +1,392 @@
+package tracker
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestTrackersDoNotShareBuffers(t *testing.T) {
+	now := time.Date(2026, 3, 10, 14, 30, 0, 0, time.Local)
+	a := openTestTracker(t, "a", now)
+	b := openTestTracker(t, "b", now)
+
+	a.TrackMouseMove(0, 0)
+	a.TrackMouseMove(30, 40)
+	a.TrackMouseClick("left")
+	a.Increment("x")
+	b.TrackMouseClick("right")
+
+	a.Flush()
+	b.Flush()
+
+	sa := a.GetStats("1h")
+	if sa.Mouse.Distance != 50 || sa.Mouse.ClicksLeft != 1 || sa.Mouse.ClicksRight != 0 {
+		t.Fatalf("tracker a mouse stats = %+v", sa.Mouse)
+	}
+	if sa.Total != 1 {
+		t.Fatalf("tracker a total = %d, want 1", sa.Total)
+	}
+
+	sb := b.GetStats("1h")
+	if sb.Mouse.Distance != 0 || sb.Mouse.ClicksLeft != 0 || sb.Mouse.ClicksRight != 1 {
+		t.Fatalf("tracker b mouse stats = %+v", sb.Mouse)
+	}
+	if sb.Total != 0 {
+		t.Fatalf("tracker b total = %d, want 0", sb.Total)
+	}
+}
+
+func TestFlushBatchesKeystrokesPerMinute(t *testing.T) {
+	now := time.Date(2026, 3, 10, 14, 30, 0, 0, time.Local)
+	tr := openTestTracker(t, "host", now)
+	clock := now
+	tr.now = func() time.Time { return clock }
+
+	for i := 0; i < 3; i++ {
+		tr.Increment("a")
+	}
+	clock = now.Add(time.Minute)
+	tr.Increment("a")
+	tr.Increment("[BACKSPACE]")
+
+	if stats := tr.GetStats("1h"); stats.Total != 0 {
+		t.Fatalf("total before flush = %d, want 0", stats.Total)
+	}
+
+	tr.Flush()
+	tr.Increment("a")
+	tr.Flush()
+
+	stats := tr.GetStats("1h")
+	if stats.Total != 6 {
+		t.Fatalf("total = %d, want 6", stats.Total)
+	}
+	if stats.KPM.Max != 3 {
+		t.Fatalf("max KPM = %d, want 3", stats.KPM.Max)
+	}
+	if stats.Typing.Backspaces != 1 {
+		t.Fatalf("backspaces = %d, want 1", stats.Typing.Backspaces)
+	}
+}
+
+func TestFlushKeepsCountsOnError(t *testing.T) {
+	now := time.Date(2026, 3, 10, 14, 30, 0, 0, time.Local)
+	tr := openTestTracker(t, "host", now)
+
+	tr.Increment("a")
+	mustExec(t, tr.db, `CREATE TEMP TRIGGER fail BEFORE INSERT ON main.keystrokes BEGIN SELECT RAISE(ABORT, 'disk full'); END`)
+	tr.Flush()
+	mustExec(t, tr.db, `DROP TRIGGER fail`)
+
+	// Another process writing to the database makes the flush wait.
+	var path string
+	tr.db.QueryRow(`SELECT file FROM pragma_database_list WHERE name = 'main'`).Scan(&path)
+	other, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	defer other.Close()
+	conn, err := other.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(context.Background(), `BEGIN IMMEDIATE`); err != nil {
+		t.Fatalf("lock database: %v", err)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		conn.ExecContext(context.Background(), `COMMIT`)
+	}()
+
+	tr.Increment("b")
+	tr.Flush()
+	if stats := tr.GetStats("1h"); stats.Total != 2 {
+		t.Fatalf("total = %d, want 2", stats.Total)
+	}
+}
+
+func TestGetStatsForPastWindow(t *testing.T) {
+	now := time.Date(2026, 3, 10, 14, 30, 0, 0, time.UTC)
+	tr := openTestTracker(t, "host", now)
+
+	monday := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	tuesday := monday.AddDate(0, 0, 1)
+	for _, ts := range []time.Time{monday, tuesday, tuesday.Add(time.Minute), tuesday.Add(2 * time.Hour)} {
+		tr.now = func() time.Time { return ts }
+		tr.Increment("a")
+		tr.Flush()
+	}
+	tr.now = func() time.Time { return now }
+
+	day := time.Date(2026, 3, 3, 0, 0, 0, 0, time.UTC)
+	rng, err := NewRange(day, day.AddDate(0, 0, 1), time.Hour)
+	if err != nil {
+		t.Fatalf("NewRange: %v", err)
+	}
+	stats := tr.GetStatsForRange(rng)
+	if stats.Total != 3 {
+		t.Fatalf("total = %d, want 3", stats.Total)
+	}
+	if len(stats.History) != 24 || stats.History[10].Count != 2 || stats.History[12].Count != 1 {
+		t.Fatalf("history = %+v", stats.History)
+	}
+	if stats.From != day.Unix() || stats.BucketSeconds != 3600 {
+		t.Fatalf("window = %d/%d", stats.From, stats.BucketSeconds)
+	}
+}
+
+func TestGetStatsForLocalDay(t *testing.T) {
+	for _, loc := range []*time.Location{
+		time.FixedZone("EST", -5*3600),
+		time.FixedZone("IST", 5*3600+1800), // rollup hours straddle local midnight
+	} {
+		day := time.Date(2026, 3, 3, 0, 0, 0, 0, loc)
+		tr := openTestTracker(t, "host", day.AddDate(0, 0, 2))
+		for _, k := range []struct {
+			at    time.Duration
+			count int
+		}{
+			{-10 * time.Minute, 7},             // March 2
+			{10 * time.Minute, 1},              // March 3
+			{3 * time.Hour, 1},                 // March 3
+			{12 * time.Hour, 1},                // March 3
+			{24*time.Hour + 10*time.Minute, 5}, // March 4
+		} {
+			tr.now = func() time.Time { return day.Add(k.at) }
+			for range k.count {
+				tr.Increment("a")
+			}
+			tr.Flush()
+		}
+		tr.now = func() time.Time { return day.AddDate(0, 0, 2) }
+
+		for _, bucket := range []time.Duration{time.Minute, time.Hour, 24 * time.Hour} {
+			rng, err := NewRange(day, day.AddDate(0, 0, 1), bucket)
+			if err != nil {
+				t.Fatalf("NewRange: %v", err)
+			}
+			stats := tr.GetStatsForRange(rng)
+			if stats.Total != 3 {
+				t.Errorf("%s, %s buckets: total = %d, want 3", loc, bucket, stats.Total)
+			}
+			var history int
+			for _, p := range stats.History {
+				history += p.Count
+			}
+			if history != 3 {
+				t.Errorf("%s, %s buckets: history = %+v, want 3 keystrokes", loc, bucket, stats.History)
+			}
+			if bucket == 24*time.Hour && (len(stats.History) != 1 || stats.History[0].Time != day.Unix()) {
+				t.Errorf("%s: daily history = %+v, want one bucket at local midnight", loc, stats.History)
+			}
+		}
+
+		// A window cutting through rollup buckets reads its edges from
+		// finer data.
+		rng, err := NewRange(day.Add(5*time.Minute), day.Add(24*time.Hour+15*time.Minute), time.Hour)
+		if err != nil {
+			t.Fatalf("NewRange: %v", err)
+		}
+		if stats := tr.GetStatsForRange(rng); stats.Total != 8 {
+			t.Errorf("%s, unaligned window: total = %d, want 8", loc, stats.Total)
+		}
+	}
+}
+
+func TestCompareWithPreviousWindow(t *testing.T) {
+	now := time.Date(2026, 3, 10, 14, 30, 0, 0, time.UTC)
+	tr := openTestTracker(t, "host", now)
+
+	record := func(ts time.Time, keys int) {
+		tr.now = func() time.Time { return ts }
+		for i := 0; i < keys; i++ {
+			tr.Increment("a")
+		}
+		tr.Flush()
+	}
+	record(now.Add(-36*time.Hour), 4) // previous 24h
+	record(now.Add(-2*time.Hour), 6)  // current 24h
+	tr.now = func() time.Time { return now }
+
+	rng, _ := NamedRange("24h", now)
+	cmp := tr.Compare(rng)
+
+	if cmp.Current.Keystrokes != 6 || cmp.Previous.Keystrokes != 4 {
+		t.Fatalf("keystrokes = %d vs %d", cmp.Current.Keystrokes, cmp.Previous.Keystrokes)
+	}
+	if cmp.Previous.To != cmp.Current.From {
+		t.Fatalf("previous window ends at %d, want %d", cmp.Previous.To, cmp.Current.From)
+	}
+	d := cmp.Deltas["keystrokes"]
+	if d.Absolute != 2 || d.Percent == nil || *d.Percent != 50 {
+		t.Fatalf("keystrokes delta = %+v", d)
+	}
+	if d := cmp.Deltas["call_minutes"]; d.Absolute != 0 || d.Percent != nil {
+		t.Fatalf("call minutes delta = %+v", d)
+	}
+}
+
+func TestHourWindowIsSixtyMinutes(t *testing.T) {
+	now := time.Date(2026, 3, 10, 14, 30, 0, 0, time.UTC)
+	tr := openTestTracker(t, "host", now)
+
+	record := func(ts time.Time, keys int) {
+		tr.now = func() time.Time { return ts }
+		for i := 0; i < keys; i++ {
+			tr.Increment("a")
+		}
+		tr.Flush()
+	}
+	record(now.Add(-60*time.Minute), 2) // 61 minutes back, counting this one
+	record(now.Add(-59*time.Minute), 3)
+	tr.now = func() time.Time { return now }
+
+	rng, _ := NamedRange("1h", now)
+	if span := rng.To.Sub(rng.From); span != time.Hour {
+		t.Fatalf("1h window spans %s", span)
+	}
+	cmp := tr.Compare(rng)
+	if cmp.Current.Keystrokes != 3 || cmp.Previous.Keystrokes != 2 {
+		t.Fatalf("keystrokes = %d vs %d, want 3 vs 2", cmp.Current.Keystrokes, cmp.Previous.Keystrokes)
+	}
+}
+
+func TestShortcutsAreListedApartFromKeys(t *testing.T) {
+	now := time.Date(2026, 3, 10, 14, 30, 0, 0, time.Local)
+	tr := openTestTracker(t, "host", now)
+
+	for _, k := range []string{"c", "c", "[", "[F1]", "[CTRL]+c", "[CTRL]+c", "[CTRL]+[SHIFT]+p", "[META]+[TAB]", "[CTRL]+c"} {
+		tr.Increment(k)
+	}
+	tr.Flush()
+
+	stats := tr.GetStats("1h")
+	if stats.Total != 9 {
+		t.Fatalf("total = %d, want 9", stats.Total)
+	}
+	wantKeys := []KeyCount{{"c", 2}, {"[", 1}, {"[F1]", 1}}
+	wantShortcuts := []KeyCount{{"[CTRL]+c", 3}, {"[CTRL]+[SHIFT]+p", 1}, {"[META]+[TAB]", 1}}
+	for _, tc := range []struct {
+		name      string
+		got, want []KeyCount
+	}{
+		{"top keys", stats.TopKeys, wantKeys},
+		{"top shortcuts", stats.TopShortcuts, wantShortcuts},
+	} {
+		if len(tc.got) != len(tc.want) {
+			t.Fatalf("%s = %+v, want %+v", tc.name, tc.got, tc.want)
+		}
+		// Ties are in no particular order.
+		counts := make(map[string]int)
+		for _, kc := range tc.got {
+			counts[kc.Key] = kc.Count
+		}
+		for _, kc := range tc.want {
+			if counts[kc.Key] != kc.Count {
+				t.Fatalf("%s = %+v, want %+v", tc.name, tc.got, tc.want)
+			}
+		}
+	}
+}
+
+func TestMouseButtonsAndScrollAxes(t *testing.T) {
+	now := time.Date(2026, 3, 10, 14, 30, 0, 0, time.Local)
+	tr := openTestTracker(t, "host", now)
+
+	for _, b := range []string{"left", "middle", "middle", "back", "forward", "forward", "forward", "button9"} {
+		tr.TrackMouseClick(b)
+	}
+	tr.TrackMouseScroll(-3)
+	tr.TrackMouseHScroll(2)
+	mouse := tr.Device("Logitech MX Master 3")
+	mouse.TrackMouseHScroll(-4)
+	mouse.TrackMouseClick("back")
+	tr.Flush()
+
+	want := MouseStats{ClicksLeft: 1, ClicksMiddle: 2, ClicksBack: 2, ClicksForward: 3, Scroll: 3, ScrollHorizontal: 6}
+	stats := tr.GetStats("1h")
+	if stats.Mouse != want {
+		t.Fatalf("mouse stats = %+v, want %+v", stats.Mouse, want)
+	}
+	if stats.Mouse.Clicks() != 8 {
+		t.Fatalf("Clicks() = %d, want 8", stats.Mouse.Clicks())
+	}
+	if len(stats.Devices) != 1 || stats.Devices[0].Mouse != (MouseStats{ClicksBack: 1, ScrollHorizontal: 4}) {
+		t.Fatalf("devices = %+v", stats.Devices)
+	}
+}
+
+func TestDeviceBreakdown(t *testing.T) {
+	now := time.Date(2026, 3, 10, 14, 30, 0, 0, time.UTC)
+	tr := openTestTracker(t, "host", now)
+
+	record := func(ts time.Time) {
+		tr.now = func() time.Time { return ts }
+		kb := tr.Device("Keychron K2")
+		kb.Increment("a")
+		kb.Increment("b")
+		tr.Device("AT Translated Set 2 keyboard").Increment("a")
+		mouse := tr.Device("Logitech MX Master 3")
+		mouse.TrackMouseMove(3, 4)
+		mouse.TrackMouseClick("left")
+		tr.Increment("c") // unattributed
+		tr.Flush()
+	}
+	tr.TrackMouseMove(0, 0)
+	record(now.Add(-5 * 24 * time.Hour)) // folded into rollups
+	tr.TrackMouseMove(0, 0)
+	record(now.Add(-10 * time.Minute))
+	tr.now = func() time.Time { return now }
+	if err := tr.Rollup(); err != nil {
+		t.Fatalf("Rollup: %v", err)
+	}
+
+	for _, tc := range []struct {
+		rng  string
+		n    int
+		want []DeviceStats
+	}{
+		{"1h", 1, []DeviceStats{
+			{Name: "Keychron K2", Keystrokes: 2},
+			{Name: "AT Translated Set 2 keyboard", Keystrokes: 1},
+			{Name: "Logitech MX Master 3", Mouse: MouseStats{Distance: 5, ClicksLeft: 1}},
+		}},
+		{"30d", 2, []DeviceStats{
+			{Name: "Keychron K2", Keystrokes: 4},
+			{Name: "AT Translated Set 2 keyboard", Keystrokes: 2},
+			{Name: "Logitech MX Master 3", Mouse: MouseStats{Distance: 10, ClicksLeft: 2}},
+		}},
+	} {
+		stats := tr.GetStats(tc.rng)
+		if stats.Total != 4*tc.n {
+			t.Fatalf("%s total = %d, want %d", tc.rng, stats.Total, 4*tc.n)
+		}
+		if len(stats.Devices) != len(tc.want) {
+			t.Fatalf("%s devices = %+v", tc.rng, stats.Devices)
+		}
+		for i, want := range tc.want {
+			if stats.Devices[i] != want {
+				t.Fatalf("%s device %d = %+v, want %+v", tc.rng, i, stats.Devices[i], want)
+			}
+		}
+	}
+}
+
+func openTestTracker(t *testing.T, hostname string, now time.Time) *Tracker {
+	t.Helper()
+
+	tr, err := Open(
+		WithDataDir(t.TempDir()),
+		WithHostname(hostname),
+		WithFlushInterval(time.Hour),
+		WithClock(func() time.Time { return now }),
+	)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(tr.Close)
+	return tr
+}
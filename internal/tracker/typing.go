@@ -0,0 +1,277 @@
+package tracker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Typing rhythm is derived from the time between consecutive keystrokes,
+// and key timing from how long keys of each category are held. Only counts
+// and totals are kept per minute, never which keys were pressed or in what
+// order.
+const (
+	// burstGap ends a typing burst: a longer pause is a break, not part of
+	// the rhythm.
+	burstGap = 3 * time.Second
+	// hesitationMin is the shortest pause within a burst that counts as a
+	// hesitation.
+	hesitationMin = time.Second
+	// charsPerWord is the conventional word length for WPM.
+	charsPerWord = 5
+	// longHold is the shortest hold counted as long: beyond normal typing
+	// and modifier use, and a hint of a sticking key when it is frequent.
+	longHold = 2 * time.Second
+)
+
+// intervalBounds are the upper bounds of the inter-key interval histogram.
+// Every interval within a burst is shorter than burstGap, so the last bucket
+// catches the rest.
+var intervalBounds = []time.Duration{
+	50 * time.Millisecond, 75 * time.Millisecond, 100 * time.Millisecond,
+	125 * time.Millisecond, 150 * time.Millisecond, 200 * time.Millisecond,
+	250 * time.Millisecond, 300 * time.Millisecond, 400 * time.Millisecond,
+	500 * time.Millisecond, 750 * time.Millisecond, time.Second,
+	1500 * time.Millisecond, 2 * time.Second, burstGap,
+}
+
+var keystrokeInterval = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "busygraph_keystroke_interval_seconds",
+	Help:    "Time between consecutive keystrokes within a typing burst",
+	Buckets: intervalSeconds(),
+})
+
+func intervalSeconds() []float64 {
+	s := make([]float64, len(intervalBounds))
+	for i, b := range intervalBounds {
+		s[i] = b.Seconds()
+	}
+	return s
+}
+
+// intervalMetric returns the typing_metrics name of the histogram bucket d
+// falls in, e.g. "interval_le_150ms".
+func intervalMetric(d time.Duration) string {
+	for _, b := range intervalBounds {
+		if d <= b {
+			return fmt.Sprintf("interval_le_%dms", b.Milliseconds())
+		}
+	}
+	return fmt.Sprintf("interval_le_%dms", burstGap.Milliseconds())
+}
+
+// IntervalCount is one bucket of the inter-key interval histogram: the
+// number of intervals longer than the previous bucket's bound and at most
+// LE milliseconds.
+type IntervalCount struct {
+	LE    int64 `json:"le_ms"`
+	Count int   `json:"count"`
+}
+
+// KeyTimingStats summarizes how keys of one category were held. Only
+// hooks started with key timing enabled record it.
+type KeyTimingStats struct {
+	Category  string  `json:"category"` // letter, digit, symbol, whitespace, deletion, navigation, function, modifier or other
+	Presses   int     `json:"presses"`  // presses whose release was seen
+	AvgHoldMs float64 `json:"avg_hold_ms"`
+	LongHolds int     `json:"long_holds"` // held 2s or more
+	Repeats   int     `json:"repeats"`    // autorepeat events while held
+}
+
+// TrackKeyHold records that a key of the given category was held down for
+// d before being released. Only the category is kept.
+func (b *Buffer) TrackKeyHold(category string, d time.Duration) {
+	b.bufMu.Lock()
+	defer b.bufMu.Unlock()
+	now := b.now()
+	b.addTypingMetricLocked(now, "hold_count_"+category, 1)
+	b.addTypingMetricLocked(now, "hold_ms_"+category, float64(d.Milliseconds()))
+	if d >= longHold {
+		b.addTypingMetricLocked(now, "hold_long_"+category, 1)
+	}
+}
+
+// TrackKeyRepeat records one autorepeat event of a held key of the given
+// category.
+func (b *Buffer) TrackKeyRepeat(category string) {
+	b.bufMu.Lock()
+	defer b.bufMu.Unlock()
+	b.addTypingMetricLocked(b.now(), "repeat_"+category, 1)
+}
+
+// TrackKeyHold is Buffer.TrackKeyHold. Key timing is not broken down by
+// device.
+func (d DeviceInput) TrackKeyHold(category string, held time.Duration) {
+	d.b.TrackKeyHold(category, held)
+}
+
+// TrackKeyRepeat is Buffer.TrackKeyRepeat. Key timing is not broken down by
+// device.
+func (d DeviceInput) TrackKeyRepeat(category string) { d.b.TrackKeyRepeat(category) }
+
+// TrackKeyPosition records a key press by the physical key's position,
+// labelled as on a US keyboard, independent of the keyboard layout.
+func (b *Buffer) TrackKeyPosition(label string) {
+	b.bufMu.Lock()
+	defer b.bufMu.Unlock()
+	b.addTypingMetricLocked(b.now(), "position_"+label, 1)
+}
+
+// TrackKeyPosition is Buffer.TrackKeyPosition. Key positions are not broken
+// down by device.
+func (d DeviceInput) TrackKeyPosition(label string) { d.b.TrackKeyPosition(label) }
+
+// typingState follows the current typing burst. The caller holds bufMu.
+type typingState struct {
+	start, last time.Time // first and latest keystroke of the burst
+	keys        int       // keystrokes in the burst, 0 if none is open
+}
+
+// metricBucket identifies a buffered per-minute metric awaiting flush.
+type metricBucket struct {
+	minute int64
+	metric string
+}
+
+// trackKeyTimeLocked adds a keystroke at the given time to the typing
+// rhythm. The caller holds bufMu.
+func (b *Buffer) trackKeyTimeLocked(at time.Time) {
+	s := &b.typing
+	if s.keys > 0 {
+		// Events from different keyboards can arrive slightly out of order.
+		gap := max(at.Sub(s.last), 0)
+		if gap >= burstGap {
+			b.endBurstLocked()
+		} else {
+			if b.obs != nil {
+				b.obs.observeInterval(gap)
+			}
+			b.addTypingMetricLocked(at, intervalMetric(gap), 1)
+			if gap >= hesitationMin {
+				b.addTypingMetricLocked(at, "hesitations", 1)
+			}
+		}
+	}
+	if s.keys == 0 {
+		s.start, s.last = at, at
+	}
+	if at.After(s.last) {
+		s.last = at
+	}
+	s.keys++
+}
+
+// endBurstLocked records the open burst, if it had more than one keystroke,
+// in the minute of its last keystroke. The caller holds bufMu.
+func (b *Buffer) endBurstLocked() {
+	s := &b.typing
+	if s.keys > 1 {
+		b.addTypingMetricLocked(s.last, "bursts", 1)
+		b.addTypingMetricLocked(s.last, "burst_keys", float64(s.keys))
+		b.addTypingMetricLocked(s.last, "burst_seconds", s.last.Sub(s.start).Seconds())
+	}
+	*s = typingState{}
+}
+
+// addTypingMetricLocked buffers value for the minute of at. The caller holds
+// bufMu.
+func (b *Buffer) addTypingMetricLocked(at time.Time, metric string, value float64) {
+	b.typBuf[metricBucket{minute: at.Truncate(time.Minute).Unix(), metric: metric}] += value
+}
+
+// queryTypingStats fills the rhythm and key timing fields of typing for
+// [start, end). The caller holds mu.
+func (t *Tracker) queryTypingStats(src statsSource, start, end int64, typing *TypingStats) {
+	typing.Intervals = make([]IntervalCount, len(intervalBounds))
+	typing.KeyTiming = make([]KeyTimingStats, 0)
+	typing.Positions = make([]KeyCount, 0)
+	index := make(map[string]int, len(intervalBounds))
+	for i, b := range intervalBounds {
+		typing.Intervals[i].LE = b.Milliseconds()
+		index[intervalMetric(b)] = i
+	}
+
+	rows, err := t.db.Query(src.query(`
+		SELECT metric_name, SUM(value)
+		FROM {typing}
+		WHERE {bucket} >= ? AND {bucket} < ?
+		GROUP BY metric_name
+	`), start, end)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	var burstKeys, burstSeconds float64
+	timing := make(map[string]*KeyTimingStats)
+	category := func(name string) *KeyTimingStats {
+		if timing[name] == nil {
+			timing[name] = &KeyTimingStats{Category: name}
+		}
+		return timing[name]
+	}
+	holdMs := make(map[string]float64)
+	for rows.Next() {
+		var name string
+		var val float64
+		rows.Scan(&name, &val)
+		switch name {
+		case "bursts":
+			typing.Bursts = int(val)
+		case "burst_keys":
+			burstKeys = val
+		case "burst_seconds":
+			burstSeconds = val
+		case "hesitations":
+			typing.Hesitations = int(val)
+		default:
+			if i, ok := index[name]; ok {
+				typing.Intervals[i].Count = int(val)
+			} else if c, ok := strings.CutPrefix(name, "hold_count_"); ok {
+				category(c).Presses = int(val)
+			} else if c, ok := strings.CutPrefix(name, "hold_ms_"); ok {
+				category(c)
+				holdMs[c] = val
+			} else if c, ok := strings.CutPrefix(name, "hold_long_"); ok {
+				category(c).LongHolds = int(val)
+			} else if c, ok := strings.CutPrefix(name, "repeat_"); ok {
+				category(c).Repeats = int(val)
+			} else if k, ok := strings.CutPrefix(name, "position_"); ok {
+				typing.Positions = append(typing.Positions, KeyCount{Key: k, Count: int(val)})
+			}
+		}
+	}
+
+	for c, kt := range timing {
+		if kt.Presses > 0 {
+			kt.AvgHoldMs = holdMs[c] / float64(kt.Presses)
+		}
+		typing.KeyTiming = append(typing.KeyTiming, *kt)
+	}
+	sort.Slice(typing.KeyTiming, func(i, j int) bool {
+		a, b := typing.KeyTiming[i], typing.KeyTiming[j]
+		if a.Presses != b.Presses {
+			return a.Presses > b.Presses
+		}
+		return a.Category < b.Category
+	})
+
+	sort.Slice(typing.Positions, func(i, j int) bool {
+		a, b := typing.Positions[i], typing.Positions[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Key < b.Key
+	})
+
+	if typing.Bursts > 0 && burstSeconds > 0 {
+		// A burst of n keystrokes spans n-1 intervals.
+		typed := burstKeys - float64(typing.Bursts)
+		typing.WPM = typed / charsPerWord / (burstSeconds / 60)
+		typing.AvgBurstSeconds = burstSeconds / float64(typing.Bursts)
+	}
+}
@@ -0,0 +1,150 @@
+package tracker
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/victortrac/busygraph/internal/input"
+)
+
+func TestTypingRhythm(t *testing.T) {
+	now := time.Date(2026, 3, 10, 14, 30, 0, 0, time.Local)
+	tr := openTestTracker(t, "host", now)
+
+	base := now.Add(-20 * time.Second)
+	for _, ms := range []int{
+		0, 100, 200, 300, 1500, 1600, // burst with one hesitation
+		6600, 6750, // burst after a break
+		12000, // a lone keystroke is not a burst
+	} {
+		tr.IncrementAt("x", base.Add(time.Duration(ms)*time.Millisecond))
+	}
+	tr.Flush()
+
+	typing := tr.GetStats("1h").Typing
+	if typing.Bursts != 2 || typing.Hesitations != 1 {
+		t.Fatalf("bursts = %d, hesitations = %d, want 2 and 1", typing.Bursts, typing.Hesitations)
+	}
+	// 6 intervals over 1.75s of bursts.
+	if want := 6.0 / 5 / (1.75 / 60); math.Abs(typing.WPM-want) > 1e-9 {
+		t.Fatalf("wpm = %f, want %f", typing.WPM, want)
+	}
+	if math.Abs(typing.AvgBurstSeconds-0.875) > 1e-9 {
+		t.Fatalf("avg burst = %fs, want 0.875s", typing.AvgBurstSeconds)
+	}
+
+	want := map[int64]int{100: 4, 150: 1, 1500: 1}
+	if len(typing.Intervals) != len(intervalBounds) {
+		t.Fatalf("intervals = %+v", typing.Intervals)
+	}
+	for _, ic := range typing.Intervals {
+		if ic.Count != want[ic.LE] {
+			t.Fatalf("intervals = %+v, want %v", typing.Intervals, want)
+		}
+	}
+}
+
+func TestTypingBurstSpansFlushes(t *testing.T) {
+	now := time.Date(2026, 3, 10, 14, 30, 0, 0, time.Local)
+	tr := openTestTracker(t, "host", now)
+
+	// A burst still in progress at flush time is not cut short.
+	tr.IncrementAt("a", now.Add(-time.Second))
+	tr.IncrementAt("b", now.Add(-500*time.Millisecond))
+	tr.Flush()
+	if got := tr.GetStats("1h").Typing.Bursts; got != 0 {
+		t.Fatalf("bursts before the pause = %d, want 0", got)
+	}
+
+	tr.now = func() time.Time { return now.Add(5 * time.Second) }
+	tr.Flush()
+	if got := tr.GetStats("1h").Typing; got.Bursts != 1 || got.AvgBurstSeconds != 0.5 {
+		t.Fatalf("typing after the pause = %+v, want one 0.5s burst", got)
+	}
+}
+
+func TestKeyTiming(t *testing.T) {
+	now := time.Date(2026, 3, 10, 14, 30, 0, 0, time.Local)
+	tr := openTestTracker(t, "host", now)
+	tr.now = func() time.Time { return now.Add(-10 * time.Second) }
+
+	in := tr.Device("kbd")
+	in.TrackKeyHold("letter", 80*time.Millisecond)
+	in.TrackKeyHold("letter", 120*time.Millisecond)
+	for range 25 {
+		in.TrackKeyRepeat("deletion")
+	}
+	in.TrackKeyHold("deletion", 3*time.Second)
+	tr.Flush()
+
+	got := tr.GetStats("1h").Typing.KeyTiming
+	want := []KeyTimingStats{
+		{Category: "letter", Presses: 2, AvgHoldMs: 100},
+		{Category: "deletion", Presses: 1, AvgHoldMs: 3000, LongHolds: 1, Repeats: 25},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("key timing = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("key timing = %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestKeyPositions(t *testing.T) {
+	now := time.Date(2026, 3, 10, 14, 30, 0, 0, time.Local)
+	tr := openTestTracker(t, "host", now)
+	tr.now = func() time.Time { return now.Add(-10 * time.Second) }
+
+	in := tr.Device("kbd")
+	for _, k := range []string{"j", "k", "j"} {
+		in.TrackKeyPosition(k)
+	}
+	tr.Flush()
+
+	got := tr.GetStats("1h").Typing.Positions
+	if len(got) != 2 || got[0] != (KeyCount{"j", 2}) || got[1] != (KeyCount{"k", 1}) {
+		t.Fatalf("positions = %+v, want j 2, k 1", got)
+	}
+}
+
+func TestHandleEvent(t *testing.T) {
+	now := time.Date(2026, 3, 10, 14, 30, 0, 0, time.Local)
+	tr := openTestTracker(t, "host", now)
+	tr.now = func() time.Time { return now.Add(-10 * time.Second) }
+
+	at := now.Add(-10 * time.Second)
+	for _, ev := range []input.Event{
+		{Time: at, Device: "kbd", Kind: input.KeyDown, Key: "f", Physical: "e"},
+		{Time: at, Device: "kbd", Kind: input.KeyUp, Key: "f", Held: 100 * time.Millisecond},
+		{Time: at, Device: "kbd", Kind: input.KeyRepeat, Key: "[BACKSPACE]"},
+		{Time: at, Device: "mouse", Kind: input.ButtonDown, Button: "right"},
+		{Time: at, Device: "mouse", Kind: input.Motion, DX: 3, DY: 4},
+		{Time: at, Device: "mouse", Kind: input.Scroll, Notches: -2},
+		{Time: at, Device: "mouse", Kind: input.Scroll, Notches: 1, Horizontal: true},
+	} {
+		tr.HandleEvent(ev)
+	}
+	tr.Flush()
+
+	stats := tr.GetStats("1h")
+	if stats.Total != 1 || len(stats.TopKeys) != 1 || stats.TopKeys[0].Key != "f" {
+		t.Errorf("keystrokes = %d %+v, want one f", stats.Total, stats.TopKeys)
+	}
+	if p := stats.Typing.Positions; len(p) != 1 || p[0].Key != "e" {
+		t.Errorf("positions = %+v, want e", p)
+	}
+	wantTiming := []KeyTimingStats{
+		{Category: "letter", Presses: 1, AvgHoldMs: 100},
+		{Category: "deletion", Repeats: 1},
+	}
+	if got := stats.Typing.KeyTiming; len(got) != 2 || got[0] != wantTiming[0] || got[1] != wantTiming[1] {
+		t.Errorf("key timing = %+v, want %+v", got, wantTiming)
+	}
+	want := MouseStats{Distance: 5, ClicksRight: 1, Scroll: 2, ScrollHorizontal: 1}
+	if stats.Mouse != want {
+		t.Errorf("mouse = %+v, want %+v", stats.Mouse, want)
+	}
+}
@@ -3,30 +3,156 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/getlantern/systray"
-	"github.com/victortrac/busygraph/internal/hook"
-	"github.com/victortrac/busygraph/internal/server"
+	"github.com/victortrac/busygraph/internal/config"
 	"github.com/victortrac/busygraph/internal/tracker"
-	"github.com/victortrac/busygraph/internal/videocall"
 	webview "github.com/webview/webview_go"
 )
 
-var isMini = flag.Bool("mini", false, "Start in mini dashboard mode")
+// command is a busygraph subcommand.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+// commands are listed in the order usage shows them.
+var commands = []command{
+	{"run", "Start tracking; with -headless, without a tray icon", runRun},
+	{"tray", "Start tracking with a tray icon (the default)", runTray},
+	{"mini", "Open the quick stats window of a running instance", runMini},
+	{"stats", "Print stats for a time window", runStats},
+	{"export", "Export raw minute data as CSV or JSON Lines", runExport},
+	{"import", "Merge exports or other BusyGraph databases", runImport},
+	{"devices", "List input devices and whether they are captured", runDevices},
+	{"input-helper", "Send per-minute input counts to an unprivileged BusyGraph (Linux)", runInputHelper},
+	{"replay", "Replay a recorded input trace into a temporary database", runReplay},
+	{"doctor", "Check input access, the data directory and the dashboard port", runDoctor},
+	{"config", "Show the effective configuration ('config show')", runConfig},
+}
+
+var (
+	// trayConfig is loaded before the tray starts, for onReady.
+	trayConfig *config.Config
+	// activeServices is set once the tray is ready so onExit can stop them.
+	activeServices *services
+	// tracePath, set by run -record, is the file every input event is
+	// recorded to.
+	tracePath string
+)
 
 func main() {
-	flag.Parse()
-	if *isMini {
-		openQuickStats()
+	name, args := "tray", os.Args[1:]
+	if len(args) > 0 {
+		switch a := args[0]; {
+		case a == "-mini" || a == "--mini":
+			// The original flag, kept for existing launchers.
+			name, args = "mini", args[1:]
+		case a == "help" || a == "-h" || a == "--help":
+			usage(os.Stdout)
+			return
+		case !strings.HasPrefix(a, "-"):
+			name, args = a, args[1:]
+		}
+	}
+
+	// A copy of busygraph installed setgid input to be the input helper
+	// must not run anything else with access to the devices.
+	if (os.Getegid() != os.Getgid() || os.Geteuid() != os.Getuid()) && name != "input-helper" {
+		fmt.Fprintf(os.Stderr, "busygraph: only input-helper may run setuid or setgid, not %q\n", name)
+		os.Exit(1)
+	}
+
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		if err := c.run(args); err != nil {
+			fmt.Fprintf(os.Stderr, "busygraph %s: %v\n", name, err)
+			os.Exit(1)
+		}
 		return
 	}
+
+	fmt.Fprintf(os.Stderr, "busygraph: unknown command %q\n\n", name)
+	usage(os.Stderr)
+	os.Exit(2)
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: busygraph [command] [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	width := 0
+	for _, c := range commands {
+		width = max(width, len(c.name))
+	}
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-*s  %s\n", width, c.name, c.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'busygraph <command> -h' for a command's flags.")
+}
+
+// parseConfig parses args with fs plus the config flags for keys (all
+// settings if none), and loads the effective configuration.
+func parseConfig(fs *flag.FlagSet, args []string, keys ...string) (*config.Config, error) {
+	cf := config.BindFlags(fs, keys...)
+	fs.Parse(args)
+	return cf.Load()
+}
+
+// openTracker opens the tracker for a short-lived command.
+func openTracker(cfg *config.Config) (*tracker.Tracker, error) {
+	return tracker.Open(append(cfg.TrackerOptions(), tracker.WithoutBackgroundJobs())...)
+}
+
+func runRun(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	headless := fs.Bool("headless", false, "Run without a tray icon, e.g. on a server or under systemd")
+	fs.StringVar(&tracePath, "record", "", "Record every input event, including which keys are pressed, to this trace file for 'busygraph replay'")
+	cfg, err := parseConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	if *headless {
+		return runHeadless(cfg)
+	}
+	trayConfig = cfg
 	systray.Run(onReady, onExit)
+	return nil
+}
+
+func runTray(args []string) error {
+	fs := flag.NewFlagSet("tray", flag.ExitOnError)
+	cfg, err := parseConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	trayConfig = cfg
+	systray.Run(onReady, onExit)
+	return nil
+}
+
+func runMini(args []string) error {
+	fs := flag.NewFlagSet("mini", flag.ExitOnError)
+	cfg, err := parseConfig(fs, args, "listen")
+	if err != nil {
+		return err
+	}
+	openQuickStats(cfg.DashboardURL())
+	return nil
 }
 
 func onReady() {
@@ -45,9 +171,12 @@ func onReady() {
 	mKeysToday := systray.AddMenuItem("Keys: -", "Total keystrokes today")
 	mKPM := systray.AddMenuItem("KPM: -", "Keystrokes per minute")
 	mMouse := systray.AddMenuItem("Mouse: -", "Mouse distance today")
+	mInput := systray.AddMenuItem("No input tracked", "Input capture failed; see the dashboard")
 	mKeysToday.Disable()
 	mKPM.Disable()
 	mMouse.Disable()
+	mInput.Disable()
+	mInput.Hide()
 
 	systray.AddSeparator()
 
@@ -58,32 +187,36 @@ func onReady() {
 
 	mQuit := systray.AddMenuItem("Quit", "Quit the application")
 
-	// Initialize tracker
-	t := tracker.NewTracker()
-
-	// Initialize video call detector with callback to track state
-	vc := videocall.NewDetector()
-	vc.SetCallback(func(inCall, cameraActive, micActive bool, app string) {
-		t.TrackVideoCall(inCall, cameraActive, micActive, app)
-	})
-	vc.Start(5 * time.Second)
+	// Initialize tracker, input hook, call detector and dashboard
+	cfg := trayConfig
+	t := tracker.NewTracker(cfg.TrackerOptions()...)
+	svc := startServices(t, cfg)
+	activeServices = svc
 
-	// Start hook in a goroutine
 	go func() {
-		hook.Start(t)
+		<-svc.serverDone
+		if svc.serverErr != nil {
+			log.Printf("Dashboard server failed: %v", svc.serverErr)
+			systray.Quit()
+		}
 	}()
 
-	// Start metrics server in a goroutine
+	// Quit cleanly on SIGTERM (e.g. logout) so buffered counts are flushed
 	go func() {
-		server.Start(":2112", t, vc)
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		systray.Quit()
 	}()
 
 	// Update stats in menu periodically
 	go func() {
-		updateMenuStats(t, mKeysToday, mKPM, mMouse)
+		updateMenuStats(t, cfg, mKeysToday, mKPM, mMouse)
+		updateMenuInput(svc, mInput)
 		ticker := time.NewTicker(5 * time.Second)
 		for range ticker.C {
-			updateMenuStats(t, mKeysToday, mKPM, mMouse)
+			updateMenuStats(t, cfg, mKeysToday, mKPM, mMouse)
+			updateMenuInput(svc, mInput)
 		}
 	}()
 
@@ -93,10 +226,10 @@ func onReady() {
 			select {
 			case <-mQuickStats.ClickedCh:
 				log.Println("DEBUG: Quick Stats menu item clicked")
-				openQuickStatsWindow()
+				openQuickStatsWindow(cfg)
 			case <-mDashboard.ClickedCh:
 				log.Println("DEBUG: Open Dashboard menu item clicked")
-				openBrowser("http://localhost:2112/dashboard")
+				openBrowser(cfg.DashboardURL() + "/dashboard")
 			case <-mQuit.ClickedCh:
 				log.Println("DEBUG: Quit menu item clicked")
 				systray.Quit()
@@ -106,7 +239,7 @@ func onReady() {
 	}()
 }
 
-func updateMenuStats(t *tracker.Tracker, mKeys, mKPM, mMouse *systray.MenuItem) {
+func updateMenuStats(t *tracker.Tracker, cfg *config.Config, mKeys, mKPM, mMouse *systray.MenuItem) {
 	stats := t.GetStats("24h")
 
 	// Format keystrokes with comma separator
@@ -115,9 +248,24 @@ func updateMenuStats(t *tracker.Tracker, mKeys, mKPM, mMouse *systray.MenuItem)
 	// Show current KPM (avg for the day)
 	mKPM.SetTitle(fmt.Sprintf("KPM: %.1f avg, %d max", stats.KPM.Avg, stats.KPM.Max))
 
-	// Mouse distance (convert pixels to meters, assuming 96 DPI)
-	meters := stats.Mouse.Distance / (96 / 0.0254)
-	mMouse.SetTitle(fmt.Sprintf("Mouse: %.1fm, %d clicks", meters, stats.Mouse.ClicksLeft+stats.Mouse.ClicksRight))
+	mMouse.SetTitle(fmt.Sprintf("Mouse: %.1fm, %d clicks", pixelsToMeters(stats.Mouse.Distance, cfg.MouseDPI), stats.Mouse.Clicks()))
+}
+
+// updateMenuInput shows mInput, with the reason as its tooltip, while no
+// input is being captured.
+func updateMenuInput(svc *services, mInput *systray.MenuItem) {
+	status := svc.inputStatus()
+	if status.Capturing {
+		mInput.Hide()
+		return
+	}
+	mInput.SetTooltip(status.Error)
+	mInput.Show()
+}
+
+// pixelsToMeters converts mouse distance to meters at the given screen DPI.
+func pixelsToMeters(px, dpi float64) float64 {
+	return px / (dpi / 0.0254)
 }
 
 func formatNumber(n int) string {
@@ -172,7 +320,7 @@ func getMiniLockPath() string {
 	return filepath.Join(os.TempDir(), "busygraph-mini.lock")
 }
 
-func openQuickStatsWindow() {
+func openQuickStatsWindow(cfg *config.Config) {
 	log.Println("DEBUG: openQuickStatsWindow called")
 	// Check if mini window is already open
 	lockFile := getMiniLockPath()
@@ -190,8 +338,8 @@ func openQuickStatsWindow() {
 		log.Printf("Error getting executable: %v", err)
 		return
 	}
-	log.Printf("DEBUG: Starting %s --mini", exe)
-	exec.Command(exe, "--mini").Start()
+	log.Printf("DEBUG: Starting %s mini", exe)
+	exec.Command(exe, "mini", "-listen", cfg.Listen).Start()
 }
 
 func focusMiniWindow() {
@@ -202,7 +350,7 @@ func focusMiniWindow() {
 	}
 }
 
-func openQuickStats() {
+func openQuickStats(dashboardURL string) {
 	// Create lock file
 	lockFile := getMiniLockPath()
 	f, err := os.Create(lockFile)
@@ -219,11 +367,13 @@ func openQuickStats() {
 
 	w.SetTitle("BusyGraph Quick Stats")
 	w.SetSize(460, 520, webview.HintNone)
-	w.Navigate("http://localhost:2112/mini")
+	w.Navigate(dashboardURL + "/mini")
 	w.Run()
 }
 
 func onExit() {
 	log.Println("BusyGraph exiting...")
-	hook.Stop()
+	if activeServices != nil {
+		activeServices.stop()
+	}
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/victortrac/busygraph/internal/hook"
+	"github.com/victortrac/busygraph/internal/input"
+	"github.com/victortrac/busygraph/internal/tracker"
+)
+
+// runReplay implements `busygraph replay`, feeding a trace recorded with
+// `busygraph run -record` into an empty, temporary database and printing the
+// stats it produces. The configured layout and key options apply, so a trace
+// can be checked against different settings.
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Print the full stats as JSON, as served by /api/stats")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: busygraph replay [flags] <trace.jsonl>")
+		fs.PrintDefaults()
+	}
+	cfg, err := parseConfig(fs, args, "mouse_dpi", "features.shortcuts", "features.key_timing", "input.layout", "input.physical_keys")
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected one trace file")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dir, err := os.MkdirTemp("", "busygraph-replay-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	// The tracker's clock follows the trace, and buffered counts are
+	// flushed whenever it enters a new minute, so everything lands in the
+	// minute it was recorded in.
+	var first, now time.Time
+	t, err := tracker.Open(
+		tracker.WithDataDir(dir),
+		tracker.WithoutPeers(),
+		tracker.WithoutBackgroundJobs(),
+		tracker.WithClock(func() time.Time { return now }),
+	)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	proc := hook.NewProcessor(t, cfg.HookOptions())
+	err = input.NewReplayer(f).Run(input.SinkFunc(func(ev input.Event) {
+		if first.IsZero() {
+			first = ev.Time
+		} else if !ev.Time.Truncate(time.Minute).Equal(now.Truncate(time.Minute)) {
+			t.Flush()
+		}
+		now = ev.Time
+		proc.HandleEvent(ev)
+	}))
+	if err != nil {
+		return err
+	}
+	if first.IsZero() {
+		return errors.New("the trace has no events")
+	}
+	t.Flush()
+
+	rng, err := tracker.NewRange(first.Truncate(time.Minute), now.Truncate(time.Minute).Add(time.Minute), 0)
+	if err != nil {
+		return err
+	}
+	return printStats(t.GetStatsForRange(rng), rng, cfg, *asJSON)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/victortrac/busygraph/internal/config"
+	"github.com/victortrac/busygraph/internal/tracker"
+)
+
+// runStats implements `busygraph stats`, printing a summary of the local and
+// federated data for a window.
+func runStats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	name := fs.String("range", "", "Window ending now: 1h, 24h, 7d, 30d or 1y (default 24h)")
+	from := fs.String("from", "", "Start of the window (Unix seconds, RFC 3339 or YYYY-MM-DD)")
+	to := fs.String("to", "", "End of the window, exclusive; a date includes that whole day (default now)")
+	asJSON := fs.Bool("json", false, "Print the full stats as JSON, as served by /api/stats")
+	cfg, err := parseConfig(fs, args, "data_dir")
+	if err != nil {
+		return err
+	}
+
+	if *name == "" && *from == "" && *to == "" {
+		*name = "24h"
+	}
+	rng, err := tracker.ParseRange(*name, *from, *to, "", time.Now())
+	if err != nil {
+		return err
+	}
+
+	t, err := openTracker(cfg)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+	return printStats(t.GetStatsForRange(rng), rng, cfg, *asJSON)
+}
+
+// printStats prints stats for rng as a summary, or in full as JSON.
+func printStats(stats tracker.Stats, rng tracker.Range, cfg *config.Config, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	}
+
+	const layout = "2006-01-02 15:04"
+	fmt.Printf("Window:       %s to %s\n", rng.From.Format(layout), rng.To.Format(layout))
+	fmt.Printf("Keystrokes:   %s (%.1f KPM avg, %d max)\n", formatNumber(stats.Total), stats.KPM.Avg, stats.KPM.Max)
+	if ty := stats.Typing; ty.Bursts > 0 {
+		fmt.Printf("Typing:       %.0f WPM in %d bursts (%.1fs avg), %d hesitations\n", ty.WPM, ty.Bursts, ty.AvgBurstSeconds, ty.Hesitations)
+	}
+	if len(stats.Typing.KeyTiming) > 0 {
+		var held []string
+		for _, kt := range stats.Typing.KeyTiming {
+			held = append(held, fmt.Sprintf("%s %.0fms (%d repeats)", kt.Category, kt.AvgHoldMs, kt.Repeats))
+		}
+		fmt.Printf("Key holds:    %s\n", strings.Join(held, ", "))
+	}
+	if len(stats.TopKeys) > 0 {
+		var keys []string
+		for i, k := range stats.TopKeys {
+			if i == 10 {
+				break
+			}
+			keys = append(keys, fmt.Sprintf("%s %d", k.Key, k.Count))
+		}
+		fmt.Printf("Top keys:     %s\n", strings.Join(keys, ", "))
+	}
+	if len(stats.TopShortcuts) > 0 {
+		var chords []string
+		for _, k := range stats.TopShortcuts {
+			chords = append(chords, fmt.Sprintf("%s %d", k.Key, k.Count))
+		}
+		fmt.Printf("Shortcuts:    %s\n", strings.Join(chords, ", "))
+	}
+	m := stats.Mouse
+	fmt.Printf("Mouse:        %.1fm, %d clicks, %d scroll\n", pixelsToMeters(m.Distance, cfg.MouseDPI), m.Clicks(), m.Scroll)
+	if m.Clicks() > 0 || m.ScrollHorizontal > 0 {
+		fmt.Printf("Buttons:      %d left, %d right, %d middle, %d back, %d forward; %d horizontal scroll\n",
+			m.ClicksLeft, m.ClicksRight, m.ClicksMiddle, m.ClicksBack, m.ClicksForward, m.ScrollHorizontal)
+	}
+	for i, d := range stats.Devices {
+		label := ""
+		if i == 0 {
+			label = "Devices:"
+		}
+		fmt.Printf("%-13s %s: %s keys, %.1fm, %d clicks\n", label, d.Name, formatNumber(d.Keystrokes),
+			pixelsToMeters(d.Mouse.Distance, cfg.MouseDPI), d.Mouse.Clicks())
+	}
+	fmt.Printf("Calls:        %d min\n", stats.CallMinutes)
+	if stats.BusiestHour >= 0 {
+		fmt.Printf("Busiest hour: %02d:00\n", stats.BusiestHour)
+	}
+	if stats.BusiestDay >= 0 {
+		fmt.Printf("Busiest day:  %s\n", time.Weekday(stats.BusiestDay))
+	}
+	return nil
+}